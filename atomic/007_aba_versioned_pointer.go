@@ -6,28 +6,48 @@ import (
 )
 
 // Run with: go run atomic/007_aba_versioned_pointer.go
-// Demonstrates a simple versioned pointer to mitigate ABA in CAS patterns.
+// Demonstrates a versioned pointer to mitigate ABA in CAS patterns.
+//
+// Pointer and version live in one immutable record and the record is swapped
+// as a unit. Keeping them in two separate atomics (CAS the pointer, then bump
+// the version) is racy: another goroutine can run between the two steps.
+// Reusable version with hazard pointers: atomic/tagged.
 
 type node struct{ v int }
 
+type record struct {
+	ptr *node
+	ver uint64
+}
+
 type versioned struct {
-	ptr atomic.Pointer[node]
-	ver atomic.Uint64
+	rec atomic.Pointer[record]
 }
 
-func (v *versioned) Load() (*node, uint64) { return v.ptr.Load(), v.ver.Load() }
+func (v *versioned) Load() (*node, uint64) {
+	r := v.rec.Load()
+	if r == nil { return nil, 0 }
+	return r.ptr, r.ver
+}
 
 func (v *versioned) CAS(oldPtr *node, oldVer uint64, newPtr *node) bool {
-	if !v.ptr.CompareAndSwap(oldPtr, newPtr) { return false }
-	v.ver.Add(1)
-	return true
+	cur := v.rec.Load()
+	if cur == nil || cur.ptr != oldPtr || cur.ver != oldVer { return false }
+	return v.rec.CompareAndSwap(cur, &record{ptr: newPtr, ver: oldVer + 1})
 }
 
 func main() {
 	var v versioned
-	v.ptr.Store(&node{v:1})
+	a := &node{v:1}
+	v.rec.Store(&record{ptr: a})
 	p, ver := v.Load()
-	ok := v.CAS(p, ver, &node{v:2})
-	fmt.Println("cas:", ok, "new:", v.ptr.Load().v, "ver:", v.ver.Load())
-}
 
+	// Someone else swaps a out and back in: same pointer, newer version.
+	v.CAS(a, 0, &node{v:2})
+	q, qv := v.Load()
+	v.CAS(q, qv, a)
+
+	ok := v.CAS(p, ver, &node{v:3})
+	cur, curVer := v.Load()
+	fmt.Println("stale cas:", ok, "current:", cur.v, "ver:", curVer)
+}
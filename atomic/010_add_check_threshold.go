@@ -10,6 +10,8 @@ import (
 // Increment and check threshold using atomic.AddInt64/atomic.Int64.
 var count atomic.Int64
 
+// BAD as a limiter: the increment is kept even when the check fails, so count
+// climbs past limit and nothing ever gives the slot back.
 func incAndCheck(limit int64) error {
 	v := count.Add(1) // atomic increment; returns new value
 	if v >= limit {
@@ -18,6 +20,24 @@ func incAndCheck(limit int64) error {
 	return nil
 }
 
+// GOOD: only commit the increment if it stays within limit (CAS loop), and
+// pair every successful acquire with a release. Full version: atomic/quota.
+var inUse atomic.Int64
+
+func tryAcquire(limit int64) bool {
+	for {
+		cur := inUse.Load()
+		if cur+1 > limit {
+			return false
+		}
+		if inUse.CompareAndSwap(cur, cur+1) {
+			return true
+		}
+	}
+}
+
+func release() { inUse.Add(-1) }
+
 func main() {
 	limit := int64(5)
 	for i := 0; i < 7; i++ {
@@ -29,5 +49,10 @@ func main() {
 			fmt.Println(nil)
 		}
 	}
-}
 
+	for i := 0; i < 7; i++ {
+		fmt.Println("acquire:", tryAcquire(limit), "inUse:", inUse.Load())
+	}
+	release()
+	fmt.Println("after release, acquire:", tryAcquire(limit), "inUse:", inUse.Load())
+}
@@ -0,0 +1,151 @@
+package bench
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"gobyexamples/atomic/readmostly"
+)
+
+// Run with: go test -bench='SeqLock|RCU' -benchmem ./atomic/bench -cpu=1,4
+//
+// Each benchmark runs at two read:write ratios. writeEvery=100 is ~99:1,
+// writeEvery=10 is ~90:10.
+
+var readRatios = []struct {
+	name       string
+	writeEvery int
+}{
+	{"99to1", 100},
+	{"90to10", 10},
+}
+
+type pointCfg struct{ A, B, C int64 }
+
+type rwPoint struct {
+	mu  sync.RWMutex
+	val pointCfg
+}
+
+func BenchmarkSeqLockVsRWMutex(b *testing.B) {
+	for _, r := range readRatios {
+		b.Run("SeqLock/"+r.name, func(b *testing.B) {
+			s := readmostly.NewSeqLock(pointCfg{})
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				var i int64
+				for pb.Next() {
+					i++
+					if i%int64(r.writeEvery) == 0 {
+						s.Store(pointCfg{A: i, B: i, C: i})
+						continue
+					}
+					_ = s.Load()
+				}
+			})
+		})
+		b.Run("RWMutex/"+r.name, func(b *testing.B) {
+			s := &rwPoint{}
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				var i int64
+				for pb.Next() {
+					i++
+					if i%int64(r.writeEvery) == 0 {
+						s.mu.Lock()
+						s.val = pointCfg{A: i, B: i, C: i}
+						s.mu.Unlock()
+						continue
+					}
+					s.mu.RLock()
+					_ = s.val
+					s.mu.RUnlock()
+				}
+			})
+		})
+	}
+}
+
+const mapKeys = 256
+
+var keyNames = func() []string {
+	k := make([]string, mapKeys)
+	for i := range k {
+		k[i] = "key-" + strconv.Itoa(i)
+	}
+	return k
+}()
+
+type rwMap struct {
+	mu sync.RWMutex
+	m  map[string]int
+}
+
+func BenchmarkRCUMapVsAlternatives(b *testing.B) {
+	for _, r := range readRatios {
+		b.Run("RCUMap/"+r.name, func(b *testing.B) {
+			m := readmostly.NewRCUMap[string, int]()
+			m.Update(func(next map[string]int) {
+				for i, k := range keyNames {
+					next[k] = i
+				}
+			})
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				var i int
+				for pb.Next() {
+					i++
+					k := keyNames[i%mapKeys]
+					if i%r.writeEvery == 0 {
+						m.Store(k, i)
+						continue
+					}
+					_, _ = m.Load(k)
+				}
+			})
+		})
+		b.Run("RWMutexMap/"+r.name, func(b *testing.B) {
+			m := &rwMap{m: make(map[string]int, mapKeys)}
+			for i, k := range keyNames {
+				m.m[k] = i
+			}
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				var i int
+				for pb.Next() {
+					i++
+					k := keyNames[i%mapKeys]
+					if i%r.writeEvery == 0 {
+						m.mu.Lock()
+						m.m[k] = i
+						m.mu.Unlock()
+						continue
+					}
+					m.mu.RLock()
+					_ = m.m[k]
+					m.mu.RUnlock()
+				}
+			})
+		})
+		b.Run("SyncMap/"+r.name, func(b *testing.B) {
+			var m sync.Map
+			for i, k := range keyNames {
+				m.Store(k, i)
+			}
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				var i int
+				for pb.Next() {
+					i++
+					k := keyNames[i%mapKeys]
+					if i%r.writeEvery == 0 {
+						m.Store(k, i)
+						continue
+					}
+					_, _ = m.Load(k)
+				}
+			})
+		})
+	}
+}
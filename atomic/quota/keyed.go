@@ -0,0 +1,72 @@
+package quota
+
+import (
+	"context"
+	"sync"
+)
+
+// Keyed keeps one Quota per key (per API key, per tenant, ...), created on
+// first use. Keys are never evicted; call Delete once a key is retired and no
+// longer holds units.
+type Keyed[K comparable] struct {
+	mu       sync.Mutex
+	quotas   map[K]*Quota
+	limitFor func(K) int64
+	parent   *Quota
+	fair     bool
+}
+
+// NewKeyed returns per-key quotas whose limits come from limitFor. If parent
+// is non-nil every key is a child of it, giving a shared ceiling across keys.
+func NewKeyed[K comparable](limitFor func(K) int64, parent *Quota, fair bool) *Keyed[K] {
+	return &Keyed[K]{quotas: make(map[K]*Quota), limitFor: limitFor, parent: parent, fair: fair}
+}
+
+// For returns the Quota for k, creating it if needed.
+func (k *Keyed[K]) For(key K) *Quota {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	q, ok := k.quotas[key]
+	if !ok {
+		switch {
+		case k.parent != nil:
+			q = k.parent.NewChild(k.limitFor(key))
+		case k.fair:
+			q = NewFair(k.limitFor(key))
+		default:
+			q = New(k.limitFor(key))
+		}
+		k.quotas[key] = q
+	}
+	return q
+}
+
+// TryAcquire is For(key).TryAcquire(n).
+func (k *Keyed[K]) TryAcquire(key K, n int64) bool { return k.For(key).TryAcquire(n) }
+
+// Acquire is For(key).Acquire(ctx, n).
+func (k *Keyed[K]) Acquire(ctx context.Context, key K, n int64) error {
+	return k.For(key).Acquire(ctx, n)
+}
+
+// Release is For(key).Release(n).
+func (k *Keyed[K]) Release(key K, n int64) { k.For(key).Release(n) }
+
+// Delete forgets key. Units still held on its Quota stay charged to the
+// parent until released through the *Quota the caller already has.
+func (k *Keyed[K]) Delete(key K) {
+	k.mu.Lock()
+	delete(k.quotas, key)
+	k.mu.Unlock()
+}
+
+// Usage returns a snapshot of Stats per key for metrics export.
+func (k *Keyed[K]) Usage() map[K]Stats {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	out := make(map[K]Stats, len(k.quotas))
+	for key, q := range k.quotas {
+		out[key] = q.Stats()
+	}
+	return out
+}
@@ -0,0 +1,253 @@
+// Package quota implements a counting limiter on top of the add-and-check
+// pattern from atomic/010_add_check_threshold.go, fixed so it never overshoots
+// the limit and always gives capacity back.
+//
+// A Quota can have children (tenant -> user): acquiring on a child also
+// acquires on every ancestor, so each level enforces its own limit.
+package quota
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrExceedsLimit is returned by Acquire when n is larger than the limit of
+// the quota or one of its ancestors, so waiting could never succeed.
+var ErrExceedsLimit = errors.New("quota: request exceeds limit")
+
+// Quota tracks usage against a limit. The fast paths (TryAcquire, Release
+// with no waiters) are lock-free CAS loops; a mutex shared by the whole tree
+// guards only the waiter queue.
+type Quota struct {
+	limit  atomic.Int64
+	used   atomic.Int64
+	parent *Quota
+	root   *Quota
+
+	// Fields below are only used on the root.
+	fair    bool
+	waiting atomic.Int64 // waiters queued anywhere in the tree
+	mu      sync.Mutex   // guards queue
+	queue   list.List    // of *waiter, FIFO
+}
+
+type waiter struct {
+	q     *Quota
+	n     int64
+	ready chan struct{}
+	elem  *list.Element
+}
+
+// Stats is a point-in-time view for metrics.
+type Stats struct {
+	Limit   int64
+	Used    int64
+	Waiting int64 // waiters queued in the whole tree
+}
+
+// New returns a root Quota with the given limit. Blocked Acquire calls are
+// served in whatever order capacity allows, and TryAcquire may overtake them.
+func New(limit int64) *Quota { return newRoot(limit, false) }
+
+// NewFair returns a root Quota in fairness mode: waiters are served FIFO per
+// bottleneck, and TryAcquire fails instead of jumping ahead of a queued waiter
+// that is blocked on the same quota.
+func NewFair(limit int64) *Quota { return newRoot(limit, true) }
+
+func newRoot(limit int64, fair bool) *Quota {
+	q := &Quota{fair: fair}
+	q.root = q
+	q.limit.Store(limit)
+	return q
+}
+
+// NewChild returns a Quota limited to limit that also draws from q.
+func (q *Quota) NewChild(limit int64) *Quota {
+	c := &Quota{parent: q, root: q.root}
+	c.limit.Store(limit)
+	return c
+}
+
+// TryAcquire takes n units from q and all its ancestors, or nothing at all.
+func (q *Quota) TryAcquire(n int64) bool {
+	mustPositive(n)
+	r := q.root
+	if r.fair && r.waiting.Load() > 0 {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if q.chainBlocked(r.grantLocked()) {
+			return false
+		}
+	}
+	return q.tryAcquire(n) == nil
+}
+
+// Acquire blocks until n units are available or ctx is done.
+func (q *Quota) Acquire(ctx context.Context, n int64) error {
+	mustPositive(n)
+	for node := q; node != nil; node = node.parent {
+		if n > node.limit.Load() {
+			return fmt.Errorf("%w: need %d, limit %d", ErrExceedsLimit, n, node.limit.Load())
+		}
+	}
+	if q.TryAcquire(n) {
+		return nil
+	}
+
+	r := q.root
+	w := &waiter{q: q, n: n, ready: make(chan struct{})}
+	r.mu.Lock()
+	r.waiting.Add(1) // before retrying, so a concurrent Release sees us
+	w.elem = r.queue.PushBack(w)
+	r.grantLocked()
+	r.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	select {
+	case <-w.ready: // granted while we were cancelling; keep it
+		return nil
+	default:
+	}
+	r.queue.Remove(w.elem)
+	r.waiting.Add(-1)
+	r.grantLocked() // we may have been the head blocking others
+	return ctx.Err()
+}
+
+// Release returns n units to q and all its ancestors and wakes waiters that
+// now fit. Releasing more than any level holds panics, leaving every level
+// unchanged.
+func (q *Quota) Release(n int64) {
+	mustPositive(n)
+	for node := q; node != nil; node = node.parent {
+		if !node.trySub(n) {
+			for undo := q; undo != node; undo = undo.parent {
+				undo.used.Add(n)
+			}
+			panic("quota: released more than acquired")
+		}
+	}
+	q.root.wake()
+}
+
+// SetLimit changes the limit. Lowering it below current usage does not revoke
+// anything; new acquisitions simply fail until usage drops.
+func (q *Quota) SetLimit(limit int64) {
+	q.limit.Store(limit)
+	q.root.wake()
+}
+
+// Used returns the units currently held.
+func (q *Quota) Used() int64 { return q.used.Load() }
+
+// Limit returns the current limit.
+func (q *Quota) Limit() int64 { return q.limit.Load() }
+
+// Stats returns usage for metrics export.
+func (q *Quota) Stats() Stats {
+	return Stats{Limit: q.limit.Load(), Used: q.used.Load(), Waiting: q.root.waiting.Load()}
+}
+
+// tryAdd is the corrected add-and-check: it only commits the increment if
+// the result stays within the limit, so usage can never overshoot.
+func (q *Quota) tryAdd(n int64) bool {
+	for {
+		cur := q.used.Load()
+		if cur+n > q.limit.Load() {
+			return false
+		}
+		if q.used.CompareAndSwap(cur, cur+n) {
+			return true
+		}
+	}
+}
+
+// trySub takes n off usage unless that would make it negative.
+func (q *Quota) trySub(n int64) bool {
+	for {
+		cur := q.used.Load()
+		if cur < n {
+			return false
+		}
+		if q.used.CompareAndSwap(cur, cur-n) {
+			return true
+		}
+	}
+}
+
+// tryAcquire walks up the tree and rolls back on the first level that is
+// full, returning that level (nil on success).
+func (q *Quota) tryAcquire(n int64) (full *Quota) {
+	for node := q; node != nil; node = node.parent {
+		if !node.tryAdd(n) {
+			for undo := q; undo != node; undo = undo.parent {
+				undo.used.Add(-n)
+			}
+			return node
+		}
+	}
+	return nil
+}
+
+func (q *Quota) chainBlocked(blocked map[*Quota]bool) bool {
+	for node := q; node != nil; node = node.parent {
+		if blocked[node] {
+			return true
+		}
+	}
+	return false
+}
+
+// wake is called on the root after capacity may have grown.
+func (q *Quota) wake() {
+	if q.waiting.Load() == 0 {
+		return
+	}
+	q.mu.Lock()
+	q.grantLocked()
+	q.mu.Unlock()
+}
+
+// grantLocked hands capacity to queued waiters in FIFO order. In fair mode a
+// waiter that does not fit marks the level it hit as blocked, and later
+// waiters drawing from that level must wait behind it. The blocked set is
+// returned so TryAcquire can apply the same rule.
+func (q *Quota) grantLocked() map[*Quota]bool {
+	var blocked map[*Quota]bool
+	for e := q.queue.Front(); e != nil; {
+		next := e.Next()
+		w := e.Value.(*waiter)
+		if q.fair && w.q.chainBlocked(blocked) {
+			e = next
+			continue
+		}
+		if full := w.q.tryAcquire(w.n); full == nil {
+			q.queue.Remove(e)
+			q.waiting.Add(-1)
+			close(w.ready)
+		} else if q.fair {
+			if blocked == nil {
+				blocked = make(map[*Quota]bool)
+			}
+			blocked[full] = true
+		}
+		e = next
+	}
+	return blocked
+}
+
+func mustPositive(n int64) {
+	if n <= 0 {
+		panic("quota: n must be positive")
+	}
+}
@@ -0,0 +1,207 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Under heavy contention the number of concurrent holders must never exceed
+// the limit, and every unit must come back.
+func TestNeverOvershootsUnderContention(t *testing.T) {
+	const limit = 5
+	q := New(limit)
+	var holders, peak atomic.Int64
+	var wg sync.WaitGroup
+	for g := 0; g < 32; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				if !q.TryAcquire(1) {
+					continue
+				}
+				h := holders.Add(1)
+				for {
+					p := peak.Load()
+					if h <= p || peak.CompareAndSwap(p, h) {
+						break
+					}
+				}
+				holders.Add(-1)
+				q.Release(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if peak.Load() > limit {
+		t.Fatalf("peak holders %d exceeded limit %d", peak.Load(), limit)
+	}
+	if q.Used() != 0 {
+		t.Fatalf("leaked %d units", q.Used())
+	}
+}
+
+func TestAcquireBlocksUntilRelease(t *testing.T) {
+	q := New(2)
+	if !q.TryAcquire(2) {
+		t.Fatal("initial TryAcquire failed")
+	}
+	done := make(chan error)
+	go func() { done <- q.Acquire(context.Background(), 1) }()
+	waitFor(t, func() bool { return q.Stats().Waiting == 1 })
+	q.Release(1)
+	if err := <-done; err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if q.Used() != 2 {
+		t.Fatalf("Used = %d, want 2", q.Used())
+	}
+}
+
+func TestAcquireCancel(t *testing.T) {
+	q := New(1)
+	q.TryAcquire(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.Acquire(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v", err)
+	}
+	if s := q.Stats(); s.Waiting != 0 || s.Used != 1 {
+		t.Fatalf("stats after cancel = %+v", s)
+	}
+	if err := q.Acquire(context.Background(), 2); !errors.Is(err, ErrExceedsLimit) {
+		t.Fatalf("oversized Acquire err = %v", err)
+	}
+}
+
+func TestHierarchical(t *testing.T) {
+	tenant := New(10)
+	alice := tenant.NewChild(8)
+	bob := tenant.NewChild(8)
+
+	if !alice.TryAcquire(8) {
+		t.Fatal("alice within both limits")
+	}
+	if alice.TryAcquire(1) {
+		t.Fatal("alice exceeded user limit")
+	}
+	if bob.TryAcquire(3) {
+		t.Fatal("bob exceeded tenant limit")
+	}
+	if bob.Used() != 0 {
+		t.Fatalf("failed acquire left bob at %d", bob.Used())
+	}
+	if !bob.TryAcquire(2) || tenant.Used() != 10 {
+		t.Fatalf("tenant used = %d, want 10", tenant.Used())
+	}
+	alice.Release(8)
+	if tenant.Used() != 2 || alice.Used() != 0 {
+		t.Fatalf("after release tenant=%d alice=%d", tenant.Used(), alice.Used())
+	}
+}
+
+func TestOverReleaseLeavesChainIntact(t *testing.T) {
+	tenant := New(10)
+	alice := tenant.NewChild(8)
+	alice.TryAcquire(2)
+	tenant.Release(2) // misuse: the tenant no longer holds alice's units
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("over-release did not panic")
+			}
+		}()
+		alice.Release(2)
+	}()
+	if alice.Used() != 2 || tenant.Used() != 0 {
+		t.Fatalf("after failed release alice=%d tenant=%d, want 2 and 0", alice.Used(), tenant.Used())
+	}
+}
+
+// In fair mode a large request at the head of the queue is not starved by a
+// stream of small ones.
+func TestFairModeFIFO(t *testing.T) {
+	q := NewFair(4)
+	q.TryAcquire(4)
+
+	bigDone := make(chan struct{})
+	go func() {
+		if err := q.Acquire(context.Background(), 3); err != nil {
+			t.Error(err)
+		}
+		close(bigDone)
+	}()
+	waitFor(t, func() bool { return q.Stats().Waiting == 1 })
+
+	q.Release(1) // 1 free: not enough for the head waiter
+	if q.TryAcquire(1) {
+		t.Fatal("TryAcquire overtook a queued waiter in fair mode")
+	}
+	q.Release(2)
+	<-bigDone
+	if q.Used() != 4 {
+		t.Fatalf("Used = %d, want 4", q.Used())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	unfair := New(4)
+	unfair.TryAcquire(4)
+	go unfair.Acquire(ctx, 3)
+	waitFor(t, func() bool { return unfair.Stats().Waiting == 1 })
+	unfair.Release(1)
+	if !unfair.TryAcquire(1) {
+		t.Fatal("unfair mode should let TryAcquire barge")
+	}
+}
+
+// Fairness is per bottleneck: a waiter stuck on its own user limit must not
+// block a sibling that only needs tenant capacity.
+func TestFairModeSiblingsIndependent(t *testing.T) {
+	tenant := NewFair(10)
+	alice := tenant.NewChild(2)
+	bob := tenant.NewChild(5)
+	alice.TryAcquire(2)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go alice.Acquire(ctx, 1)
+	waitFor(t, func() bool { return tenant.Stats().Waiting == 1 })
+	if !bob.TryAcquire(1) {
+		t.Fatal("bob blocked by alice's user-level wait")
+	}
+}
+
+func TestKeyed(t *testing.T) {
+	global := New(5)
+	k := NewKeyed(func(string) int64 { return 3 }, global, false)
+	if !k.TryAcquire("a", 3) || k.TryAcquire("a", 1) {
+		t.Fatal("per-key limit not enforced")
+	}
+	if !k.TryAcquire("b", 2) || k.TryAcquire("c", 1) {
+		t.Fatal("shared parent limit not enforced")
+	}
+	u := k.Usage()
+	if u["a"].Used != 3 || u["b"].Used != 2 {
+		t.Fatalf("usage = %+v", u)
+	}
+	k.Release("a", 3)
+	if global.Used() != 2 {
+		t.Fatalf("global used = %d", global.Used())
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,157 @@
+package readmostly
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// RCUMap is a copy-on-write map in the read-copy-update style: readers load
+// the current map through an atomic.Pointer and never block, writers copy the
+// map, modify the copy, and swap it in under a mutex.
+//
+// Go's GC already frees old versions once nobody references them, so the
+// grace-period machinery is only needed for cleanup that must not race with
+// readers (closing a connection stored as a value, returning a buffer to a
+// pool). Queue that work with Defer and it runs after every Range that could
+// have seen the old version has finished.
+//
+// Load is a plain atomic pointer load and map lookup: it writes no shared
+// memory, and so is not covered by grace periods. A value it returns may be
+// cleaned up while the caller still holds it; read such values inside Range,
+// whose entry and exit cost two atomic adds on a shared reader counter.
+type RCUMap[K comparable, V any] struct {
+	mu      sync.Mutex // serializes writers and guards pending
+	syncMu  sync.Mutex // serializes grace periods
+	cur     atomic.Pointer[map[K]V]
+	gp      gracePeriod
+	pending []func()
+}
+
+// NewRCUMap returns an empty map.
+func NewRCUMap[K comparable, V any]() *RCUMap[K, V] {
+	m := &RCUMap[K, V]{}
+	empty := map[K]V{}
+	m.cur.Store(&empty)
+	return m
+}
+
+// Load returns the value stored for k. Defer callbacks do not wait for it.
+func (m *RCUMap[K, V]) Load(k K) (V, bool) {
+	v, ok := (*m.cur.Load())[k]
+	return v, ok
+}
+
+// Len returns the number of entries in the current version.
+func (m *RCUMap[K, V]) Len() int { return len(*m.cur.Load()) }
+
+// Range calls fn for every entry of a single consistent version, stopping
+// early if fn returns false. Writers are not blocked while Range runs, but
+// Defer callbacks wait for it.
+func (m *RCUMap[K, V]) Range(fn func(K, V) bool) {
+	slot := m.gp.enter()
+	defer m.gp.exit(slot)
+	for k, v := range *m.cur.Load() {
+		if !fn(k, v) {
+			return
+		}
+	}
+}
+
+// Store sets k to v.
+func (m *RCUMap[K, V]) Store(k K, v V) {
+	m.Update(func(next map[K]V) { next[k] = v })
+}
+
+// Swap sets k to v and returns the previous value, if any.
+func (m *RCUMap[K, V]) Swap(k K, v V) (old V, loaded bool) {
+	m.Update(func(next map[K]V) {
+		old, loaded = next[k]
+		next[k] = v
+	})
+	return old, loaded
+}
+
+// Delete removes k and returns the removed value, if any.
+func (m *RCUMap[K, V]) Delete(k K) (old V, loaded bool) {
+	m.Update(func(next map[K]V) {
+		old, loaded = next[k]
+		delete(next, k)
+	})
+	return old, loaded
+}
+
+// Update applies fn to a private copy of the map and publishes the result.
+// Batch several changes into one Update to pay for a single copy.
+func (m *RCUMap[K, V]) Update(fn func(next map[K]V)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prev := *m.cur.Load()
+	next := make(map[K]V, len(prev)+1)
+	for k, v := range prev {
+		next[k] = v
+	}
+	fn(next)
+	m.cur.Store(&next)
+}
+
+// Defer queues fn to run after the next grace period, i.e. once every Range
+// that was active when the current version was replaced has finished.
+// Callbacks run on the goroutine that calls Synchronize.
+func (m *RCUMap[K, V]) Defer(fn func()) {
+	m.mu.Lock()
+	m.pending = append(m.pending, fn)
+	m.mu.Unlock()
+}
+
+// Synchronize waits for a full grace period and then runs the callbacks
+// queued with Defer before the call. Writers are not blocked during the
+// wait, so a Range callback may Store or Defer while Synchronize runs.
+func (m *RCUMap[K, V]) Synchronize() {
+	m.mu.Lock()
+	callbacks := m.pending
+	m.pending = nil
+	m.mu.Unlock()
+
+	m.syncMu.Lock()
+	m.gp.wait()
+	m.syncMu.Unlock()
+	for _, fn := range callbacks {
+		fn()
+	}
+}
+
+// gracePeriod tracks readers in two epoch slots, the same two-phase scheme
+// userspace RCU uses. A reader registers in the slot of the epoch it observed.
+// A writer flips the epoch and waits for the old slot to drain, twice: one
+// flip is not enough because a reader may have read the epoch before the
+// previous flip and registered only afterwards.
+type gracePeriod struct {
+	epoch   atomic.Uint64
+	readers [2]paddedCounter
+}
+
+type paddedCounter struct {
+	n atomic.Int64
+	_ [56]byte // keep the two slots on separate cache lines
+}
+
+func (g *gracePeriod) enter() int {
+	slot := int(g.epoch.Load() & 1)
+	g.readers[slot].n.Add(1)
+	return slot
+}
+
+func (g *gracePeriod) exit(slot int) { g.readers[slot].n.Add(-1) }
+
+// wait must not run concurrently with itself.
+func (g *gracePeriod) wait() {
+	for phase := 0; phase < 2; phase++ {
+		old := int(g.epoch.Add(1)-1) & 1
+		for spins := 0; g.readers[old].n.Load() != 0; spins++ {
+			if spins > 64 {
+				runtime.Gosched()
+			}
+		}
+	}
+}
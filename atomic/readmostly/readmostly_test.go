@@ -0,0 +1,156 @@
+package readmostly
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type pair struct{ A, B int64 }
+
+func TestSeqLockNoTornReads(t *testing.T) {
+	s := NewSeqLock(pair{})
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !stop.Load() {
+				if p := s.Load(); p.A != p.B {
+					t.Errorf("torn read: %+v", p)
+					return
+				}
+			}
+		}()
+	}
+	for i := int64(1); i <= 20000; i++ {
+		s.Store(pair{A: i, B: i})
+	}
+	stop.Store(true)
+	wg.Wait()
+	if got := s.Load(); got.A != 20000 {
+		t.Fatalf("final = %+v", got)
+	}
+	if s.Seq()&1 != 0 {
+		t.Fatal("sequence left odd after Store")
+	}
+}
+
+func TestSeqLockRejectsPointers(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic for pointer-carrying type")
+		}
+	}()
+	NewSeqLock(struct{ S string }{})
+}
+
+func TestRCUMapBasic(t *testing.T) {
+	m := NewRCUMap[string, int]()
+	m.Store("a", 1)
+	if old, ok := m.Swap("a", 2); !ok || old != 1 {
+		t.Fatalf("Swap = %d,%v", old, ok)
+	}
+	if v, ok := m.Load("a"); !ok || v != 2 {
+		t.Fatalf("Load = %d,%v", v, ok)
+	}
+	m.Update(func(next map[string]int) { next["b"], next["c"] = 3, 4 })
+	if m.Len() != 3 {
+		t.Fatalf("Len = %d", m.Len())
+	}
+	if _, ok := m.Delete("a"); !ok {
+		t.Fatal("Delete missed existing key")
+	}
+	sum := 0
+	m.Range(func(_ string, v int) bool { sum += v; return true })
+	if sum != 7 {
+		t.Fatalf("Range sum = %d", sum)
+	}
+}
+
+// A deferred callback must not run while a reader that saw the old version is
+// still inside Range.
+func TestRCUMapDeferWaitsForReaders(t *testing.T) {
+	m := NewRCUMap[string, *int]()
+	v := 1
+	m.Store("k", &v)
+
+	inRange := make(chan struct{})
+	release := make(chan struct{})
+	go m.Range(func(string, *int) bool {
+		close(inRange)
+		<-release
+		return true
+	})
+	<-inRange
+
+	old, _ := m.Delete("k")
+	var cleaned atomic.Bool
+	m.Defer(func() { *old = 0; cleaned.Store(true) })
+
+	done := make(chan struct{})
+	go func() { m.Synchronize(); close(done) }()
+
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("Synchronize returned while a reader was active")
+	default:
+	}
+	close(release)
+	<-done
+	if !cleaned.Load() {
+		t.Fatal("deferred callback did not run")
+	}
+}
+
+func TestRCUMapWriteInRangeDuringSynchronize(t *testing.T) {
+	m := NewRCUMap[string, int]()
+	m.Store("a", 1)
+
+	done := make(chan struct{})
+	wrote := make(chan struct{})
+	m.Range(func(string, int) bool {
+		go func() { m.Synchronize(); close(done) }()
+		time.Sleep(10 * time.Millisecond) // let Synchronize start waiting on us
+		go func() {
+			m.Store("b", 2)
+			m.Defer(func() {})
+			close(wrote)
+		}()
+		select {
+		case <-wrote:
+		case <-time.After(time.Second):
+			t.Fatal("Store inside Range blocked behind Synchronize")
+		}
+		return false
+	})
+	<-done
+	if v, ok := m.Load("b"); !ok || v != 2 {
+		t.Fatalf("Load(b) = %d, %v", v, ok)
+	}
+}
+
+func TestRCUMapConcurrent(t *testing.T) {
+	m := NewRCUMap[int, int]()
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				m.Store(w*1000+i, i)
+				m.Load(i)
+				if i%50 == 0 {
+					m.Synchronize()
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if m.Len() != 800 {
+		t.Fatalf("Len = %d, want 800", m.Len())
+	}
+}
@@ -0,0 +1,105 @@
+// Package readmostly holds read-mostly building blocks that sit next to the
+// atomic.Value snapshots in atomic/004_value_config.go: a sequence lock for
+// small value types and an RCU-style copy-on-write map.
+package readmostly
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// maxSeqWords caps the payload at 128 bytes so reads can copy through a
+// stack buffer instead of allocating.
+const maxSeqWords = 16
+
+// SeqLock publishes a small value type to many readers without making
+// readers write shared memory. Writers bump the sequence to an odd number,
+// store the value, then bump it back to even; readers retry whenever the
+// sequence was odd or changed while they copied.
+//
+// The value is stored as atomic words so the race detector stays quiet, which
+// is why T must be at most 128 bytes and must not contain pointers (the GC
+// cannot see pointers hidden inside uint64 words).
+type SeqLock[T any] struct {
+	mu    sync.Mutex // serializes writers
+	seq   atomic.Uint64
+	words [maxSeqWords]atomic.Uint64
+	n     int // words actually used by T
+}
+
+// NewSeqLock returns a SeqLock holding v. It panics if T is too large or
+// contains pointers.
+func NewSeqLock[T any](v T) *SeqLock[T] {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	size := typ.Size()
+	if size > maxSeqWords*8 {
+		panic(fmt.Sprintf("readmostly: %v is %d bytes; SeqLock supports at most %d", typ, size, maxSeqWords*8))
+	}
+	if hasPointers(typ) {
+		panic(fmt.Sprintf("readmostly: %v contains pointers; use atomic.Pointer instead", typ))
+	}
+	s := &SeqLock[T]{n: int((size + 7) / 8)}
+	s.Store(v)
+	return s
+}
+
+// Load returns a consistent copy of the current value.
+func (s *SeqLock[T]) Load() T {
+	var buf [maxSeqWords]uint64
+	for spins := 0; ; spins++ {
+		before := s.seq.Load()
+		if before&1 == 0 {
+			for i := 0; i < s.n; i++ {
+				buf[i] = s.words[i].Load()
+			}
+			if s.seq.Load() == before {
+				return *(*T)(unsafe.Pointer(&buf[0]))
+			}
+		}
+		if spins > 64 {
+			runtime.Gosched() // writer is slow or preempted; stop burning CPU
+		}
+	}
+}
+
+// Store publishes v. Concurrent writers are serialized.
+func (s *SeqLock[T]) Store(v T) {
+	var buf [maxSeqWords]uint64
+	*(*T)(unsafe.Pointer(&buf[0])) = v
+
+	s.mu.Lock()
+	s.seq.Add(1) // odd: write in progress
+	for i := 0; i < s.n; i++ {
+		s.words[i].Store(buf[i])
+	}
+	s.seq.Add(1) // even: stable
+	s.mu.Unlock()
+}
+
+// Seq returns the current sequence number. It is even when no write is in
+// progress and increases by two per Store.
+func (s *SeqLock[T]) Seq() uint64 { return s.seq.Load() }
+
+func hasPointers(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return false
+	case reflect.Array:
+		return t.Len() > 0 && hasPointers(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if hasPointers(t.Field(i).Type) {
+				return true
+			}
+		}
+		return false
+	default: // pointers, strings, slices, maps, chans, funcs, interfaces, uintptr
+		return true
+	}
+}
@@ -0,0 +1,125 @@
+package tagged
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultScanThreshold is how many retired nodes a Guard collects before it
+// scans the hazard slots and frees what nobody protects.
+const DefaultScanThreshold = 64
+
+// Domain hands out hazard-pointer Guards for nodes of type T and decides when
+// a retired node may be handed to the free function (typically a pool Put).
+//
+// Go's GC already prevents use-after-free, so hazard pointers here guard
+// reuse rather than memory: a node goes back to the pool only once no
+// goroutine is still looking at it.
+type Domain[T any] struct {
+	free      func(*T)
+	threshold int
+
+	mu     sync.Mutex                  // serializes growth of guards
+	guards atomic.Pointer[[]*Guard[T]] // copy-on-write; scanned lock-free
+}
+
+// NewDomain returns a Domain that calls free for each node that is safe to
+// reuse. scanThreshold <= 0 selects DefaultScanThreshold.
+func NewDomain[T any](free func(*T), scanThreshold int) *Domain[T] {
+	if scanThreshold <= 0 {
+		scanThreshold = DefaultScanThreshold
+	}
+	return &Domain[T]{free: free, threshold: scanThreshold}
+}
+
+// Guard owns one hazard slot. A Guard must only be used by one goroutine at a
+// time; get one with Acquire and give it back with Release.
+type Guard[T any] struct {
+	d       *Domain[T]
+	hazard  atomic.Pointer[T]
+	inUse   atomic.Bool
+	retired []*T
+}
+
+// Acquire returns an idle Guard, creating one if all are busy.
+func (d *Domain[T]) Acquire() *Guard[T] {
+	if gs := d.guards.Load(); gs != nil {
+		for _, g := range *gs {
+			if !g.inUse.Load() && g.inUse.CompareAndSwap(false, true) {
+				return g
+			}
+		}
+	}
+	g := &Guard[T]{d: d}
+	g.inUse.Store(true)
+	d.mu.Lock()
+	var next []*Guard[T]
+	if gs := d.guards.Load(); gs != nil {
+		next = append(next, *gs...)
+	}
+	next = append(next, g)
+	d.guards.Store(&next)
+	d.mu.Unlock()
+	return g
+}
+
+// Protect publishes the pointer returned by load as hazardous and re-checks
+// that it is still current, retrying until both reads agree. After Protect
+// returns p, p will not be freed until Clear or another Protect.
+func (g *Guard[T]) Protect(load func() *T) *T {
+	for {
+		p := load()
+		g.hazard.Store(p)
+		if load() == p {
+			return p
+		}
+	}
+}
+
+// Clear drops the protection set by Protect.
+func (g *Guard[T]) Clear() { g.hazard.Store(nil) }
+
+// Retire schedules p to be freed once no Guard protects it. The caller must
+// already have unlinked p so no new reader can find it.
+func (g *Guard[T]) Retire(p *T) {
+	g.retired = append(g.retired, p)
+	if len(g.retired) >= g.d.threshold {
+		g.Scan()
+	}
+}
+
+// Scan frees every retired node that is not currently protected and returns
+// how many were freed.
+func (g *Guard[T]) Scan() int {
+	protected := make(map[*T]struct{})
+	if gs := g.d.guards.Load(); gs != nil {
+		for _, other := range *gs {
+			if p := other.hazard.Load(); p != nil {
+				protected[p] = struct{}{}
+			}
+		}
+	}
+	kept := g.retired[:0]
+	freed := 0
+	for _, p := range g.retired {
+		if _, busy := protected[p]; busy {
+			kept = append(kept, p)
+			continue
+		}
+		if g.d.free != nil {
+			g.d.free(p)
+		}
+		freed++
+	}
+	clear(g.retired[len(kept):])
+	g.retired = kept
+	return freed
+}
+
+// Release clears the hazard slot and returns the Guard to the Domain. Nodes
+// still waiting to be freed stay with the Guard and are scanned by its next
+// user.
+func (g *Guard[T]) Release() {
+	g.Clear()
+	g.inUse.Store(false)
+}
@@ -0,0 +1,78 @@
+package tagged
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Stack is a lock-free Treiber stack whose nodes are recycled through a
+// sync.Pool. The head is a Tagged pointer, so a node that is popped, reused
+// and pushed again between another goroutine's read and CAS cannot fool that
+// CAS; hazard pointers keep a node out of the pool while a popper still reads
+// its next field.
+type Stack[T any] struct {
+	head Tagged[stackNode[T]]
+	pool sync.Pool
+	hp   *Domain[stackNode[T]]
+	size atomic.Int64
+}
+
+type stackNode[T any] struct {
+	val  T
+	next atomic.Pointer[stackNode[T]]
+}
+
+// NewStack returns an empty stack.
+func NewStack[T any]() *Stack[T] {
+	s := &Stack[T]{}
+	s.pool.New = func() any { return new(stackNode[T]) }
+	s.hp = NewDomain(func(n *stackNode[T]) {
+		var zero T
+		n.val = zero
+		n.next.Store(nil)
+		s.pool.Put(n)
+	}, 0)
+	return s
+}
+
+// Push adds v on top of the stack.
+func (s *Stack[T]) Push(v T) {
+	n := s.pool.Get().(*stackNode[T])
+	n.val = v
+	for {
+		top, ver := s.head.Load()
+		n.next.Store(top)
+		if s.head.CompareAndSwap(top, ver, n) {
+			s.size.Add(1)
+			return
+		}
+	}
+}
+
+// Pop removes and returns the top value. ok is false if the stack is empty.
+func (s *Stack[T]) Pop() (v T, ok bool) {
+	g := s.hp.Acquire()
+	defer g.Release()
+	for {
+		var ver uint64
+		top := g.Protect(func() *stackNode[T] {
+			p, pv := s.head.Load()
+			ver = pv
+			return p
+		})
+		if top == nil {
+			return v, false
+		}
+		next := top.next.Load()
+		if s.head.CompareAndSwap(top, ver, next) {
+			v = top.val
+			g.Clear()
+			g.Retire(top)
+			s.size.Add(-1)
+			return v, true
+		}
+	}
+}
+
+// Len returns the number of elements. It may lag concurrent Push/Pop.
+func (s *Stack[T]) Len() int { return int(s.size.Load()) }
@@ -0,0 +1,66 @@
+// Package tagged provides a version-tagged atomic pointer and hazard-pointer
+// reclamation so lock-free structures can recycle nodes without ABA.
+//
+// atomic/007_aba_versioned_pointer.go keeps the pointer and the version in two
+// separate atomics, so another goroutine can run between the pointer CAS and
+// the version bump. Tagged keeps both in one immutable record and swaps the
+// record, which makes "pointer and version changed together" a single step.
+package tagged
+
+import "sync/atomic"
+
+// record is never mutated after publication; a new one is allocated per
+// successful CAS. Because the GC never reuses a record's address while we
+// still hold it, CAS on the record itself cannot suffer ABA.
+type record[T any] struct {
+	ptr *T
+	ver uint64
+}
+
+// Tagged is a *T paired with a version that increases on every successful
+// Store or CompareAndSwap. The zero value holds (nil, 0).
+type Tagged[T any] struct {
+	rec atomic.Pointer[record[T]]
+}
+
+// Load returns the pointer and the version it was published with, read from
+// the same record.
+func (t *Tagged[T]) Load() (*T, uint64) {
+	r := t.rec.Load()
+	if r == nil {
+		return nil, 0
+	}
+	return r.ptr, r.ver
+}
+
+// Store publishes p unconditionally and bumps the version.
+func (t *Tagged[T]) Store(p *T) {
+	for {
+		old := t.rec.Load()
+		if t.rec.CompareAndSwap(old, &record[T]{ptr: p, ver: verOf(old) + 1}) {
+			return
+		}
+	}
+}
+
+// CompareAndSwap replaces (oldPtr, oldVer) with (newPtr, oldVer+1). It fails
+// if either the pointer or the version differs, so a pointer that was removed
+// and later reinserted (A -> B -> A) is detected.
+func (t *Tagged[T]) CompareAndSwap(oldPtr *T, oldVer uint64, newPtr *T) bool {
+	cur := t.rec.Load()
+	var curPtr *T
+	if cur != nil {
+		curPtr = cur.ptr
+	}
+	if curPtr != oldPtr || verOf(cur) != oldVer {
+		return false
+	}
+	return t.rec.CompareAndSwap(cur, &record[T]{ptr: newPtr, ver: oldVer + 1})
+}
+
+func verOf[T any](r *record[T]) uint64 {
+	if r == nil {
+		return 0
+	}
+	return r.ver
+}
@@ -0,0 +1,246 @@
+package tagged
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// node and freeList back two tiny stacks used to replay the classic ABA
+// interleaving step by step. The free list is FIFO so the test controls
+// exactly which node gets reused.
+type node struct {
+	val  int
+	next atomic.Pointer[node]
+}
+
+type freeList struct{ nodes []*node }
+
+func (f *freeList) get(v int) *node {
+	if len(f.nodes) == 0 {
+		return &node{val: v}
+	}
+	n := f.nodes[0]
+	f.nodes = f.nodes[1:]
+	n.val = v
+	return n
+}
+
+func (f *freeList) put(n *node) { f.nodes = append(f.nodes, n) }
+
+// naiveStack CASes a bare atomic.Pointer, the same as 007's versioned.CAS
+// effectively does since its version is not part of the comparison.
+type naiveStack struct {
+	head atomic.Pointer[node]
+	free freeList
+}
+
+func (s *naiveStack) push(v int) {
+	n := s.free.get(v)
+	for {
+		top := s.head.Load()
+		n.next.Store(top)
+		if s.head.CompareAndSwap(top, n) {
+			return
+		}
+	}
+}
+
+// pop runs beforeCAS between reading top.next and the CAS, which is where
+// another goroutine can sneak in.
+func (s *naiveStack) pop(beforeCAS func()) (int, bool) {
+	for {
+		top := s.head.Load()
+		if top == nil {
+			return 0, false
+		}
+		next := top.next.Load()
+		if beforeCAS != nil {
+			beforeCAS()
+			beforeCAS = nil
+		}
+		if s.head.CompareAndSwap(top, next) {
+			v := top.val
+			s.free.put(top)
+			return v, true
+		}
+	}
+}
+
+type taggedStack struct {
+	head Tagged[node]
+	free freeList
+}
+
+func (s *taggedStack) push(v int) {
+	n := s.free.get(v)
+	for {
+		top, ver := s.head.Load()
+		n.next.Store(top)
+		if s.head.CompareAndSwap(top, ver, n) {
+			return
+		}
+	}
+}
+
+func (s *taggedStack) pop(beforeCAS func()) (int, bool) {
+	for {
+		top, ver := s.head.Load()
+		if top == nil {
+			return 0, false
+		}
+		next := top.next.Load()
+		if beforeCAS != nil {
+			beforeCAS()
+			beforeCAS = nil
+		}
+		if s.head.CompareAndSwap(top, ver, next) {
+			v := top.val
+			s.free.put(top)
+			return v, true
+		}
+	}
+}
+
+type abaStack interface {
+	push(int)
+	pop(func()) (int, bool)
+}
+
+// replayABA: stack is A(1) -> B(2) -> C(3). A popper reads top=A, next=B and
+// stalls. Meanwhile A and B are popped and a new value is pushed on the
+// recycled A. The popper then CASes head from A to the stale B.
+func replayABA(s abaStack) (popped []int) {
+	s.push(3)
+	s.push(2)
+	s.push(1)
+	v, _ := s.pop(func() {
+		a, _ := s.pop(nil)
+		b, _ := s.pop(nil)
+		s.push(7) // reuses node A
+		popped = append(popped, a, b)
+	})
+	popped = append(popped, v)
+	for {
+		v, ok := s.pop(nil)
+		if !ok {
+			return popped
+		}
+		popped = append(popped, v)
+	}
+}
+
+func TestNaiveCASSuffersABA(t *testing.T) {
+	got := replayABA(&naiveStack{})
+	seen := map[int]int{}
+	for _, v := range got {
+		seen[v]++
+	}
+	// B's value resurfaces from the free list and is popped twice.
+	if seen[2] < 2 {
+		t.Fatalf("expected ABA to resurrect value 2, popped %v", got)
+	}
+}
+
+func TestTaggedCASPreventsABA(t *testing.T) {
+	got := replayABA(&taggedStack{})
+	want := []int{1, 2, 7, 3}
+	if len(got) != len(want) {
+		t.Fatalf("popped %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("popped %v, want %v", got, want)
+		}
+	}
+}
+
+func TestTaggedVersionBumps(t *testing.T) {
+	var tp Tagged[int]
+	a := new(int)
+	if p, v := tp.Load(); p != nil || v != 0 {
+		t.Fatalf("zero value = %v,%d", p, v)
+	}
+	tp.Store(a)
+	_, v1 := tp.Load()
+	if !tp.CompareAndSwap(a, v1, nil) || !tp.CompareAndSwap(nil, v1+1, a) {
+		t.Fatal("CAS with current version failed")
+	}
+	if tp.CompareAndSwap(a, v1, nil) {
+		t.Fatal("CAS with stale version succeeded for the same pointer")
+	}
+}
+
+func TestHazardBlocksReuse(t *testing.T) {
+	var freed []*int
+	d := NewDomain(func(p *int) { freed = append(freed, p) }, 1000)
+	var src atomic.Pointer[int]
+	x := new(int)
+	src.Store(x)
+
+	reader := d.Acquire()
+	if reader.Protect(src.Load) != x {
+		t.Fatal("Protect returned a different pointer")
+	}
+	writer := d.Acquire()
+	src.Store(nil)
+	writer.Retire(x)
+	if n := writer.Scan(); n != 0 {
+		t.Fatalf("freed %d nodes while protected", n)
+	}
+	reader.Release()
+	if n := writer.Scan(); n != 1 || freed[0] != x {
+		t.Fatalf("freed %d after release, want 1", n)
+	}
+	writer.Release()
+	if g := d.Acquire(); g != reader && g != writer {
+		t.Fatal("Acquire did not reuse an idle guard")
+	}
+}
+
+// Every pushed value must be popped exactly once while nodes are recycled
+// through the pool at full speed.
+func TestStackStress(t *testing.T) {
+	const workers, perWorker = 8, 5000
+	s := NewStack[int]()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	seen := make(map[int]int, workers*perWorker)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			local := make([]int, 0, perWorker)
+			for i := 0; i < perWorker; i++ {
+				s.Push(w*perWorker + i)
+				if v, ok := s.Pop(); ok {
+					local = append(local, v)
+				}
+			}
+			mu.Lock()
+			for _, v := range local {
+				seen[v]++
+			}
+			mu.Unlock()
+		}(w)
+	}
+	wg.Wait()
+	for {
+		v, ok := s.Pop()
+		if !ok {
+			break
+		}
+		seen[v]++
+	}
+	if len(seen) != workers*perWorker {
+		t.Fatalf("saw %d distinct values, want %d", len(seen), workers*perWorker)
+	}
+	for v, n := range seen {
+		if n != 1 {
+			t.Fatalf("value %d popped %d times", v, n)
+		}
+	}
+	if s.Len() != 0 {
+		t.Fatalf("Len = %d after draining", s.Len())
+	}
+}
@@ -0,0 +1,76 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"gobyexamples/channels/pubsub"
+)
+
+// Run with: go test -bench=FanOut -benchmem ./channels/bench
+//
+// Cost of one Publish fanned out to 1, 100 and 10k subscribers, each drained
+// by its own goroutine, against a hand-written loop over plain channels.
+
+var fanOut = []int{1, 100, 10_000}
+
+func BenchmarkFanOutBus(b *testing.B) {
+	for _, n := range fanOut {
+		b.Run(fmt.Sprintf("subs=%d", n), func(b *testing.B) {
+			bus := pubsub.NewBus()
+			topic := pubsub.NewTopic[int](bus, "bench.events")
+			var wg sync.WaitGroup
+			for i := 0; i < n; i++ {
+				s, err := topic.Subscribe(pubsub.SubOptions{Buffer: 256, Policy: pubsub.Block})
+				if err != nil {
+					b.Fatal(err)
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for range s.C() {
+					}
+				}()
+			}
+			ctx := context.Background()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				topic.Publish(ctx, i)
+			}
+			b.StopTimer()
+			bus.Close()
+			wg.Wait()
+		})
+	}
+}
+
+func BenchmarkFanOutChannels(b *testing.B) {
+	for _, n := range fanOut {
+		b.Run(fmt.Sprintf("subs=%d", n), func(b *testing.B) {
+			chans := make([]chan int, n)
+			var wg sync.WaitGroup
+			for i := range chans {
+				chans[i] = make(chan int, 256)
+				wg.Add(1)
+				go func(ch chan int) {
+					defer wg.Done()
+					for range ch {
+					}
+				}(chans[i])
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, ch := range chans {
+					ch <- i
+				}
+			}
+			b.StopTimer()
+			for _, ch := range chans {
+				close(ch)
+			}
+			wg.Wait()
+		})
+	}
+}
@@ -0,0 +1,142 @@
+// Package chanx collects the channel patterns from the numbered examples as
+// reusable generic functions.
+//
+// Every function that starts a goroutine takes a context and returns a
+// channel that is closed when the input is exhausted or ctx is done, so
+// callers can always make the goroutine exit by cancelling. Functions that
+// measure time take a clock.Clock; nil means real time.
+package chanx
+
+import (
+	"context"
+
+	"gobyexamples/goroutine/clock"
+)
+
+func orReal(c clock.Clock) clock.Clock {
+	if c == nil {
+		return clock.RealClock{}
+	}
+	return c
+}
+
+// send delivers v on out unless ctx ends first.
+func send[T any](ctx context.Context, out chan<- T, v T) bool {
+	select {
+	case out <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// OrDone ranges over in until it closes or ctx is done, so a consumer can
+// write `for v := range OrDone(ctx, in)` without its own select.
+func OrDone[T any](ctx context.Context, in <-chan T) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-in:
+				if !ok || !send(ctx, out, v) {
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// Bridge flattens a channel of channels (the shape of 016_channel.go's
+// chan chan) into one stream, draining each inner channel in turn.
+func Bridge[T any](ctx context.Context, chans <-chan <-chan T) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for {
+			var in <-chan T
+			select {
+			case <-ctx.Done():
+				return
+			case c, ok := <-chans:
+				if !ok {
+					return
+				}
+				in = c
+			}
+			for v := range OrDone(ctx, in) {
+				if !send(ctx, out, v) {
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// Tee copies every value from in to both outputs. Each value is delivered
+// to both before the next is read, so the slower reader paces the other.
+func Tee[T any](ctx context.Context, in <-chan T) (<-chan T, <-chan T) {
+	out1, out2 := make(chan T), make(chan T)
+	go func() {
+		defer close(out1)
+		defer close(out2)
+		for v := range OrDone(ctx, in) {
+			a, b := out1, out2
+			for a != nil || b != nil {
+				select {
+				case <-ctx.Done():
+					return
+				case a <- v:
+					a = nil
+				case b <- v:
+					b = nil
+				}
+			}
+		}
+	}()
+	return out1, out2
+}
+
+// Take forwards the first n values of in, then closes.
+func Take[T any](ctx context.Context, in <-chan T, n int) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for i := 0; i < n; i++ {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-in:
+				if !ok || !send(ctx, out, v) {
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// TrySend sends v if ch has room or a receiver waiting, without blocking.
+func TrySend[T any](ch chan<- T, v T) bool {
+	select {
+	case ch <- v:
+		return true
+	default:
+		return false
+	}
+}
+
+// TryRecv receives from ch without blocking. ok is false when nothing was
+// ready or ch is closed; open tells the two apart.
+func TryRecv[T any](ch <-chan T) (v T, ok, open bool) {
+	select {
+	case v, open = <-ch:
+		return v, open, open
+	default:
+		return v, false, true
+	}
+}
@@ -0,0 +1,293 @@
+package chanx
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"gobyexamples/goroutine/clock"
+	"gobyexamples/goroutine/leakcheck"
+)
+
+var bg = context.Background()
+
+func gen(vals ...int) <-chan int {
+	ch := make(chan int, len(vals))
+	for _, v := range vals {
+		ch <- v
+	}
+	close(ch)
+	return ch
+}
+
+func collect[T any](ch <-chan T) []T {
+	var out []T
+	for v := range ch {
+		out = append(out, v)
+	}
+	return out
+}
+
+func TestOrDone(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	if got := collect(OrDone(bg, gen(1, 2, 3))); !slices.Equal(got, []int{1, 2, 3}) {
+		t.Fatalf("got %v", got)
+	}
+
+	ctx, cancel := context.WithCancel(bg)
+	never := make(chan int) // never closed
+	out := OrDone(ctx, never)
+	cancel()
+	if _, ok := <-out; ok {
+		t.Fatal("value after cancel")
+	}
+}
+
+func TestBridge(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	chans := make(chan (<-chan int), 3)
+	chans <- gen(1, 2)
+	chans <- gen()
+	chans <- gen(3)
+	close(chans)
+	if got := collect(Bridge(bg, chans)); !slices.Equal(got, []int{1, 2, 3}) {
+		t.Fatalf("got %v", got)
+	}
+
+	// Cancel while blocked inside an inner channel.
+	ctx, cancel := context.WithCancel(bg)
+	open := make(chan (<-chan int), 1)
+	open <- make(chan int)
+	out := Bridge(ctx, open)
+	cancel()
+	if _, ok := <-out; ok {
+		t.Fatal("value after cancel")
+	}
+}
+
+func TestTee(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	a, b := Tee(bg, gen(1, 2, 3))
+	done := make(chan []int)
+	go func() { done <- collect(b) }()
+	if got := collect(a); !slices.Equal(got, []int{1, 2, 3}) {
+		t.Fatalf("a got %v", got)
+	}
+	if got := <-done; !slices.Equal(got, []int{1, 2, 3}) {
+		t.Fatalf("b got %v", got)
+	}
+
+	// A stalled reader on one side does not strand the goroutine on cancel.
+	ctx, cancel := context.WithCancel(bg)
+	a, _ = Tee(ctx, gen(1, 2, 3))
+	<-a
+	cancel()
+	for range a {
+	}
+}
+
+func TestTake(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	if got := collect(Take(bg, gen(1, 2, 3, 4), 2)); !slices.Equal(got, []int{1, 2}) {
+		t.Fatalf("got %v", got)
+	}
+	if got := collect(Take(bg, gen(1), 5)); !slices.Equal(got, []int{1}) {
+		t.Fatalf("short input: %v", got)
+	}
+}
+
+func TestTrySendRecv(t *testing.T) {
+	ch := make(chan int, 1)
+	if _, ok, open := TryRecv(ch); ok || !open {
+		t.Fatal("TryRecv on empty channel")
+	}
+	if !TrySend(ch, 1) || TrySend(ch, 2) {
+		t.Fatal("TrySend ignored capacity")
+	}
+	if v, ok, _ := TryRecv(ch); !ok || v != 1 {
+		t.Fatalf("TryRecv = %d, %v", v, ok)
+	}
+	close(ch)
+	if _, ok, open := TryRecv(ch); ok || open {
+		t.Fatal("TryRecv on closed channel")
+	}
+}
+
+func TestDebounce(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("quiet period", func(t *testing.T) {
+		clk := clock.NewFake(start)
+		in := make(chan int)
+		out := Debounce(bg, in, 100*time.Millisecond, clk)
+		in <- 1
+		clk.BlockUntil(1)
+		clk.Advance(99 * time.Millisecond)
+		if _, ok, _ := TryRecv(out); ok {
+			t.Fatal("emitted before the quiet period")
+		}
+		clk.Advance(time.Millisecond)
+		if v := <-out; v != 1 || clk.Since(start) != 100*time.Millisecond {
+			t.Fatalf("got %d at %v", v, clk.Since(start))
+		}
+		close(in)
+		if _, ok := <-out; ok {
+			t.Fatal("extra value")
+		}
+	})
+
+	t.Run("burst keeps latest", func(t *testing.T) {
+		clk := clock.NewFake(start)
+		in := make(chan int)
+		out := Debounce(bg, in, 100*time.Millisecond, clk)
+		for i := 1; i <= 5; i++ {
+			in <- i
+		}
+		// The last value's timer reset is not observable, so step the
+		// clock until the debounced value appears.
+		var got int
+	wait:
+		for {
+			clk.Advance(50 * time.Millisecond)
+			select {
+			case got = <-out:
+				break wait
+			case <-time.After(time.Millisecond):
+			}
+		}
+		if got != 5 {
+			t.Fatalf("got %d, want the latest value 5", got)
+		}
+		close(in)
+		if rest := collect(out); len(rest) != 0 {
+			t.Fatalf("burst emitted extra values %v", rest)
+		}
+	})
+
+	t.Run("flush on close", func(t *testing.T) {
+		in := make(chan int)
+		out := Debounce(bg, in, time.Hour, clock.NewFake(start))
+		in <- 1
+		in <- 2
+		close(in)
+		if got := collect(out); !slices.Equal(got, []int{2}) {
+			t.Fatalf("got %v", got)
+		}
+	})
+}
+
+func TestThrottle(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	// Advance only while Throttle is idle (after its output was received):
+	// a value just sent may still be about to read the clock.
+	clk := clock.NewFake(time.Time{})
+	in := make(chan int)
+	out := Throttle(bg, in, 100*time.Millisecond, clk)
+	in <- 1
+	if v := <-out; v != 1 {
+		t.Fatalf("first value %d", v)
+	}
+	clk.Advance(100 * time.Millisecond)
+	in <- 2
+	if v := <-out; v != 2 {
+		t.Fatalf("value after the window: %d", v)
+	}
+	clk.Advance(99 * time.Millisecond)
+	in <- 3 // inside the window: dropped
+	in <- 4
+	close(in)
+	if rest := collect(out); len(rest) != 0 {
+		t.Fatalf("throttled values leaked through: %v", rest)
+	}
+}
+
+func TestBatchByCountOrTime(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	clk := clock.NewFake(time.Time{})
+	in := make(chan int)
+	out := BatchByCountOrTime(bg, in, 3, time.Second, clk)
+
+	go func() {
+		for i := 1; i <= 3; i++ {
+			in <- i
+		}
+	}()
+	if b := <-out; fmt.Sprint(b) != "[1 2 3]" {
+		t.Fatalf("count batch = %v", b)
+	}
+
+	in <- 4
+	in <- 5
+	clk.BlockUntil(1) // timer armed by 4
+	clk.Advance(time.Second)
+	if b := <-out; fmt.Sprint(b) != "[4 5]" {
+		t.Fatalf("time batch = %v", b)
+	}
+
+	in <- 6
+	close(in)
+	if rest := collect(out); fmt.Sprint(rest) != "[[6]]" {
+		t.Fatalf("final batch = %v", rest)
+	}
+}
+
+func TestUnbounded(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	in, out := Unbounded(bg, UnboundedOptions[int]{})
+	for i := 0; i < 5000; i++ {
+		in <- i // never blocks on a slow reader
+	}
+	close(in)
+	got := collect(out)
+	if len(got) != 5000 || got[0] != 0 || got[4999] != 4999 || !slices.IsSorted(got) {
+		t.Fatalf("got %d values, order preserved=%v", len(got), slices.IsSorted(got))
+	}
+
+	// With a cap, the fourth send waits for the reader.
+	in, out = Unbounded(bg, UnboundedOptions[int]{MaxItems: 3})
+	for i := 0; i < 3; i++ {
+		in <- i
+	}
+	select {
+	case in <- 3:
+		t.Fatal("send beyond cap did not block")
+	case <-time.After(10 * time.Millisecond):
+	}
+	<-out
+	in <- 3
+	close(in)
+	if rest := collect(out); !slices.Equal(rest, []int{1, 2, 3}) {
+		t.Fatalf("rest = %v", rest)
+	}
+
+	// A byte budget blocks once the queued sizes reach it, but a value
+	// bigger than the budget still passes when the queue is empty.
+	bin, bout := Unbounded(bg, UnboundedOptions[string]{MaxBytes: 8, Size: func(s string) int { return len(s) }})
+	bin <- "aaaa"
+	bin <- "bbbb"
+	select {
+	case bin <- "c":
+		t.Fatal("send beyond byte budget did not block")
+	case <-time.After(10 * time.Millisecond):
+	}
+	<-bout
+	bin <- "c"
+	<-bout
+	<-bout
+	bin <- "a value over the whole budget"
+	close(bin)
+	if rest := collect(bout); !slices.Equal(rest, []string{"a value over the whole budget"}) {
+		t.Fatalf("rest = %v", rest)
+	}
+
+	// Cancel drops the queue and closes out.
+	ctx, cancel := context.WithCancel(bg)
+	in, out = Unbounded(ctx, UnboundedOptions[int]{})
+	in <- 1
+	cancel()
+	for range out {
+	}
+}
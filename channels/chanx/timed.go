@@ -0,0 +1,145 @@
+package chanx
+
+import (
+	"context"
+	"time"
+
+	"gobyexamples/goroutine/clock"
+)
+
+// Debounce emits the latest value once in has been quiet for d. A pending
+// value is flushed when in closes.
+func Debounce[T any](ctx context.Context, in <-chan T, d time.Duration, clk clock.Clock) <-chan T {
+	clk = orReal(clk)
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		var (
+			latest  T
+			pending bool
+			timer   clock.Timer
+			fire    <-chan time.Time
+		)
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-in:
+				if !ok {
+					if pending {
+						send(ctx, out, latest)
+					}
+					return
+				}
+				latest, pending = v, true
+				if timer == nil {
+					timer = clk.NewTimer(d)
+				} else {
+					timer.Reset(d)
+				}
+				fire = timer.C()
+			case <-fire:
+				fire, pending = nil, false
+				if !send(ctx, out, latest) {
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// Throttle emits at most one value per d: the first value passes at once
+// and values arriving in the following d are dropped.
+func Throttle[T any](ctx context.Context, in <-chan T, d time.Duration, clk clock.Clock) <-chan T {
+	clk = orReal(clk)
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		var next time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+				now := clk.Now()
+				if now.Before(next) {
+					continue
+				}
+				next = now.Add(d)
+				if !send(ctx, out, v) {
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// BatchByCountOrTime groups values into slices of up to n, emitting a
+// partial batch when maxWait has passed since its first value. The last
+// partial batch is flushed when in closes.
+func BatchByCountOrTime[T any](ctx context.Context, in <-chan T, n int, maxWait time.Duration, clk clock.Clock) <-chan []T {
+	clk = orReal(clk)
+	out := make(chan []T)
+	go func() {
+		defer close(out)
+		var (
+			batch []T
+			timer clock.Timer
+			fire  <-chan time.Time
+		)
+		flush := func() bool {
+			if timer != nil {
+				timer.Stop()
+			}
+			fire = nil
+			b := batch
+			batch = nil
+			return send(ctx, out, b)
+		}
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-in:
+				if !ok {
+					if len(batch) > 0 {
+						flush()
+					}
+					return
+				}
+				batch = append(batch, v)
+				if len(batch) == 1 {
+					if timer == nil {
+						timer = clk.NewTimer(maxWait)
+					} else {
+						timer.Reset(maxWait)
+					}
+					fire = timer.C()
+				}
+				if len(batch) >= n && !flush() {
+					return
+				}
+			case <-fire:
+				if !flush() {
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
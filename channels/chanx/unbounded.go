@@ -0,0 +1,90 @@
+package chanx
+
+import "context"
+
+// UnboundedOptions caps the buffer of Unbounded. The zero value means no
+// cap, which trades the safety of a bounded channel for memory that grows
+// with the slowest reader.
+type UnboundedOptions[T any] struct {
+	// MaxItems > 0 blocks sends once that many values are queued.
+	MaxItems int
+	// MaxBytes > 0 blocks sends once the queued values add up to that many
+	// bytes, as measured by Size. A value is admitted whenever the queue is
+	// below the budget, so the queue can go over it by one value; a value
+	// larger than MaxBytes still passes, alone.
+	MaxBytes int
+	// Size reports the memory a value holds, e.g. len for []byte or
+	// string. Required with MaxBytes.
+	Size func(T) int
+}
+
+// Unbounded returns a channel pair with an elastic buffer between them:
+// sends on in never block until the buffer reaches a cap in opts, and then
+// block (backpressure) instead of growing further.
+//
+// Close in to finish: queued values are still delivered, then out closes.
+// Cancelling ctx drops whatever is queued, and from then on nothing
+// receives from in, so a producer blocked sending would leak. Producers
+// must select on ctx.Done() alongside every send:
+//
+//	select {
+//	case in <- v:
+//	case <-ctx.Done():
+//		return ctx.Err()
+//	}
+func Unbounded[T any](ctx context.Context, opts UnboundedOptions[T]) (chan<- T, <-chan T) {
+	if opts.MaxBytes > 0 && opts.Size == nil {
+		panic("chanx: Unbounded with MaxBytes needs a Size func")
+	}
+	type entry struct {
+		v    T
+		size int
+	}
+	in, out := make(chan T), make(chan T)
+	go func() {
+		defer close(out)
+		var q []entry
+		head, bytes := 0, 0
+		for {
+			recv, snd := in, out
+			var next T
+			if opts.MaxItems > 0 && len(q)-head >= opts.MaxItems ||
+				opts.MaxBytes > 0 && bytes >= opts.MaxBytes {
+				recv = nil // full: stop accepting
+			}
+			if head == len(q) {
+				snd = nil // empty: nothing to send
+				if in == nil {
+					return
+				}
+			} else {
+				next = q[head].v
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-recv:
+				if !ok {
+					in = nil
+					continue
+				}
+				e := entry{v: v}
+				if opts.Size != nil {
+					e.size = opts.Size(v)
+				}
+				q = append(q, e)
+				bytes += e.size
+			case snd <- next:
+				bytes -= q[head].size
+				q[head] = entry{} // let it be collected
+				head++
+				if head == len(q) {
+					q, head = q[:0], 0
+				} else if head > 1024 && head*2 > len(q) {
+					q, head = append(q[:0:0], q[head:]...), 0 // release the consumed prefix
+				}
+			}
+		}
+	}()
+	return in, out
+}
@@ -0,0 +1,43 @@
+package pubsub
+
+import (
+	"errors"
+	"strings"
+)
+
+// isPattern reports whether name contains a wildcard segment.
+func isPattern(name string) bool {
+	for _, seg := range strings.Split(name, ".") {
+		if seg == "*" || seg == ">" {
+			return true
+		}
+	}
+	return false
+}
+
+func validPattern(pattern string) error {
+	segs := strings.Split(pattern, ".")
+	for i, seg := range segs {
+		switch {
+		case seg == "":
+			return errors.New("pubsub: empty segment in pattern " + pattern)
+		case seg == ">" && i != len(segs)-1:
+			return errors.New("pubsub: '>' must be the last segment in " + pattern)
+		}
+	}
+	return nil
+}
+
+// match reports whether topic segments match a pattern's: "*" matches any
+// one segment, a trailing ">" matches one or more.
+func match(pattern, topic []string) bool {
+	for i, p := range pattern {
+		if p == ">" {
+			return len(topic) > i
+		}
+		if i >= len(topic) || (p != "*" && p != topic[i]) {
+			return false
+		}
+	}
+	return len(pattern) == len(topic)
+}
@@ -0,0 +1,331 @@
+// Package pubsub is an in-process publish/subscribe bus.
+//
+// Topics are typed: a Topic[T] only carries values of type T. Topic names
+// are dot-separated ("orders.eu.created") and subscriptions may use
+// wildcards: "*" matches one segment and a trailing ">" matches one or more.
+//
+// Each subscriber has its own buffered channel, so one slow consumer does
+// not hold up the others unless it asks to. What happens when a buffer is
+// full is the subscriber's Policy: drop the message, block the publisher for
+// up to a timeout, or disconnect the subscriber.
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrClosed is returned when publishing on a closed bus.
+	ErrClosed = errors.New("pubsub: bus closed")
+	// ErrSlowConsumer is a disconnected subscriber's Err.
+	ErrSlowConsumer = errors.New("pubsub: subscriber disconnected: buffer full")
+)
+
+// Policy is what a subscriber wants done when its buffer is full.
+type Policy int
+
+const (
+	// Drop discards the new message and counts it in Dropped.
+	Drop Policy = iota
+	// Block makes the publisher wait for room, up to Timeout (zero waits
+	// until the publish context is done), then drops.
+	Block
+	// Disconnect closes the subscription with ErrSlowConsumer.
+	Disconnect
+)
+
+// SubOptions configures a subscription. The zero value is a 64-message
+// buffer with the Drop policy.
+type SubOptions struct {
+	Buffer  int
+	Policy  Policy
+	Timeout time.Duration // for Block
+}
+
+// Message is one delivery.
+type Message[T any] struct {
+	Topic   string
+	Payload T
+	// CorrelationID is non-zero for requests made with Request; pass the
+	// message to Reply to answer it.
+	CorrelationID uint64
+}
+
+// envelope is a message before it is typed for a subscriber.
+type envelope struct {
+	topic   string
+	payload any
+	corr    uint64
+}
+
+// subscriber is the untyped side of a Subscription the bus delivers to.
+type subscriber interface {
+	deliver(ctx context.Context, e envelope) bool
+	close(err error)
+}
+
+// Bus routes published messages to matching subscriptions. The zero value
+// is not usable; call NewBus.
+type Bus struct {
+	mu sync.RWMutex
+	// exact holds subscribers by topic name. The slices are copy-on-write,
+	// so publish can use one after releasing mu.
+	exact    map[string][]subscriber
+	patterns map[subscriber][]string
+	closed   bool
+
+	nextCorr atomic.Uint64
+	pmu      sync.Mutex
+	pending  map[uint64]chan reply
+}
+
+// NewBus returns an empty bus.
+func NewBus() *Bus {
+	return &Bus{
+		exact:    make(map[string][]subscriber),
+		patterns: make(map[subscriber][]string),
+		pending:  make(map[uint64]chan reply),
+	}
+}
+
+// Close disconnects every subscriber and fails later publishes.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	var all []subscriber
+	for _, subs := range b.exact {
+		all = append(all, subs...)
+	}
+	for s := range b.patterns {
+		all = append(all, s)
+	}
+	b.exact, b.patterns = nil, nil
+	b.mu.Unlock()
+	for _, s := range all {
+		s.close(nil)
+	}
+}
+
+func (b *Bus) add(s subscriber, pattern string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return false
+	}
+	if !isPattern(pattern) {
+		b.exact[pattern] = append(slices.Clip(b.exact[pattern]), s)
+		return true
+	}
+	b.patterns[s] = strings.Split(pattern, ".")
+	return true
+}
+
+func (b *Bus) remove(s subscriber, pattern string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if subs := b.exact[pattern]; slices.Contains(subs, s) {
+		subs = slices.DeleteFunc(slices.Clone(subs), func(x subscriber) bool { return x == s })
+		if len(subs) == 0 {
+			delete(b.exact, pattern)
+		} else {
+			b.exact[pattern] = subs
+		}
+	}
+	delete(b.patterns, s)
+}
+
+// publish delivers e to every matching subscriber and returns how many
+// accepted it.
+func (b *Bus) publish(ctx context.Context, e envelope) (int, error) {
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return 0, ErrClosed
+	}
+	targets := b.exact[e.topic]
+	if len(b.patterns) > 0 {
+		targets = slices.Clip(targets)
+		segs := strings.Split(e.topic, ".")
+		for s, pat := range b.patterns {
+			if match(pat, segs) {
+				targets = append(targets, s)
+			}
+		}
+	}
+	b.mu.RUnlock()
+
+	n := 0
+	for _, s := range targets {
+		if s.deliver(ctx, e) {
+			n++
+		}
+	}
+	return n, ctx.Err()
+}
+
+// Topic is a typed handle for publishing to and subscribing on one name.
+type Topic[T any] struct {
+	bus  *Bus
+	name string
+}
+
+// NewTopic returns the topic called name on b. Names must not contain
+// wildcards.
+func NewTopic[T any](b *Bus, name string) *Topic[T] {
+	if isPattern(name) || name == "" {
+		panic("pubsub: invalid topic name " + strconv.Quote(name))
+	}
+	return &Topic[T]{bus: b, name: name}
+}
+
+// Name returns the topic name.
+func (t *Topic[T]) Name() string { return t.name }
+
+// Publish delivers v to the topic's subscribers and returns how many
+// accepted it. It only waits for subscribers using the Block policy, and
+// returns ctx.Err() if ctx ended while it did.
+func (t *Topic[T]) Publish(ctx context.Context, v T) (int, error) {
+	return t.bus.publish(ctx, envelope{topic: t.name, payload: v})
+}
+
+// Subscribe receives messages published on this topic.
+func (t *Topic[T]) Subscribe(opts SubOptions) (*Subscription[T], error) {
+	return subscribe[T](t.bus, t.name, opts)
+}
+
+// SubscribePattern receives messages from every topic matching pattern
+// whose payload is a T; others are skipped.
+func SubscribePattern[T any](b *Bus, pattern string, opts SubOptions) (*Subscription[T], error) {
+	if err := validPattern(pattern); err != nil {
+		return nil, err
+	}
+	return subscribe[T](b, pattern, opts)
+}
+
+func subscribe[T any](b *Bus, pattern string, opts SubOptions) (*Subscription[T], error) {
+	if opts.Buffer <= 0 {
+		opts.Buffer = 64
+	}
+	s := &Subscription[T]{
+		bus:     b,
+		pattern: pattern,
+		opts:    opts,
+		ch:      make(chan Message[T], opts.Buffer),
+		done:    make(chan struct{}),
+	}
+	if !b.add(s, pattern) {
+		return nil, ErrClosed
+	}
+	return s, nil
+}
+
+// Subscription is one subscriber's mailbox.
+type Subscription[T any] struct {
+	bus     *Bus
+	pattern string
+	opts    SubOptions
+	ch      chan Message[T]
+	dropped atomic.Uint64
+
+	// mu is held for reading by publishers while they send on ch and for
+	// writing by close, so ch is never closed under a sender.
+	mu     sync.RWMutex
+	done   chan struct{}
+	once   sync.Once
+	err    error
+	closed bool
+}
+
+// C returns the delivery channel. It is closed after Unsubscribe (once the
+// buffered messages have been received) or on disconnect.
+func (s *Subscription[T]) C() <-chan Message[T] { return s.ch }
+
+// Dropped reports how many messages were discarded because the buffer
+// was full.
+func (s *Subscription[T]) Dropped() uint64 { return s.dropped.Load() }
+
+// Err is ErrSlowConsumer if the subscription was disconnected, else nil.
+func (s *Subscription[T]) Err() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.err
+}
+
+// Unsubscribe stops delivery. Messages already buffered can still be read
+// from C before it reports closed.
+func (s *Subscription[T]) Unsubscribe() {
+	s.bus.remove(s, s.pattern)
+	s.close(nil)
+}
+
+func (s *Subscription[T]) close(err error) {
+	s.once.Do(func() {
+		close(s.done) // wake publishers blocked on a full buffer
+		s.mu.Lock()
+		s.err = err
+		s.closed = true
+		close(s.ch)
+		s.mu.Unlock()
+	})
+}
+
+func (s *Subscription[T]) deliver(ctx context.Context, e envelope) bool {
+	v, ok := e.payload.(T)
+	if !ok {
+		return false
+	}
+	m := Message[T]{Topic: e.topic, Payload: v, CorrelationID: e.corr}
+
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return false
+	}
+	select {
+	case s.ch <- m:
+		s.mu.RUnlock()
+		return true
+	default:
+	}
+
+	switch s.opts.Policy {
+	case Block:
+		var timeout <-chan time.Time
+		if s.opts.Timeout > 0 {
+			t := time.NewTimer(s.opts.Timeout)
+			defer t.Stop()
+			timeout = t.C
+		}
+		select {
+		case s.ch <- m:
+			s.mu.RUnlock()
+			return true
+		case <-s.done:
+		case <-timeout:
+		case <-ctx.Done():
+		}
+		s.mu.RUnlock()
+		s.dropped.Add(1)
+		return false
+	case Disconnect:
+		s.mu.RUnlock()
+		s.bus.remove(s, s.pattern)
+		s.close(ErrSlowConsumer)
+		return false
+	default:
+		s.mu.RUnlock()
+		s.dropped.Add(1)
+		return false
+	}
+}
@@ -0,0 +1,310 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gobyexamples/goroutine/leakcheck"
+)
+
+type order struct {
+	ID     int
+	Region string
+}
+
+var bg = context.Background()
+
+// drain returns what is buffered in s without blocking.
+func drain[T any](s *Subscription[T]) []Message[T] {
+	var out []Message[T]
+	for {
+		select {
+		case m, ok := <-s.C():
+			if !ok {
+				return out
+			}
+			out = append(out, m)
+		default:
+			return out
+		}
+	}
+}
+
+func mustSub[T any](s *Subscription[T], err error) *Subscription[T] {
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func TestMatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, topic string
+		want           bool
+	}{
+		{"a.b.c", "a.b.c", true},
+		{"a.*.c", "a.x.c", true},
+		{"a.*.c", "a.x.y.c", false},
+		{"a.*", "a", false},
+		{"a.>", "a.x", true},
+		{"a.>", "a.x.y.z", true},
+		{"a.>", "a", false},
+		{">", "anything.at.all", true},
+		{"*.b", "a.c", false},
+	} {
+		if got := match(strings.Split(tc.pattern, "."), strings.Split(tc.topic, ".")); got != tc.want {
+			t.Errorf("match(%q, %q) = %v", tc.pattern, tc.topic, got)
+		}
+	}
+	for _, bad := range []string{"a.>.b", "a..b", ""} {
+		if validPattern(bad) == nil {
+			t.Errorf("pattern %q accepted", bad)
+		}
+	}
+}
+
+func TestTypedTopicsAndWildcards(t *testing.T) {
+	b := NewBus()
+	euCreated := NewTopic[order](b, "orders.eu.created")
+	usCreated := NewTopic[order](b, "orders.us.created")
+	euCancelled := NewTopic[order](b, "orders.eu.cancelled")
+	audit := NewTopic[string](b, "orders.audit")
+
+	exact := mustSub(euCreated.Subscribe(SubOptions{}))
+	created := mustSub(SubscribePattern[order](b, "orders.*.created", SubOptions{}))
+	all := mustSub(SubscribePattern[order](b, "orders.>", SubOptions{}))
+
+	euCreated.Publish(bg, order{1, "eu"})
+	usCreated.Publish(bg, order{2, "us"})
+	euCancelled.Publish(bg, order{3, "eu"})
+	if n, _ := audit.Publish(bg, "not an order"); n != 0 {
+		t.Fatalf("string payload delivered to %d order subscribers", n)
+	}
+
+	ids := func(ms []Message[order]) (out []int) {
+		for _, m := range ms {
+			out = append(out, m.Payload.ID)
+		}
+		return out
+	}
+	if got := fmt.Sprint(ids(drain(exact))); got != "[1]" {
+		t.Errorf("exact got %s", got)
+	}
+	if got := fmt.Sprint(ids(drain(created))); got != "[1 2]" {
+		t.Errorf("orders.*.created got %s", got)
+	}
+	msgs := drain(all)
+	if got := fmt.Sprint(ids(msgs)); got != "[1 2 3]" {
+		t.Errorf("orders.> got %s", got)
+	}
+	if msgs[2].Topic != "orders.eu.cancelled" {
+		t.Errorf("topic = %q", msgs[2].Topic)
+	}
+}
+
+func TestSlowSubscriberPolicies(t *testing.T) {
+	t.Run("drop", func(t *testing.T) {
+		b := NewBus()
+		topic := NewTopic[int](b, "n")
+		slow := mustSub(topic.Subscribe(SubOptions{Buffer: 1}))
+		fast := mustSub(topic.Subscribe(SubOptions{Buffer: 10}))
+		for i := 0; i < 3; i++ {
+			topic.Publish(bg, i)
+		}
+		if got := len(drain(slow)); got != 1 || slow.Dropped() != 2 {
+			t.Fatalf("slow got %d, dropped %d", got, slow.Dropped())
+		}
+		if got := len(drain(fast)); got != 3 {
+			t.Fatalf("fast subscriber affected by slow one: got %d", got)
+		}
+	})
+
+	t.Run("block with timeout", func(t *testing.T) {
+		b := NewBus()
+		topic := NewTopic[int](b, "n")
+		s := mustSub(topic.Subscribe(SubOptions{Buffer: 1, Policy: Block, Timeout: 20 * time.Millisecond}))
+		topic.Publish(bg, 1)
+		begin := time.Now()
+		if n, _ := topic.Publish(bg, 2); n != 0 || s.Dropped() != 1 {
+			t.Fatalf("delivered %d, dropped %d", n, s.Dropped())
+		}
+		if el := time.Since(begin); el < 20*time.Millisecond {
+			t.Fatalf("publisher did not block: %v", el)
+		}
+
+		go func() { time.Sleep(5 * time.Millisecond); <-s.C() }()
+		if n, _ := topic.Publish(bg, 3); n != 1 {
+			t.Fatal("blocked publish not delivered once room appeared")
+		}
+	})
+
+	t.Run("block until ctx", func(t *testing.T) {
+		b := NewBus()
+		topic := NewTopic[int](b, "n")
+		mustSub(topic.Subscribe(SubOptions{Buffer: 1, Policy: Block}))
+		topic.Publish(bg, 1)
+		ctx, cancel := context.WithTimeout(bg, 10*time.Millisecond)
+		defer cancel()
+		if _, err := topic.Publish(ctx, 2); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("err = %v", err)
+		}
+	})
+
+	t.Run("disconnect", func(t *testing.T) {
+		b := NewBus()
+		topic := NewTopic[int](b, "n")
+		s := mustSub(topic.Subscribe(SubOptions{Buffer: 1, Policy: Disconnect}))
+		topic.Publish(bg, 1)
+		topic.Publish(bg, 2)
+		if !errors.Is(s.Err(), ErrSlowConsumer) {
+			t.Fatalf("Err = %v", s.Err())
+		}
+		if got := drain(s); len(got) != 1 || got[0].Payload != 1 {
+			t.Fatalf("buffered before disconnect = %v", got)
+		}
+		if _, ok := <-s.C(); ok {
+			t.Fatal("C not closed after disconnect")
+		}
+		if n, _ := topic.Publish(bg, 3); n != 0 {
+			t.Fatal("disconnected subscriber still registered")
+		}
+	})
+}
+
+func TestUnsubscribe(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	b := NewBus()
+	topic := NewTopic[int](b, "n")
+	s := mustSub(topic.Subscribe(SubOptions{Buffer: 4}))
+	topic.Publish(bg, 1)
+	topic.Publish(bg, 2)
+	s.Unsubscribe()
+	var got []int
+	for m := range s.C() { // buffered messages survive, then C closes
+		got = append(got, m.Payload)
+	}
+	if fmt.Sprint(got) != "[1 2]" {
+		t.Fatalf("drained %v", got)
+	}
+	if n, _ := topic.Publish(bg, 3); n != 0 {
+		t.Fatal("delivered after Unsubscribe")
+	}
+
+	// Unsubscribing releases a publisher blocked on a full buffer.
+	blocked := mustSub(topic.Subscribe(SubOptions{Buffer: 1, Policy: Block}))
+	topic.Publish(bg, 1)
+	done := make(chan struct{})
+	go func() { topic.Publish(bg, 2); close(done) }()
+	time.Sleep(5 * time.Millisecond)
+	blocked.Unsubscribe()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("publisher still blocked after Unsubscribe")
+	}
+}
+
+func TestRequestReply(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	b := NewBus()
+	lookup := NewTopic[int](b, "users.lookup")
+
+	if _, err := Request[int, string](bg, lookup, 1); !errors.Is(err, ErrNoResponders) {
+		t.Fatalf("err = %v, want ErrNoResponders", err)
+	}
+
+	sub := mustSub(lookup.Subscribe(SubOptions{}))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for m := range sub.C() {
+			switch {
+			case m.Payload < 0:
+				ReplyError(b, m, errors.New("negative id"))
+			case m.Payload == 0:
+				// never answers
+			default:
+				Reply(b, m, fmt.Sprintf("user-%d", m.Payload))
+			}
+		}
+	}()
+	defer wg.Wait()
+	defer sub.Unsubscribe()
+
+	// Concurrent requests are matched to their own replies.
+	var rg sync.WaitGroup
+	for i := 1; i <= 20; i++ {
+		rg.Add(1)
+		go func() {
+			defer rg.Done()
+			got, err := Request[int, string](bg, lookup, i)
+			if want := fmt.Sprintf("user-%d", i); err != nil || got != want {
+				t.Errorf("Request(%d) = %q, %v", i, got, err)
+			}
+		}()
+	}
+	rg.Wait()
+
+	if _, err := Request[int, string](bg, lookup, -1); err == nil || err.Error() != "negative id" {
+		t.Fatalf("err = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(bg, 10*time.Millisecond)
+	defer cancel()
+	if _, err := Request[int, string](ctx, lookup, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v", err)
+	}
+	if _, err := Request[int, int](bg, lookup, 7); err == nil || !strings.Contains(err.Error(), "is string, want int") {
+		t.Fatalf("wrong reply type err = %v", err)
+	}
+	if err := Reply(b, Message[int]{CorrelationID: 1}, "late"); !errors.Is(err, ErrNoRequester) {
+		t.Fatalf("late reply err = %v", err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	b := NewBus()
+	topic := NewTopic[int](b, "n")
+	s := mustSub(topic.Subscribe(SubOptions{}))
+	w := mustSub(SubscribePattern[int](b, ">", SubOptions{}))
+	b.Close()
+	if _, ok := <-s.C(); ok {
+		t.Fatal("subscription open after Close")
+	}
+	if _, ok := <-w.C(); ok {
+		t.Fatal("pattern subscription open after Close")
+	}
+	if _, err := topic.Publish(bg, 1); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Publish err = %v", err)
+	}
+	if _, err := topic.Subscribe(SubOptions{}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Subscribe err = %v", err)
+	}
+}
+
+func TestConcurrentPublishAndUnsubscribe(t *testing.T) {
+	b := NewBus()
+	topic := NewTopic[int](b, "n")
+	var wg sync.WaitGroup
+	for p := 0; p < 4; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				topic.Publish(bg, i)
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		policy := Policy(i % 3)
+		s := mustSub(topic.Subscribe(SubOptions{Buffer: 2, Policy: policy, Timeout: time.Millisecond}))
+		drain(s)
+		s.Unsubscribe()
+	}
+	wg.Wait()
+}
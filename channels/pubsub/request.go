@@ -0,0 +1,85 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNoResponders is returned by Request when nobody is subscribed to
+	// the topic.
+	ErrNoResponders = errors.New("pubsub: no responders")
+	// ErrNoRequester is returned by Reply when the request was already
+	// answered or its caller gave up.
+	ErrNoRequester = errors.New("pubsub: requester gone")
+)
+
+type reply struct {
+	v   any
+	err error
+}
+
+// Request publishes v on t with a fresh correlation ID and waits for the
+// first Reply to it, or for ctx to end. Responders must answer with a Resp.
+func Request[Req, Resp any](ctx context.Context, t *Topic[Req], v Req) (Resp, error) {
+	var zero Resp
+	b := t.bus
+	id := b.nextCorr.Add(1)
+	ch := make(chan reply, 1)
+	b.pmu.Lock()
+	b.pending[id] = ch
+	b.pmu.Unlock()
+	defer func() {
+		b.pmu.Lock()
+		delete(b.pending, id)
+		b.pmu.Unlock()
+	}()
+
+	n, err := b.publish(ctx, envelope{topic: t.name, payload: v, corr: id})
+	if err != nil {
+		return zero, err
+	}
+	if n == 0 {
+		return zero, fmt.Errorf("%w on %s", ErrNoResponders, t.name)
+	}
+	select {
+	case r := <-ch:
+		if r.err != nil {
+			return zero, r.err
+		}
+		resp, ok := r.v.(Resp)
+		if !ok {
+			return zero, fmt.Errorf("pubsub: reply on %s is %T, want %T", t.name, r.v, zero)
+		}
+		return resp, nil
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// Reply answers a message received from Request. Only the first reply is
+// kept; later ones return ErrNoRequester.
+func Reply[Req, Resp any](b *Bus, req Message[Req], resp Resp) error {
+	return b.reply(req.CorrelationID, reply{v: resp})
+}
+
+// ReplyError answers a request with an error, which Request returns.
+func ReplyError[Req any](b *Bus, req Message[Req], err error) error {
+	return b.reply(req.CorrelationID, reply{err: err})
+}
+
+func (b *Bus) reply(id uint64, r reply) error {
+	if id == 0 {
+		return errors.New("pubsub: message is not a request")
+	}
+	b.pmu.Lock()
+	ch, ok := b.pending[id]
+	delete(b.pending, id)
+	b.pmu.Unlock()
+	if !ok {
+		return ErrNoRequester
+	}
+	ch <- r // buffered, and only one reply gets here
+	return nil
+}
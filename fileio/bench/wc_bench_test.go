@@ -0,0 +1,102 @@
+package bench
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gobyexamples/fileio/textstats"
+)
+
+// Run with: go test -bench=WordCount -benchtime=5x ./fileio/bench
+//
+// 009_word_count.go's loop (one goroutine, bufio.ScanWords into a map) over
+// 16 generated 4MB files, against textstats.Run with 1, 4 and GOMAXPROCS
+// workers.
+
+// corpus writes the input under b.TempDir, so it lives as long as the
+// top-level benchmark, whose sub-benchmarks all read it.
+func corpus(b *testing.B) (paths []string, size int64) {
+	dir := b.TempDir()
+	vocab := strings.Fields("alpha beta gamma delta epsilon zeta eta theta iota kappa lambda mu " +
+		"Ünïcode 日本語 naïve café the The a and of to in")
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 16; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("part-%02d.txt", i))
+		f, err := os.Create(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		w := bufio.NewWriter(f)
+		for n := 0; n < 4<<20; {
+			k, _ := w.WriteString(vocab[rng.Intn(len(vocab))])
+			sep := " "
+			if rng.Intn(12) == 0 {
+				sep = ".\n"
+			}
+			k2, _ := w.WriteString(sep)
+			n += k + k2
+		}
+		if err := w.Flush(); err != nil {
+			b.Fatal(err)
+		}
+		fi, _ := f.Stat()
+		size += fi.Size()
+		f.Close()
+		paths = append(paths, path)
+	}
+	return paths, size
+}
+
+// countSequential is 009_word_count.go applied to every file in turn.
+func countSequential(paths []string) (map[string]int, error) {
+	counts := map[string]int{}
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		s := bufio.NewScanner(f)
+		s.Split(bufio.ScanWords)
+		for s.Scan() {
+			counts[s.Text()]++
+		}
+		f.Close()
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+func BenchmarkWordCount(b *testing.B) {
+	paths, size := corpus(b)
+	b.Run("sequential-009", func(b *testing.B) {
+		b.SetBytes(size)
+		for i := 0; i < b.N; i++ {
+			if _, err := countSequential(paths); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	for _, workers := range []int{1, 4, 0} {
+		name := fmt.Sprintf("textstats/workers=%d", workers)
+		if workers == 0 {
+			name = "textstats/workers=GOMAXPROCS"
+		}
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(size)
+			opts := textstats.Options{Workers: workers, TopN: 10, Fold: true}
+			for i := 0; i < b.N; i++ {
+				if _, err := textstats.Run(context.Background(), paths, opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+// Package copyfile copies files and directory trees the way
+// fileio/examples/007_copy_file.go should: keeping permissions and
+// modification times, leaving holes in sparse files, checking every Close,
+// and optionally verifying the copy with the chunked SHA-256 of
+// 012_chunk_checksum.go.
+//
+// A file is copied to dst+".partial" and renamed into place when complete,
+// so dst is never seen half-written. With Resume set, an interrupted copy
+// picks up where the partial file ends if its bytes still match the source.
+package copyfile
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// PartialSuffix is appended to dst while a copy is in progress.
+const PartialSuffix = ".partial"
+
+// ErrChecksumMismatch is returned by a verified copy whose destination does
+// not hash to the same value as the source.
+var ErrChecksumMismatch = errors.New("copyfile: checksum mismatch")
+
+// Skip selects which existing destination files are left alone, rsync
+// style.
+type Skip int
+
+const (
+	// SkipNone always copies.
+	SkipNone Skip = iota
+	// SkipSameSizeModTime skips files whose size and modification time
+	// match the source, like rsync's default quick check.
+	SkipSameSizeModTime
+	// SkipSameChecksum skips files whose size and SHA-256 match, like
+	// rsync --checksum. It reads both files but catches changes that kept
+	// the size and mtime.
+	SkipSameChecksum
+)
+
+// Progress reports how far the copy of one file has got.
+type Progress struct {
+	Path        string // source path
+	Done, Total int64  // bytes
+}
+
+// Options configures File and Tree. The zero value copies everything with
+// a 64KB buffer and no verification.
+type Options struct {
+	// Verify re-reads the finished copy and compares SHA-256 digests.
+	Verify bool
+	// Resume continues from an existing dst+PartialSuffix whose contents
+	// match the start of the source, and keeps the partial file when a
+	// copy fails so a later call can resume it.
+	Resume bool
+	Skip   Skip
+	// Include and Exclude filter Tree by glob (path.Match syntax). A
+	// pattern containing "/" is matched against the slash-separated path
+	// relative to the tree root, otherwise against the base name. Exclude
+	// wins, and an excluded directory is not descended into. With Include
+	// set, only matching files are copied.
+	Include, Exclude []string
+	// Progress, if set, is called after every buffer written.
+	Progress   func(Progress)
+	BufferSize int
+}
+
+// Stats summarises a File or Tree call.
+type Stats struct {
+	Files   int   // copied
+	Skipped int   // left alone by Options.Skip
+	Resumed int   // continued from a partial file
+	Bytes   int64 // read from the sources, excluding resumed prefixes
+}
+
+func (s *Stats) add(o Stats) {
+	s.Files += o.Files
+	s.Skipped += o.Skipped
+	s.Resumed += o.Resumed
+	s.Bytes += o.Bytes
+}
+
+// File copies the regular file src to dst, replacing dst.
+func File(ctx context.Context, src, dst string, opts Options) (Stats, error) {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 64 * 1024
+	}
+	fi, err := os.Stat(src)
+	if err != nil {
+		return Stats{}, err
+	}
+	if !fi.Mode().IsRegular() {
+		return Stats{}, fmt.Errorf("copyfile: %s is not a regular file", src)
+	}
+	if skip, err := unchanged(src, dst, fi, opts.Skip); err != nil || skip {
+		if skip {
+			return Stats{Skipped: 1}, nil
+		}
+		return Stats{}, err
+	}
+
+	partial := dst + PartialSuffix
+	st, err := copyData(ctx, src, partial, fi, opts)
+	if err != nil {
+		if !opts.Resume {
+			os.Remove(partial)
+		}
+		return st, err
+	}
+	if err := finish(partial, dst, fi); err != nil {
+		os.Remove(partial)
+		return st, err
+	}
+	st.Files = 1
+	return st, nil
+}
+
+// unchanged reports whether dst already matches src under skip.
+func unchanged(src, dst string, sfi fs.FileInfo, skip Skip) (bool, error) {
+	if skip == SkipNone {
+		return false, nil
+	}
+	dfi, err := os.Stat(dst)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil || !dfi.Mode().IsRegular() || dfi.Size() != sfi.Size() {
+		return false, err
+	}
+	if skip == SkipSameSizeModTime {
+		return dfi.ModTime().Equal(sfi.ModTime()), nil
+	}
+	a, err := FileChecksum(src)
+	if err != nil {
+		return false, err
+	}
+	b, err := FileChecksum(dst)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(a, b), nil
+}
+
+// copyData fills partial with src's contents, resuming if allowed.
+func copyData(ctx context.Context, src, partial string, fi fs.FileInfo, opts Options) (st Stats, err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return st, err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(partial, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return st, err
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil && cerr != nil {
+			err = cerr
+		}
+	}()
+
+	h := sha256.New()
+	offset, err := resumeOffset(in, out, h, fi.Size(), opts.Resume)
+	if err != nil {
+		return st, err
+	}
+	if offset > 0 {
+		st.Resumed = 1
+	}
+
+	buf := make([]byte, opts.BufferSize)
+	done := offset
+	for {
+		if err := ctx.Err(); err != nil {
+			return st, err
+		}
+		n, rerr := io.ReadFull(in, buf)
+		if n > 0 {
+			h.Write(buf[:n])
+			if isZero(buf[:n]) {
+				// Leave a hole; the final Truncate sets the length.
+				_, err = out.Seek(int64(n), io.SeekCurrent)
+			} else {
+				_, err = out.Write(buf[:n])
+			}
+			if err != nil {
+				return st, err
+			}
+			done += int64(n)
+			st.Bytes += int64(n)
+			if opts.Progress != nil {
+				opts.Progress(Progress{Path: src, Done: done, Total: fi.Size()})
+			}
+		}
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			break
+		}
+		if rerr != nil {
+			return st, rerr
+		}
+	}
+	if err := out.Truncate(done); err != nil {
+		return st, err
+	}
+	if err := out.Sync(); err != nil {
+		return st, err
+	}
+
+	if opts.Verify {
+		if _, err := out.Seek(0, io.SeekStart); err != nil {
+			return st, err
+		}
+		got, err := Checksum(out)
+		if err != nil {
+			return st, err
+		}
+		if !bytes.Equal(got, h.Sum(nil)) {
+			return st, fmt.Errorf("%w: %s", ErrChecksumMismatch, partial)
+		}
+	}
+	return st, nil
+}
+
+// resumeOffset returns where copying should start. When the partial file
+// out is a prefix of in, both are positioned after it and h holds the
+// prefix's hash; otherwise out is emptied and copying starts from zero.
+func resumeOffset(in, out *os.File, h hash.Hash, size int64, resume bool) (int64, error) {
+	pfi, err := out.Stat()
+	if err != nil {
+		return 0, err
+	}
+	n := pfi.Size()
+	if resume && n > 0 && n <= size {
+		if _, err := io.Copy(h, io.LimitReader(in, n)); err != nil {
+			return 0, err
+		}
+		have, err := Checksum(out)
+		if err != nil {
+			return 0, err
+		}
+		if bytes.Equal(have, h.Sum(nil)) {
+			return n, nil // both files are now positioned at n
+		}
+		h.Reset()
+		if _, err := in.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+		if _, err := out.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
+	return 0, out.Truncate(0)
+}
+
+// finish gives partial src's mode and mtime and moves it into place.
+func finish(partial, dst string, fi fs.FileInfo) error {
+	if err := os.Chmod(partial, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := os.Chtimes(partial, time.Time{}, fi.ModTime()); err != nil {
+		return err
+	}
+	return os.Rename(partial, dst)
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Checksum is the chunked SHA-256 of 012_chunk_checksum.go: it hashes r in
+// 64KB reads, so memory stays flat however large the input.
+func Checksum(r io.Reader) ([]byte, error) {
+	h := sha256.New()
+	buf := make([]byte, 64*1024)
+	if _, err := io.CopyBuffer(h, r, buf); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// FileChecksum returns the SHA-256 of the file at path.
+func FileChecksum(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Checksum(f)
+}
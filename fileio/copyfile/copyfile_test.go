@@ -0,0 +1,247 @@
+package copyfile
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+var (
+	bg    = context.Background()
+	mtime = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+)
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(b)
+	return b
+}
+
+func writeFile(t *testing.T, path string, data []byte, perm fs.FileMode) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, perm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, perm); err != nil { // undo the umask
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sameFile(t *testing.T, src, dst string) {
+	t.Helper()
+	a, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a, b) {
+		t.Fatalf("%s differs from %s", dst, src)
+	}
+	sfi, _ := os.Stat(src)
+	dfi, _ := os.Stat(dst)
+	if sfi.Mode() != dfi.Mode() || !sfi.ModTime().Equal(dfi.ModTime()) {
+		t.Fatalf("%s: mode %v mtime %v, want %v %v", dst, dfi.Mode(), dfi.ModTime(), sfi.Mode(), sfi.ModTime())
+	}
+}
+
+func TestFilePreservesModeAndMtime(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	writeFile(t, src, randomBytes(200_000), 0o640)
+
+	var last Progress
+	calls := 0
+	st, err := File(bg, src, dst, Options{Verify: true, Progress: func(p Progress) { last = p; calls++ }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameFile(t, src, dst)
+	if st != (Stats{Files: 1, Bytes: 200_000}) {
+		t.Fatalf("stats = %+v", st)
+	}
+	if calls != 4 || last.Done != 200_000 || last.Total != 200_000 || last.Path != src {
+		t.Fatalf("%d progress calls, last %+v", calls, last)
+	}
+	if _, err := os.Stat(dst + PartialSuffix); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatal("partial file left behind")
+	}
+}
+
+func TestSparse(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	data := make([]byte, 1<<20) // zeros with data at both ends
+	copy(data, "head")
+	copy(data[len(data)-4:], "tail")
+	writeFile(t, src, data, 0o644)
+	if _, err := File(bg, src, dst, Options{Verify: true}); err != nil {
+		t.Fatal(err)
+	}
+	sameFile(t, src, dst)
+
+	// A file ending in a hole still gets its full length.
+	writeFile(t, src, make([]byte, 100_000), 0o644)
+	if _, err := File(bg, src, dst, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	sameFile(t, src, dst)
+}
+
+func TestResume(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	data := randomBytes(300_000)
+	writeFile(t, src, data, 0o644)
+
+	// A partial file holding a correct prefix is continued.
+	writeFile(t, dst+PartialSuffix, data[:100_000], 0o600)
+	st, err := File(bg, src, dst, Options{Resume: true, Verify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameFile(t, src, dst)
+	if st.Resumed != 1 || st.Bytes != 200_000 {
+		t.Fatalf("stats = %+v", st)
+	}
+
+	// One that does not match the source is started over.
+	bad := slices.Clone(data[:100_000])
+	bad[50] ^= 0xff
+	writeFile(t, dst+PartialSuffix, bad, 0o600)
+	st, err = File(bg, src, dst, Options{Resume: true, Verify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameFile(t, src, dst)
+	if st.Resumed != 0 || st.Bytes != 300_000 {
+		t.Fatalf("stats = %+v", st)
+	}
+}
+
+func TestCancelKeepsPartialOnlyWithResume(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	writeFile(t, src, randomBytes(300_000), 0o644)
+
+	for _, resume := range []bool{false, true} {
+		ctx, cancel := context.WithCancel(bg)
+		_, err := File(ctx, src, dst, Options{Resume: resume, Progress: func(p Progress) {
+			if p.Done >= 128*1024 {
+				cancel()
+			}
+		}})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("resume=%v: err = %v", resume, err)
+		}
+		fi, err := os.Stat(dst + PartialSuffix)
+		if resume && (err != nil || fi.Size() != 128*1024) {
+			t.Fatalf("partial after cancel: %v, %v", fi, err)
+		}
+		if !resume && !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("partial kept without Resume: %v", err)
+		}
+		if _, err := os.Stat(dst); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatal("dst created by a cancelled copy")
+		}
+	}
+
+	st, err := File(bg, src, dst, Options{Resume: true})
+	if err != nil || st.Resumed != 1 || st.Bytes != 300_000-128*1024 {
+		t.Fatalf("resumed copy: %+v, %v", st, err)
+	}
+	sameFile(t, src, dst)
+}
+
+func TestTree(t *testing.T) {
+	src, dst := t.TempDir(), filepath.Join(t.TempDir(), "out")
+	writeFile(t, filepath.Join(src, "a.txt"), []byte("a"), 0o644)
+	writeFile(t, filepath.Join(src, "run.sh"), []byte("#!/bin/sh\n"), 0o755)
+	writeFile(t, filepath.Join(src, "sub", "b.txt"), []byte("b"), 0o600)
+	writeFile(t, filepath.Join(src, "sub", "b.log"), []byte("log"), 0o644)
+	writeFile(t, filepath.Join(src, "sub", "deep", "c.txt"), []byte("c"), 0o644)
+	writeFile(t, filepath.Join(src, ".git", "HEAD"), []byte("ref"), 0o644)
+	if err := os.Symlink("a.txt", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(src, "sub"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := Options{Exclude: []string{".git", "*.log"}}
+	st, err := Tree(bg, src, dst, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Files != 4 {
+		t.Fatalf("stats = %+v", st)
+	}
+	for _, rel := range []string{"a.txt", "run.sh", "sub/b.txt", "sub/deep/c.txt"} {
+		sameFile(t, filepath.Join(src, rel), filepath.Join(dst, rel))
+	}
+	for _, rel := range []string{".git", "sub/b.log"} {
+		if _, err := os.Stat(filepath.Join(dst, rel)); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("excluded %s was copied", rel)
+		}
+	}
+	if link, err := os.Readlink(filepath.Join(dst, "link")); err != nil || link != "a.txt" {
+		t.Fatalf("symlink = %q, %v", link, err)
+	}
+	if fi, _ := os.Stat(filepath.Join(dst, "sub")); !fi.ModTime().Equal(mtime) {
+		t.Fatalf("dir mtime = %v", fi.ModTime())
+	}
+
+	// Include limits the copy to matching files.
+	only := filepath.Join(t.TempDir(), "only")
+	st, err = Tree(bg, src, only, Options{Include: []string{"sub/*.txt"}})
+	if err != nil || st.Files != 1 {
+		t.Fatalf("include: %+v, %v", st, err)
+	}
+}
+
+func TestSkipUnchanged(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	for _, name := range []string{"a", "b", "c"} {
+		writeFile(t, filepath.Join(src, name), []byte(name+name), 0o644)
+	}
+	opts := Options{Skip: SkipSameSizeModTime}
+	if st, err := Tree(bg, src, dst, opts); err != nil || st.Files != 3 {
+		t.Fatalf("first sync: %+v, %v", st, err)
+	}
+	if st, err := Tree(bg, src, dst, opts); err != nil || st.Files != 0 || st.Skipped != 3 {
+		t.Fatalf("second sync: %+v, %v", st, err)
+	}
+
+	// Same size, new mtime: the quick check copies it.
+	writeFile(t, filepath.Join(src, "a"), []byte("AA"), 0o644)
+	os.Chtimes(filepath.Join(src, "a"), mtime.Add(time.Hour), mtime.Add(time.Hour))
+	if st, err := Tree(bg, src, dst, opts); err != nil || st.Files != 1 || st.Skipped != 2 {
+		t.Fatalf("after touching a: %+v, %v", st, err)
+	}
+
+	// Same size and mtime, different bytes: only the checksum sees it.
+	writeFile(t, filepath.Join(src, "b"), []byte("BB"), 0o644)
+	if st, _ := Tree(bg, src, dst, opts); st.Files != 0 {
+		t.Fatalf("quick check copied b: %+v", st)
+	}
+	opts.Skip = SkipSameChecksum
+	if st, err := Tree(bg, src, dst, opts); err != nil || st.Files != 1 || st.Skipped != 2 {
+		t.Fatalf("checksum sync: %+v, %v", st, err)
+	}
+	sameFile(t, filepath.Join(src, "b"), filepath.Join(dst, "b"))
+}
@@ -0,0 +1,105 @@
+package copyfile
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Tree copies the directory srcDir into dstDir, creating dstDir if needed.
+// Regular files go through File with the same options, symlinks are
+// recreated rather than followed, and other file types are ignored.
+// Directory modes and mtimes are applied after their contents are copied.
+// Files in dstDir that are not in srcDir are left alone.
+func Tree(ctx context.Context, srcDir, dstDir string, opts Options) (Stats, error) {
+	var (
+		total Stats
+		dirs  []string // relative paths, parents before children
+	)
+	err := filepath.WalkDir(srcDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(srcDir, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dstDir, rel)
+		if rel != "." && matchAny(opts.Exclude, rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		switch {
+		case d.IsDir():
+			dirs = append(dirs, rel)
+			return os.MkdirAll(target, 0o755)
+		case len(opts.Include) > 0 && !matchAny(opts.Include, rel):
+			return nil
+		case d.Type()&fs.ModeSymlink != 0:
+			return copySymlink(p, target)
+		case d.Type().IsRegular():
+			st, err := File(ctx, p, target, opts)
+			total.add(st)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return total, err
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		fi, err := os.Stat(filepath.Join(srcDir, dirs[i]))
+		if err != nil {
+			return total, err
+		}
+		target := filepath.Join(dstDir, dirs[i])
+		if err := os.Chmod(target, fi.Mode().Perm()); err != nil {
+			return total, err
+		}
+		if err := os.Chtimes(target, time.Time{}, fi.ModTime()); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// matchAny reports whether rel matches one of patterns; see Options.Include.
+func matchAny(patterns []string, rel string) bool {
+	rel = filepath.ToSlash(rel)
+	for _, pat := range patterns {
+		name := rel
+		if !strings.Contains(pat, "/") {
+			name = path.Base(rel)
+		}
+		if ok, _ := path.Match(pat, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func copySymlink(src, dst string) error {
+	link, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	if cur, err := os.Readlink(dst); err == nil && cur == link {
+		return nil
+	}
+	if err := os.Remove(dst); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return os.Symlink(link, dst)
+}
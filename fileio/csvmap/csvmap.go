@@ -0,0 +1,242 @@
+// Package csvmap decodes CSV rows into structs and encodes them back,
+// matching columns by header name instead of position as
+// fileio/examples/011_read_csv.go does with row[0], row[1].
+//
+// Fields map to columns with a `csv:"name"` tag (the field name when
+// untagged, `csv:"-"` to skip); header names match case-insensitively and
+// column order does not matter. Tag options: `required` (the column must
+// exist and the cell be non-empty) and `layout=...` (a time layout for
+// that field). Supported types are strings, bools, ints, uints, floats,
+// time.Time, time.Duration, pointers to those (empty cell = nil) and
+// encoding.TextUnmarshaler/TextMarshaler implementations.
+//
+// The decoder reads one row at a time with a reused record buffer, so
+// memory stays constant however large the file.
+package csvmap
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options configures a Decoder or Encoder. The zero value reads and writes
+// comma-separated files with RFC 3339 times.
+type Options struct {
+	Comma rune
+	// TrimSpace trims leading space in cells, as csv.Reader.TrimLeadingSpace.
+	TrimSpace bool
+	// TimeLayout is the default layout for time.Time fields.
+	TimeLayout string
+	// Lenient makes Decode skip rows that fail to parse or convert instead
+	// of returning their error; the errors are kept in Decoder.Errors.
+	Lenient bool
+	// MaxErrors stops a lenient decode with ErrTooManyErrors once this many
+	// rows were bad; 0 means no limit.
+	MaxErrors int
+}
+
+func (o *Options) defaults() {
+	if o.Comma == 0 {
+		o.Comma = ','
+	}
+	if o.TimeLayout == "" {
+		o.TimeLayout = time.RFC3339
+	}
+}
+
+// ErrTooManyErrors ends a lenient decode that reached Options.MaxErrors.
+var ErrTooManyErrors = errors.New("csvmap: too many bad rows")
+
+// Error locates a bad cell or row. Line is the 1-based line in the input;
+// Column is the 1-based column and Field its header, or 0 and "" when the
+// whole row is malformed.
+type Error struct {
+	Line   int
+	Column int
+	Field  string
+	Value  string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	if e.Column == 0 {
+		return fmt.Sprintf("csvmap: line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("csvmap: line %d, column %d (%s): %q: %v", e.Line, e.Column, e.Field, e.Value, e.Err)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Decoder reads structs of type T from CSV with a header row.
+type Decoder[T any] struct {
+	r      *csv.Reader
+	opts   Options
+	fields []field
+	cols   []int // column index for each field, -1 if absent
+	header []string
+	errs   []*Error
+}
+
+// NewDecoder reads the header row and matches it to T's fields. A
+// required field without a column is an error.
+func NewDecoder[T any](r io.Reader, opts Options) (*Decoder[T], error) {
+	opts.defaults()
+	fields, err := fieldsOf(reflect.TypeFor[T](), opts.TimeLayout)
+	if err != nil {
+		return nil, err
+	}
+	cr := csv.NewReader(r)
+	cr.Comma = opts.Comma
+	cr.TrimLeadingSpace = opts.TrimSpace
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("csvmap: missing header row")
+	}
+	if err != nil {
+		return nil, err
+	}
+	header = append([]string(nil), header...) // the record buffer is reused
+
+	d := &Decoder[T]{r: cr, opts: opts, fields: fields, cols: make([]int, len(fields)), header: header}
+	for i, f := range fields {
+		d.cols[i] = -1
+		for c, h := range header {
+			if strings.EqualFold(strings.TrimSpace(h), f.name) {
+				d.cols[i] = c
+				break
+			}
+		}
+		if d.cols[i] < 0 && f.required {
+			return nil, fmt.Errorf("csvmap: required column %q not in header %q", f.name, header)
+		}
+	}
+	return d, nil
+}
+
+// Header returns the input's header row.
+func (d *Decoder[T]) Header() []string { return d.header }
+
+// Decode fills v from the next row and returns io.EOF after the last.
+// Errors are *Error values. In lenient mode bad rows are skipped and
+// recorded instead, and v is only written for good rows.
+func (d *Decoder[T]) Decode(v *T) error {
+	for {
+		err := d.decode(v)
+		var e *Error
+		if err == nil || !d.opts.Lenient || !errors.As(err, &e) {
+			return err
+		}
+		d.errs = append(d.errs, e)
+		if d.opts.MaxErrors > 0 && len(d.errs) >= d.opts.MaxErrors {
+			return ErrTooManyErrors
+		}
+	}
+}
+
+// Errors returns the rows skipped by a lenient decode so far.
+func (d *Decoder[T]) Errors() []*Error { return d.errs }
+
+func (d *Decoder[T]) decode(v *T) error {
+	record, err := d.r.Read()
+	if err != nil {
+		var pe *csv.ParseError
+		if errors.As(err, &pe) {
+			return &Error{Line: pe.Line, Err: pe.Err}
+		}
+		return err
+	}
+
+	// Convert into a scratch value so a bad row leaves v untouched.
+	var row T
+	rv := reflect.ValueOf(&row).Elem()
+	for i, f := range d.fields {
+		c := d.cols[i]
+		if c < 0 {
+			continue
+		}
+		s := record[c]
+		line, _ := d.r.FieldPos(c) // a quoted cell can span lines
+		if s == "" && f.required {
+			return &Error{Line: line, Column: c + 1, Field: d.header[c], Err: errors.New("required value is empty")}
+		}
+		if err := parse(rv.FieldByIndex(f.index), s, f.layout); err != nil {
+			return &Error{Line: line, Column: c + 1, Field: d.header[c], Value: s, Err: unwrapNum(err)}
+		}
+	}
+	*v = row
+	return nil
+}
+
+// unwrapNum drops strconv's repetition of the input ("strconv.ParseInt:
+// parsing "x": invalid syntax") since Error already shows the value.
+func unwrapNum(err error) error {
+	var ne *strconv.NumError
+	if errors.As(err, &ne) {
+		return ne.Err
+	}
+	return err
+}
+
+// Encoder writes structs of type T as CSV, header first.
+type Encoder[T any] struct {
+	w      *csv.Writer
+	fields []field
+	row    []string
+	wrote  bool
+}
+
+// NewEncoder returns an encoder writing to w. Call Flush when done.
+func NewEncoder[T any](w io.Writer, opts Options) (*Encoder[T], error) {
+	opts.defaults()
+	fields, err := fieldsOf(reflect.TypeFor[T](), opts.TimeLayout)
+	if err != nil {
+		return nil, err
+	}
+	cw := csv.NewWriter(w)
+	cw.Comma = opts.Comma
+	return &Encoder[T]{w: cw, fields: fields, row: make([]string, len(fields))}, nil
+}
+
+// Encode writes v as one row, preceded by the header on the first call.
+func (e *Encoder[T]) Encode(v T) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	rv := reflect.ValueOf(&v).Elem()
+	for i, f := range e.fields {
+		s, err := format(rv.FieldByIndex(f.index), f.layout)
+		if err != nil {
+			return fmt.Errorf("csvmap: field %s: %w", f.name, err)
+		}
+		e.row[i] = s
+	}
+	return e.w.Write(e.row)
+}
+
+func (e *Encoder[T]) writeHeader() error {
+	if e.wrote {
+		return nil
+	}
+	e.wrote = true
+	for i, f := range e.fields {
+		e.row[i] = f.name
+	}
+	return e.w.Write(e.row)
+}
+
+// Flush writes buffered rows and reports any write error. The header is
+// written even if no rows were encoded.
+func (e *Encoder[T]) Flush() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
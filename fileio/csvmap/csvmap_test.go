@@ -0,0 +1,229 @@
+package csvmap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type person struct {
+	Name    string        `csv:"name,required"`
+	Age     int           `csv:"age"`
+	Score   float64       `csv:"score"`
+	Active  bool          `csv:"active"`
+	Born    time.Time     `csv:"born,layout=2006-01-02"`
+	Seen    *time.Time    `csv:"last_seen"`
+	Timeout time.Duration `csv:"timeout"`
+	Addr    netip.Addr    `csv:"ip"` // encoding.TextUnmarshaler
+	Nick    *string       `csv:"nick"`
+	Secret  string        `csv:"-"`
+}
+
+const people = `ip,name,age,score,active,born,last_seen,timeout,nick,extra
+10.0.0.1,Alice,30,9.5,true,1994-05-01,2024-01-02T03:04:05Z,1m30s,ali,x
+,Bob,25,7,false,1999-12-31,,,,y
+`
+
+func decodeAll[T any](t *testing.T, in string, opts Options) ([]T, *Decoder[T], error) {
+	t.Helper()
+	d, err := NewDecoder[T](strings.NewReader(in), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []T
+	for {
+		var v T
+		err := d.Decode(&v)
+		if err == io.EOF {
+			return out, d, nil
+		}
+		if err != nil {
+			return out, d, err
+		}
+		out = append(out, v)
+	}
+}
+
+func TestDecodeByHeader(t *testing.T) {
+	got, _, err := decodeAll[person](t, people, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d rows", len(got))
+	}
+	a, b := got[0], got[1]
+	seen := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if a.Name != "Alice" || a.Age != 30 || a.Score != 9.5 || !a.Active ||
+		!a.Born.Equal(time.Date(1994, 5, 1, 0, 0, 0, 0, time.UTC)) ||
+		a.Seen == nil || !a.Seen.Equal(seen) || a.Timeout != 90*time.Second ||
+		a.Addr != netip.MustParseAddr("10.0.0.1") || a.Nick == nil || *a.Nick != "ali" {
+		t.Fatalf("alice = %+v", a)
+	}
+	if b.Seen != nil || b.Nick != nil || b.Addr.IsValid() || b.Timeout != 0 || b.Score != 7 {
+		t.Fatalf("empty cells: %+v", b)
+	}
+}
+
+func TestErrorsAreCellPrecise(t *testing.T) {
+	in := "name,age\nAlice,30\nBob,old\n"
+	_, _, err := decodeAll[person](t, in, Options{})
+	var e *Error
+	if !errors.As(err, &e) || e.Line != 3 || e.Column != 2 || e.Field != "age" || e.Value != "old" {
+		t.Fatalf("err = %#v", err)
+	}
+	if !errors.Is(err, strconv.ErrSyntax) {
+		t.Fatalf("err does not wrap strconv.ErrSyntax: %v", err)
+	}
+	if want := `csvmap: line 3, column 2 (age): "old": invalid syntax`; err.Error() != want {
+		t.Fatalf("message = %q, want %q", err, want)
+	}
+
+	// A quoted cell spanning lines reports the line the cell starts on.
+	in = "age,name\n\"12\",\"two\nlines\"\n\"x\",\"Carol\"\n"
+	_, _, err = decodeAll[person](t, in, Options{})
+	if !errors.As(err, &e) || e.Line != 4 || e.Column != 1 {
+		t.Fatalf("after a multi-line cell: %v", err)
+	}
+
+	// Required columns are checked against the header up front.
+	if _, err := NewDecoder[person](strings.NewReader("age\n1\n"), Options{}); err == nil {
+		t.Fatal("missing required column accepted")
+	}
+}
+
+func TestLenient(t *testing.T) {
+	in := "name,age,active\n" +
+		"Alice,30,true\n" +
+		"Bob,x,false\n" + // bad int
+		"Carol,41\n" + // wrong field count
+		",50,true\n" + // empty required
+		"Dan,22,maybe\n" + // bad bool
+		"Eve,35,false\n"
+	got, d, err := decodeAll[person](t, in, Options{Lenient: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range got {
+		names = append(names, p.Name)
+	}
+	if fmt.Sprint(names) != "[Alice Eve]" {
+		t.Fatalf("good rows = %v", names)
+	}
+	var lines []string
+	for _, e := range d.Errors() {
+		lines = append(lines, fmt.Sprintf("%d:%d", e.Line, e.Column))
+	}
+	if fmt.Sprint(lines) != "[3:2 4:0 5:1 6:3]" {
+		t.Fatalf("error positions = %v", lines)
+	}
+
+	_, _, err = decodeAll[person](t, in, Options{Lenient: true, MaxErrors: 2})
+	if !errors.Is(err, ErrTooManyErrors) {
+		t.Fatalf("MaxErrors: err = %v", err)
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	in, _, err := decodeAll[person](t, people, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	e, err := NewEncoder[person](&buf, Options{Comma: ';'})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range in {
+		if err := e.Encode(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	wantHead := "name;age;score;active;born;last_seen;timeout;ip;nick\n" +
+		"Alice;30;9.5;true;1994-05-01;2024-01-02T03:04:05Z;1m30s;10.0.0.1;ali\n"
+	if !strings.HasPrefix(buf.String(), wantHead) {
+		t.Fatalf("encoded:\n%s", buf.String())
+	}
+	out, _, err := decodeAll[person](t, buf.String(), Options{Comma: ';'})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var again bytes.Buffer
+	e, _ = NewEncoder[person](&again, Options{Comma: ';'})
+	for _, p := range out {
+		e.Encode(p)
+	}
+	if e.Flush(); again.String() != buf.String() {
+		t.Fatalf("round trip changed the data:\n%s\n%s", again.String(), buf.String())
+	}
+
+	buf.Reset()
+	e, _ = NewEncoder[person](&buf, Options{})
+	if e.Flush(); !strings.HasPrefix(buf.String(), "name,age,") {
+		t.Fatalf("empty encode wrote %q", buf.String())
+	}
+}
+
+func TestBadStructs(t *testing.T) {
+	type badOpt struct {
+		A int `csv:"a,unknown"`
+	}
+	if _, err := NewDecoder[badOpt](strings.NewReader("a\n"), Options{}); err == nil {
+		t.Fatal("unknown tag option accepted")
+	}
+	type badType struct{ M map[string]int }
+	if _, err := NewEncoder[badType](io.Discard, Options{}); err == nil {
+		t.Fatal("map field accepted")
+	}
+}
+
+// rows generates an endless CSV body without holding it in memory.
+type rows struct {
+	n          int
+	line, rest []byte
+}
+
+func (r *rows) Read(p []byte) (int, error) {
+	if len(r.rest) == 0 {
+		r.n++
+		r.line = strconv.AppendInt(r.line[:0], int64(r.n), 10)
+		r.line = append(r.line, ",0.5,true\n"...)
+		r.rest = r.line
+	}
+	n := copy(p, r.rest)
+	r.rest = r.rest[n:]
+	return n, nil
+}
+
+func TestConstantMemoryPerRow(t *testing.T) {
+	type rec struct {
+		ID    int     `csv:"id"`
+		Value float64 `csv:"value"`
+		OK    bool    `csv:"ok"`
+	}
+	d, err := NewDecoder[rec](io.MultiReader(strings.NewReader("id,value,ok\n"), &rows{}), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v rec
+	allocs := testing.AllocsPerRun(10_000, func() {
+		if err := d.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+	})
+	// A few small allocations per record (csv.Reader's string for the line,
+	// the scratch row); nothing that grows with the file.
+	if allocs > 3 {
+		t.Fatalf("%.1f allocations per row", allocs)
+	}
+}
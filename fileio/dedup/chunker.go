@@ -0,0 +1,142 @@
+// Package dedup splits files into content-defined chunks and keeps them in
+// a local content-addressed store, so data shared between files (or between
+// versions of one file) is stored once.
+//
+// fileio/examples/012_chunk_checksum.go reads fixed 64KB buffers; cutting at
+// fixed offsets means inserting one byte near the start shifts every later
+// chunk and nothing dedups. The Chunker instead cuts where a rolling hash of
+// the last bytes matches a pattern (FastCDC), so boundaries move with the
+// content and an edit only changes the chunks around it.
+package dedup
+
+import (
+	"errors"
+	"io"
+	"math/bits"
+)
+
+// ChunkerOptions bounds chunk sizes. The zero value uses 16KB/64KB/256KB.
+type ChunkerOptions struct {
+	Min, Avg, Max int
+}
+
+// gear maps each byte to a random 64-bit value for the rolling hash. It
+// must never change: chunk boundaries, and so every stored hash, depend on
+// it.
+var gear = func() (t [256]uint64) {
+	x := uint64(0x9e3779b97f4a7c15) // splitmix64
+	for i := range t {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+		z = (z ^ z>>27) * 0x94d049bb133111eb
+		t[i] = z ^ z>>31
+	}
+	return t
+}()
+
+// Chunker reads r and returns it in content-defined chunks.
+type Chunker struct {
+	r             io.Reader
+	min, avg, max int
+	maskS, maskL  uint64
+	buf           []byte
+	start, end    int // unconsumed data is buf[start:end]
+	eof           bool
+	err           error
+}
+
+// NewChunker returns a chunker over r.
+func NewChunker(r io.Reader, opts ChunkerOptions) *Chunker {
+	if opts.Avg <= 0 {
+		opts.Avg = 64 * 1024
+	}
+	if opts.Min <= 0 {
+		opts.Min = opts.Avg / 4
+	}
+	if opts.Max <= 0 {
+		opts.Max = opts.Avg * 4
+	}
+	opts.Min = min(opts.Min, opts.Avg)
+	opts.Max = max(opts.Max, opts.Avg)
+	b := bits.Len(uint(opts.Avg)) - 1 // log2(Avg)
+	// Normalized chunking: a stricter mask (one more bit) before Avg and a
+	// looser one after pulls chunk sizes towards Avg.
+	return &Chunker{
+		r:     r,
+		min:   opts.Min,
+		avg:   opts.Avg,
+		max:   opts.Max,
+		maskS: topBits(b + 1),
+		maskL: topBits(b - 1),
+		buf:   make([]byte, 2*opts.Max),
+	}
+}
+
+// topBits returns a mask of the n most significant bits. The gear hash
+// shifts left, so its high bits depend on the most recent 64 bytes.
+func topBits(n int) uint64 {
+	if n <= 0 {
+		return 0
+	}
+	return ^uint64(0) << (64 - n)
+}
+
+// Next returns the next chunk, or io.EOF after the last. The slice is only
+// valid until the following call.
+func (c *Chunker) Next() ([]byte, error) {
+	if c.end-c.start < c.max && !c.eof {
+		c.fill()
+	}
+	if c.start == c.end {
+		if c.err != nil {
+			return nil, c.err
+		}
+		return nil, io.EOF
+	}
+	n := c.cut(c.buf[c.start:c.end])
+	chunk := c.buf[c.start : c.start+n]
+	c.start += n
+	return chunk, nil
+}
+
+// fill moves the unconsumed data to the front and reads until the buffer
+// holds at least Max bytes or the input ends.
+func (c *Chunker) fill() {
+	c.end = copy(c.buf, c.buf[c.start:c.end])
+	c.start = 0
+	for c.end < c.max && !c.eof {
+		n, err := c.r.Read(c.buf[c.end:])
+		c.end += n
+		if err != nil {
+			c.eof = true
+			if !errors.Is(err, io.EOF) {
+				c.err = err
+			}
+		}
+	}
+}
+
+// cut returns the length of the chunk at the start of data.
+func (c *Chunker) cut(data []byte) int {
+	if len(data) <= c.min {
+		return len(data)
+	}
+	n := min(len(data), c.max)
+	normal := min(n, c.avg)
+	var h uint64
+	i := c.min
+	for ; i < normal; i++ {
+		h = h<<1 + gear[data[i]]
+		if h&c.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		h = h<<1 + gear[data[i]]
+		if h&c.maskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
@@ -0,0 +1,202 @@
+package dedup
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func randomData(seed int64, n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(b)
+	return b
+}
+
+func chunks(t *testing.T, r io.Reader, opts ChunkerOptions) [][]byte {
+	t.Helper()
+	c := NewChunker(r, opts)
+	var out [][]byte
+	for {
+		data, err := c.Next()
+		if err == io.EOF {
+			return out
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, slices.Clone(data))
+	}
+}
+
+func TestChunkSizes(t *testing.T) {
+	data := randomData(1, 4<<20)
+	opts := ChunkerOptions{Min: 2048, Avg: 8192, Max: 32768}
+	got := chunks(t, bytes.NewReader(data), opts)
+	if !bytes.Equal(bytes.Join(got, nil), data) {
+		t.Fatal("chunks do not reassemble the input")
+	}
+	for i, c := range got {
+		if len(c) > opts.Max || len(c) < opts.Min && i != len(got)-1 {
+			t.Fatalf("chunk %d has %d bytes", i, len(c))
+		}
+	}
+	avg := len(data) / len(got)
+	if avg < opts.Avg/2 || avg > opts.Avg*2 {
+		t.Fatalf("average chunk %d bytes, want about %d", avg, opts.Avg)
+	}
+
+	// Boundaries depend on content only, not on how the reader splits it.
+	again := chunks(t, iotest.OneByteReader(bytes.NewReader(data)), opts)
+	if len(again) != len(got) {
+		t.Fatalf("one-byte reads gave %d chunks, want %d", len(again), len(got))
+	}
+
+	if c := chunks(t, bytes.NewReader(nil), opts); len(c) != 0 {
+		t.Fatalf("empty input gave %d chunks", len(c))
+	}
+}
+
+func TestChunkerReadError(t *testing.T) {
+	boom := errors.New("boom")
+	c := NewChunker(io.MultiReader(bytes.NewReader(randomData(2, 1000)), iotest.ErrReader(boom)), ChunkerOptions{})
+	if data, err := c.Next(); err != nil || len(data) != 1000 {
+		t.Fatalf("buffered data: %d bytes, %v", len(data), err)
+	}
+	if _, err := c.Next(); !errors.Is(err, boom) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+// An insertion near the start only changes the chunks around it; fixed-size
+// blocks would all shift.
+func TestShiftResistance(t *testing.T) {
+	data := randomData(3, 2<<20)
+	edited := slices.Concat(data[:1000], []byte("inserted bytes"), data[1000:])
+	opts := ChunkerOptions{Avg: 16 * 1024}
+	seen := map[string]bool{}
+	for _, c := range chunks(t, bytes.NewReader(data), opts) {
+		seen[string(c)] = true
+	}
+	after := chunks(t, bytes.NewReader(edited), opts)
+	shared := 0
+	for _, c := range after {
+		if seen[string(c)] {
+			shared++
+		}
+	}
+	if shared < len(after)-3 {
+		t.Fatalf("only %d of %d chunks survived a 14-byte insert", shared, len(after))
+	}
+}
+
+func TestStore(t *testing.T) {
+	s, err := Open(t.TempDir(), ChunkerOptions{Avg: 16 * 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1 := randomData(4, 1<<20)
+	v2 := slices.Concat(v1[:500_000], []byte("a small edit"), v1[500_000:])
+
+	_, st1, err := s.Put("backups/v1.bin", bytes.NewReader(v1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st1.NewBytes != int64(len(v1)) {
+		t.Fatalf("first put stats %+v", st1)
+	}
+	m2, st2, err := s.Put("backups/v2.bin", bytes.NewReader(v2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st2.NewBytes > int64(len(v2))/10 {
+		t.Fatalf("second version stored %d new bytes of %d", st2.NewBytes, len(v2))
+	}
+	if m2.Size != int64(len(v2)) || len(m2.Chunks) != st2.Chunks {
+		t.Fatalf("manifest %d bytes, %d chunks", m2.Size, len(m2.Chunks))
+	}
+
+	for name, want := range map[string][]byte{"backups/v1.bin": v1, "backups/v2.bin": v2} {
+		var buf bytes.Buffer
+		if err := s.Get(name, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Fatalf("%s did not round-trip", name)
+		}
+	}
+	if names, _ := s.List(); !slices.Equal(names, []string{"backups/v1.bin", "backups/v2.bin"}) {
+		t.Fatalf("List = %v", names)
+	}
+	if _, _, err := s.Put("../escape", bytes.NewReader(nil)); err == nil {
+		t.Fatal("name outside the store accepted")
+	}
+
+	// Deleting v2 frees only its unique chunks.
+	if err := s.Delete("backups/v2.bin"); err != nil {
+		t.Fatal(err)
+	}
+	gc, err := s.GC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gc.Bytes != st2.NewBytes || gc.Chunks != st2.NewChunks {
+		t.Fatalf("GC freed %+v, v2 added %+v", gc, st2)
+	}
+	if err := s.Get("backups/v1.bin", io.Discard); err != nil {
+		t.Fatalf("v1 after GC: %v", err)
+	}
+	if gc, _ := s.GC(); gc.Chunks != 0 {
+		t.Fatalf("second GC freed %+v", gc)
+	}
+}
+
+func TestGetDetectsCorruption(t *testing.T) {
+	s, err := Open(t.TempDir(), ChunkerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _, err := s.Put("f", bytes.NewReader(randomData(5, 300_000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := s.chunkPath(m.Chunks[1].Hash)
+	os.Chmod(path, 0o644)
+	data, _ := os.ReadFile(path)
+	data[10] ^= 1
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Get("f", io.Discard); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestCorruptManifestHash(t *testing.T) {
+	s, err := Open(t.TempDir(), ChunkerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Put("f", bytes.NewReader(randomData(6, 1000))); err != nil {
+		t.Fatal(err)
+	}
+	mpath, _ := s.manifestPath("f")
+	for _, hash := range []string{"a", strings.Repeat("zz", 32), "../../../../etc/passwd"} {
+		b, _ := json.Marshal(Manifest{Name: "f", Chunks: []Chunk{{Hash: hash, Size: 1}}})
+		if err := os.WriteFile(mpath, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Get("f", io.Discard); !errors.Is(err, ErrCorrupt) {
+			t.Fatalf("Get with hash %q: err = %v", hash, err)
+		}
+		if _, err := s.GC(); !errors.Is(err, ErrCorrupt) {
+			t.Fatalf("GC with hash %q: err = %v", hash, err)
+		}
+	}
+}
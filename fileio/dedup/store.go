@@ -0,0 +1,280 @@
+package dedup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gobyexamples/fileio/safeio"
+)
+
+// ErrCorrupt is returned by Get when stored data no longer matches its hash,
+// and when a manifest holds a malformed chunk hash.
+var ErrCorrupt = errors.New("dedup: corrupt data")
+
+// Chunk is one piece of a file, named by the hex SHA-256 of its contents.
+type Chunk struct {
+	Hash string `json:"hash"`
+	Size int    `json:"size"`
+}
+
+// Manifest lists the chunks that make up a stored file, in order.
+type Manifest struct {
+	Name   string  `json:"name"`
+	Size   int64   `json:"size"`
+	SHA256 string  `json:"sha256"` // of the whole file, as 012_chunk_checksum.go prints
+	Chunks []Chunk `json:"chunks"`
+}
+
+// PutStats says how much of a Put was new to the store.
+type PutStats struct {
+	Chunks, NewChunks int
+	Bytes, NewBytes   int64
+}
+
+// GCStats says what GC removed.
+type GCStats struct {
+	Chunks int
+	Bytes  int64
+}
+
+// Store is a content-addressed chunk store in a local directory:
+//
+//	root/chunks/ab/abcdef...   one file per unique chunk
+//	root/manifests/<name>.json one manifest per stored file
+//
+// Files are written with safeio, so a crash never leaves a chunk whose
+// contents do not match its name. A Store is safe for concurrent use by
+// one process; GC waits for in-flight Puts so it cannot collect chunks
+// whose manifest is not written yet.
+type Store struct {
+	root string
+	opts ChunkerOptions
+	mu   sync.RWMutex // Put and Delete share it; GC holds it exclusively
+}
+
+// Open creates root if needed and returns a store that chunks new files
+// with opts. Changing opts later only affects how new data dedups against
+// old; existing manifests stay readable.
+func Open(root string, opts ChunkerOptions) (*Store, error) {
+	for _, dir := range []string{"chunks", "manifests"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &Store{root: root, opts: opts}, nil
+}
+
+func (s *Store) chunkPath(hash string) string {
+	return filepath.Join(s.root, "chunks", hash[:2], hash)
+}
+
+func (s *Store) manifestPath(name string) (string, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return "", fmt.Errorf("dedup: invalid name %q", name)
+	}
+	return filepath.Join(s.root, "manifests", filepath.FromSlash(name)+".json"), nil
+}
+
+// Put chunks r, stores the chunks the store does not have yet and writes
+// the manifest under name (a slash-separated relative path), replacing any
+// previous file of that name.
+func (s *Store) Put(name string, r io.Reader) (Manifest, PutStats, error) {
+	mpath, err := s.manifestPath(name)
+	if err != nil {
+		return Manifest{}, PutStats{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	m := Manifest{Name: name, Chunks: []Chunk{}}
+	var st PutStats
+	whole := sha256.New()
+	c := NewChunker(r, s.opts)
+	for {
+		data, err := c.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Manifest{}, st, err
+		}
+		whole.Write(data)
+		sum := sha256.Sum256(data)
+		ch := Chunk{Hash: hex.EncodeToString(sum[:]), Size: len(data)}
+		m.Chunks = append(m.Chunks, ch)
+		m.Size += int64(len(data))
+		st.Chunks++
+		st.Bytes += int64(len(data))
+
+		path := s.chunkPath(ch.Hash)
+		if _, err := os.Stat(path); err == nil {
+			continue // already stored
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return Manifest{}, st, err
+		}
+		if err := safeio.WriteFileAtomic(path, data, 0o444, safeio.Options{}); err != nil {
+			return Manifest{}, st, err
+		}
+		st.NewChunks++
+		st.NewBytes += int64(len(data))
+	}
+	m.SHA256 = hex.EncodeToString(whole.Sum(nil))
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return Manifest{}, st, err
+	}
+	if err := os.MkdirAll(filepath.Dir(mpath), 0o755); err != nil {
+		return Manifest{}, st, err
+	}
+	if err := safeio.WriteFileAtomic(mpath, b, 0o644, safeio.Options{}); err != nil {
+		return Manifest{}, st, err
+	}
+	return m, st, nil
+}
+
+// Manifest returns the manifest stored under name.
+func (s *Store) Manifest(name string) (Manifest, error) {
+	mpath, err := s.manifestPath(name)
+	if err != nil {
+		return Manifest{}, err
+	}
+	return readManifest(mpath)
+}
+
+func readManifest(path string) (Manifest, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Manifest{}, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return Manifest{}, fmt.Errorf("dedup: manifest %s: %w", path, err)
+	}
+	// Hashes become chunk paths, so a damaged one must not reach chunkPath.
+	for i, ch := range m.Chunks {
+		if !validHash(ch.Hash) {
+			return Manifest{}, fmt.Errorf("%w: manifest %s: chunk %d has hash %q", ErrCorrupt, path, i, ch.Hash)
+		}
+	}
+	return m, nil
+}
+
+// validHash reports whether h is a hex SHA-256 as Put writes it.
+func validHash(h string) bool {
+	if len(h) != 2*sha256.Size {
+		return false
+	}
+	for _, c := range h {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Get reassembles the file stored under name into w, checking every chunk
+// and the whole file against their hashes.
+func (s *Store) Get(name string, w io.Writer) error {
+	m, err := s.Manifest(name)
+	if err != nil {
+		return err
+	}
+	whole := sha256.New()
+	for _, ch := range m.Chunks {
+		data, err := os.ReadFile(s.chunkPath(ch.Hash))
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != ch.Hash {
+			return fmt.Errorf("%w: chunk %s of %s", ErrCorrupt, ch.Hash, name)
+		}
+		whole.Write(data)
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	if hex.EncodeToString(whole.Sum(nil)) != m.SHA256 {
+		return fmt.Errorf("%w: %s", ErrCorrupt, name)
+	}
+	return nil
+}
+
+// Delete removes the manifest stored under name. Its chunks stay until GC.
+func (s *Store) Delete(name string) error {
+	mpath, err := s.manifestPath(name)
+	if err != nil {
+		return err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return os.Remove(mpath)
+}
+
+// List returns the names of the stored files in lexical order.
+func (s *Store) List() ([]string, error) {
+	dir := filepath.Join(s.root, "manifests")
+	var names []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(p, ".json") {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(strings.TrimSuffix(rel, ".json")))
+		return nil
+	})
+	return names, err
+}
+
+// GC deletes every chunk that no manifest references (mark and sweep).
+func (s *Store) GC() (GCStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	live := make(map[string]bool)
+	names, err := s.List()
+	if err != nil {
+		return GCStats{}, err
+	}
+	for _, name := range names {
+		m, err := s.Manifest(name)
+		if err != nil {
+			return GCStats{}, err
+		}
+		for _, ch := range m.Chunks {
+			live[ch.Hash] = true
+		}
+	}
+
+	var st GCStats
+	err = filepath.WalkDir(filepath.Join(s.root, "chunks"), func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || live[d.Name()] {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+		st.Chunks++
+		st.Bytes += fi.Size()
+		return nil
+	})
+	return st, err
+}
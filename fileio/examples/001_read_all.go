@@ -2,17 +2,27 @@ package main
 
 import (
 	"fmt"
-	"os"
+	"io/fs"
+
+	"gobyexamples/fileio/vfs"
 )
 
 func main() {
-	path := "./fileio/examples/sample.txt"
-	_ = os.WriteFile(path, []byte("hello\nworld\n"), 0644)
+	// FILEIO_FS picks the filesystem; the default overlay reads the disk
+	// but keeps writes in memory.
+	fsys, err := vfs.FromEnv()
+	if err != nil {
+		panic(err)
+	}
+	if err := fsys.MkdirAll("fileio/examples", 0755); err != nil {
+		panic(err)
+	}
+	path := "fileio/examples/sample.txt"
+	_ = vfs.WriteFile(fsys, path, []byte("hello\nworld\n"), 0644)
 
-	b, err := os.ReadFile(path)
+	b, err := fs.ReadFile(fsys, path)
 	if err != nil {
 		panic(err)
 	}
 	fmt.Printf("%s", b)
 }
-
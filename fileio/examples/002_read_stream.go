@@ -4,23 +4,27 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"os"
+
+	"gobyexamples/fileio/vfs"
 )
 
 func main() {
-	path := "./fileio/examples/sample_stream.txt"
-	f, err := os.Create(path)
+	fsys, err := vfs.FromEnv()
+	if err != nil { panic(err) }
+	if err := fsys.MkdirAll("fileio/examples", 0755); err != nil { panic(err) }
+	path := "fileio/examples/sample_stream.txt"
+	f, err := fsys.Create(path)
 	if err != nil { panic(err) }
 	for i := 0; i < 5; i++ {
 		fmt.Fprintf(f, "line %d\n", i)
 	}
 	f.Close()
 
-	f, err = os.Open(path)
+	in, err := fsys.Open(path)
 	if err != nil { panic(err) }
-	defer f.Close()
+	defer in.Close()
 
-	r := bufio.NewReader(f)
+	r := bufio.NewReader(in)
 	for {
 		line, err := r.ReadString('\n')
 		if err == io.EOF {
@@ -3,14 +3,18 @@ package main
 import (
 	"bufio"
 	"fmt"
-	"os"
+
+	"gobyexamples/fileio/vfs"
 )
 
 func main() {
-	path := "./fileio/examples/sample_lines.txt"
-	_ = os.WriteFile(path, []byte("first\nsecond\nthird\n"), 0644)
+	fsys, err := vfs.FromEnv()
+	if err != nil { panic(err) }
+	if err := fsys.MkdirAll("fileio/examples", 0755); err != nil { panic(err) }
+	path := "fileio/examples/sample_lines.txt"
+	_ = vfs.WriteFile(fsys, path, []byte("first\nsecond\nthird\n"), 0644)
 
-	f, err := os.Open(path)
+	f, err := fsys.Open(path)
 	if err != nil { panic(err) }
 	defer f.Close()
 
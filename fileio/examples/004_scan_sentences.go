@@ -5,6 +5,9 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+
+	"gobyexamples/fileio/split"
+	"gobyexamples/fileio/vfs"
 )
 
 // sentenceSplit splits on '.', '!' or '?' and trims spaces.
@@ -27,10 +30,13 @@ func sentenceSplit(data []byte, atEOF bool) (advance int, token []byte, err erro
 }
 
 func main() {
-	path := "./fileio/examples/sample_sentences.txt"
-	_ = os.WriteFile(path, []byte("Hello world. How are you? I am fine!"), 0644)
+	fsys, err := vfs.FromEnv()
+	if err != nil { panic(err) }
+	if err := fsys.MkdirAll("fileio/examples", 0755); err != nil { panic(err) }
+	path := "fileio/examples/sample_sentences.txt"
+	_ = vfs.WriteFile(fsys, path, []byte("Hello world. How are you? I am fine! Dr. Smith paid $3.50 for it."), 0644)
 
-	f, err := os.Open(path)
+	f, err := fsys.OpenFile(path, os.O_RDONLY, 0)
 	if err != nil { panic(err) }
 	defer f.Close()
 
@@ -40,5 +46,15 @@ func main() {
 		fmt.Printf("sentence: %q\n", s.Text())
 	}
 	if err := s.Err(); err != nil { panic(err) }
+
+	// sentenceSplit breaks "Dr. Smith" and "$3.50" apart; split.Sentences
+	// knows abbreviations and only ends a sentence before whitespace.
+	if _, err := f.Seek(0, 0); err != nil { panic(err) }
+	s = bufio.NewScanner(f)
+	s.Split(split.Sentences(split.SentenceOptions{}))
+	for s.Scan() {
+		fmt.Printf("split.Sentences: %q\n", s.Text())
+	}
+	if err := s.Err(); err != nil { panic(err) }
 }
 
@@ -2,14 +2,26 @@ package main
 
 import (
 	"fmt"
-	"os"
+	"io/fs"
+
+	"gobyexamples/fileio/safeio"
+	"gobyexamples/fileio/vfs"
 )
 
 func main() {
-	path := "./fileio/examples/out_overwrite.txt"
-	if err := os.WriteFile(path, []byte("initial\n"), 0644); err != nil { panic(err) }
-	if err := os.WriteFile(path, []byte("overwritten\n"), 0644); err != nil { panic(err) }
-	b, _ := os.ReadFile(path)
+	fsys, err := vfs.FromEnv()
+	if err != nil { panic(err) }
+	if err := fsys.MkdirAll("fileio/examples", 0755); err != nil { panic(err) }
+	path := "fileio/examples/out_overwrite.txt"
+	opts := safeio.Options{FS: safeio.FromVFS(fsys)}
+	// os.WriteFile truncates in place: a crash between the truncate and the
+	// write leaves an empty file. WriteFileAtomic renames a synced temp file
+	// over the target, so readers see the old contents or the new, never a mix.
+	if err := safeio.WriteFileAtomic(path, []byte("initial\n"), 0644, opts); err != nil { panic(err) }
+	opts.Backup = true
+	if err := safeio.WriteFileAtomic(path, []byte("overwritten\n"), 0644, opts); err != nil { panic(err) }
+	b, _ := fs.ReadFile(fsys, path)
 	fmt.Printf("%s", b)
+	b, _ = fs.ReadFile(fsys, path+"~") // previous version, kept by Backup
+	fmt.Printf("backup: %s", b)
 }
-
@@ -2,12 +2,18 @@ package main
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
+
+	"gobyexamples/fileio/vfs"
 )
 
 func main() {
-	path := "./fileio/examples/out_append.txt"
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	fsys, err := vfs.FromEnv()
+	if err != nil { panic(err) }
+	if err := fsys.MkdirAll("fileio/examples", 0755); err != nil { panic(err) }
+	path := "fileio/examples/out_append.txt"
+	f, err := fsys.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
 	if err != nil { panic(err) }
 	defer f.Close()
 
@@ -15,7 +21,7 @@ func main() {
 		fmt.Fprintf(f, "line %d\n", i)
 	}
 
-	b, _ := os.ReadFile(path)
+	b, _ := fs.ReadFile(fsys, path)
 	fmt.Printf("%s", b)
 }
 
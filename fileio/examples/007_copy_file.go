@@ -1,26 +1,46 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+
+	"gobyexamples/fileio/copyfile"
+	"gobyexamples/fileio/vfs"
 )
 
 func main() {
-	srcPath := "./fileio/examples/src.txt"
-	dstPath := "./fileio/examples/dst.txt"
-	_ = os.WriteFile(srcPath, []byte("copy me\n"), 0644)
+	fsys, err := vfs.FromEnv()
+	if err != nil { panic(err) }
+	if err := fsys.MkdirAll("fileio/examples", 0755); err != nil { panic(err) }
+	srcPath := "fileio/examples/src.txt"
+	dstPath := "fileio/examples/dst.txt"
+	_ = vfs.WriteFile(fsys, srcPath, []byte("copy me\n"), 0644)
 
-	src, err := os.Open(srcPath)
+	src, err := fsys.Open(srcPath)
 	if err != nil { panic(err) }
 	defer src.Close()
 
-	dst, err := os.Create(dstPath)
+	dst, err := fsys.Create(dstPath)
 	if err != nil { panic(err) }
-	defer dst.Close()
 
 	n, err := io.Copy(dst, src)
 	if err != nil { panic(err) }
+	// Close flushes to the OS and can fail (e.g. disk full on NFS): check it
+	if err := dst.Close(); err != nil { panic(err) }
 	fmt.Println("copied bytes:", n)
-}
 
+	// io.Copy moves bytes only: dst got 0644 from Create and today's mtime.
+	// copyfile also keeps mode and mtime, skips holes and verifies the copy.
+	// It works on real paths, so use a temporary directory.
+	dir, err := os.MkdirTemp("", "fileio-copy-")
+	if err != nil { panic(err) }
+	defer os.RemoveAll(dir)
+	srcPath, dstPath = filepath.Join(dir, "src.txt"), filepath.Join(dir, "dst.txt")
+	if err := os.WriteFile(srcPath, []byte("copy me\n"), 0644); err != nil { panic(err) }
+	st, err := copyfile.File(context.Background(), srcPath, dstPath, copyfile.Options{Verify: true})
+	if err != nil { panic(err) }
+	fmt.Printf("copyfile: %d file, %d bytes, verified\n", st.Files, st.Bytes)
+}
@@ -3,14 +3,18 @@ package main
 import (
 	"bufio"
 	"fmt"
-	"os"
+
+	"gobyexamples/fileio/vfs"
 )
 
 func main() {
-	path := "./fileio/examples/sample_wc.txt"
-	_ = os.WriteFile(path, []byte("alpha beta\ngamma delta alpha\n"), 0644)
+	fsys, err := vfs.FromEnv()
+	if err != nil { panic(err) }
+	if err := fsys.MkdirAll("fileio/examples", 0755); err != nil { panic(err) }
+	path := "fileio/examples/sample_wc.txt"
+	_ = vfs.WriteFile(fsys, path, []byte("alpha beta\ngamma delta alpha\n"), 0644)
 
-	f, err := os.Open(path)
+	f, err := fsys.Open(path)
 	if err != nil { panic(err) }
 	defer f.Close()
 
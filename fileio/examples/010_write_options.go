@@ -3,52 +3,66 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+
+	"gobyexamples/fileio/safeio"
+	"gobyexamples/fileio/vfs"
 )
 
 func must(err error) { if err != nil { panic(err) } }
 
 func main() {
-	// 1) Truncate/overwrite
-	f1, err := os.OpenFile("./fileio/examples/out_trunc.txt", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	fsys, err := vfs.FromEnv()
+	must(err)
+	must(fsys.MkdirAll("fileio/examples", 0755))
+	atomicOpts := safeio.Options{Perm: 0644, FS: safeio.FromVFS(fsys)}
+
+	// 1) Truncate/overwrite, atomically: O_TRUNC empties the file before the
+	// write, so write a temp file and rename it over the target instead
+	f1, err := safeio.NewAtomicWriter("fileio/examples/out_trunc.txt", atomicOpts)
 	must(err)
-	_, err = f1.WriteString("overwritten contents\n")
+	_, err = f1.Write([]byte("overwritten contents\n"))
 	must(err)
-	f1.Close()
+	must(f1.Commit()) // sync, rename, sync dir; Close instead would discard
 
 	// 2) Append
-	f2, err := os.OpenFile("./fileio/examples/out_append_opts.txt", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	f2, err := fsys.OpenFile("fileio/examples/out_append_opts.txt", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	must(err)
 	for i := 0; i < 2; i++ { fmt.Fprintf(f2, "line %d\n", i) }
 	f2.Close()
 
 	// 3) Create new file, fail if exists (O_EXCL)
-	f3, err := os.OpenFile("./fileio/examples/out_new_only.txt", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	f3, err := fsys.OpenFile("fileio/examples/out_new_only.txt", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
 	if err == nil {
 		f3.Write([]byte("first write\n"))
 		f3.Close()
-	} else {
+	} else if errors.Is(err, fs.ErrExist) {
 		fmt.Println("out_new_only.txt already exists; O_EXCL prevented overwrite")
+	} else {
+		panic(err)
 	}
 
-	// 4) Read/Write combination and buffered writer
-	f4, err := os.OpenFile("./fileio/examples/out_buf.txt", os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	// 4) Buffered writer over an atomic writer
+	f4, err := safeio.NewAtomicWriter("fileio/examples/out_buf.txt", atomicOpts)
 	must(err)
+	defer f4.Close() // no-op after Commit
 	bw := bufio.NewWriter(f4)
 	bw.WriteString("hello ")
 	bw.Write([]byte("world\n"))
-	bw.Flush() // important
-	f4.Close()
+	must(bw.Flush()) // important: Commit only installs what reached f4
+	must(f4.Commit())
 
 	// 5) Write []byte via io.Copy from a bytes.Reader
 	data := []byte("copied bytes to file\n")
-	f5, err := os.OpenFile("./fileio/examples/out_copy_bytes.txt", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	f5, err := safeio.NewAtomicWriter("fileio/examples/out_copy_bytes.txt", atomicOpts)
 	must(err)
 	br := bytes.NewReader(data)
 	_, err = br.WriteTo(f5) // equivalent to io.Copy(f5, br)
 	must(err)
-	f5.Close()
+	must(f5.Commit())
 
 	fmt.Println("write options demo complete")
 }
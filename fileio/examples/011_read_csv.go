@@ -3,16 +3,29 @@ package main
 import (
 	"encoding/csv"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+
+	"gobyexamples/fileio/csvmap"
+	"gobyexamples/fileio/vfs"
 )
 
+type person struct {
+	Name string `csv:"name,required"`
+	Age  int    `csv:"age"`
+	City string `csv:"city"`
+}
+
 func main() {
-	path := "./fileio/examples/sample.csv"
+	fsys, err := vfs.FromEnv()
+	if err != nil { panic(err) }
+	if err := fsys.MkdirAll("fileio/examples", 0755); err != nil { panic(err) }
+	path := "fileio/examples/sample.csv"
 	// Create a sample CSV file
-	_ = os.WriteFile(path, []byte("name,age,city\nAlice,30,NY\nBob,25,SF\n"), 0644)
+	_ = vfs.WriteFile(fsys, path, []byte("name,age,city\nAlice,30,NY\nBob,25,SF\n"), 0644)
 
-	f, err := os.Open(path)
+	f, err := fsys.OpenFile(path, os.O_RDONLY, 0)
 	if err != nil { panic(err) }
 	defer f.Close()
 
@@ -29,5 +42,17 @@ func main() {
 		row := records[i]
 		fmt.Printf("row %d: name=%s age=%s city=%s\n", i, row[0], row[1], row[2])
 	}
-}
 
+	// Streaming by header name: column order no longer matters, age is
+	// converted to int, and a bad cell reports its line and column.
+	if _, err := f.Seek(0, io.SeekStart); err != nil { panic(err) }
+	dec, err := csvmap.NewDecoder[person](f, csvmap.Options{TrimSpace: true})
+	if err != nil { panic(err) }
+	for {
+		var p person
+		err := dec.Decode(&p)
+		if err == io.EOF { break }
+		if err != nil { panic(err) }
+		fmt.Printf("person: %+v\n", p)
+	}
+}
@@ -4,12 +4,16 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"io"
-	"os"
+
+	"gobyexamples/fileio/vfs"
 )
 
 func main() {
-	path := "./fileio/examples/large.txt"
-	f, err := os.Create(path)
+	fsys, err := vfs.FromEnv()
+	if err != nil { panic(err) }
+	if err := fsys.MkdirAll("fileio/examples", 0755); err != nil { panic(err) }
+	path := "fileio/examples/large.txt"
+	f, err := fsys.Create(path)
 	if err != nil { panic(err) }
 	// Write ~1MB sample
 	for i := 0; i < 1024; i++ {
@@ -17,14 +21,14 @@ func main() {
 	}
 	f.Close()
 
-	f, err = os.Open(path)
+	in, err := fsys.Open(path)
 	if err != nil { panic(err) }
-	defer f.Close()
+	defer in.Close()
 
 	h := sha256.New()
 	buf := make([]byte, 64*1024) // 64KB chunk buffer
 	for {
-		n, err := f.Read(buf)
+		n, err := in.Read(buf)
 		if n > 0 {
 			if _, werr := h.Write(buf[:n]); werr != nil { panic(werr) }
 		}
@@ -2,20 +2,32 @@ package main
 
 import (
 	"fmt"
-	"os"
 	"time"
+
+	"gobyexamples/fileio/fdcheck"
 )
 
 // BAD: deferring Close inside a loop leaks file descriptors until the function returns.
 func main() {
+	before, err := fdcheck.Snapshot()
+	if err != nil { panic(err) } // Linux only: reads /proc/self/fd
 	for i := 0; i < 100; i++ {
-		f, err := os.CreateTemp("", "leak-*.txt")
+		f, err := fdcheck.CreateTemp("", "leak-*.txt") // os.CreateTemp that records who opened it
 		if err != nil { panic(err) }
 		defer f.Close() // BAD: defers all 100 closes until main returns
 		fmt.Fprintf(f, "record %d\n", i)
 	}
 
 	fmt.Println("Created 100 temp files with deferred closes (bad). On Unix, you could run 'lsof -p <pid>' now to observe many open files.")
+
+	// fdcheck sees the same thing from inside the process.
+	leaked, err := fdcheck.Leaked(before, nil)
+	if err != nil { panic(err) }
+	if len(leaked) == 0 {
+		fmt.Println("fdcheck: no descriptors left open")
+	} else {
+		fmt.Printf("fdcheck: %d descriptors still open, e.g. fd %d: %s\nopened by:\n%s", len(leaked), leaked[0].Num, leaked[0].Target, leaked[0].Stack)
+	}
 	time.Sleep(2 * time.Second) // Give you a moment to inspect with external tools
 }
 
@@ -3,10 +3,14 @@ package main
 import (
 	"fmt"
 	"os"
+
+	"gobyexamples/fileio/fdcheck"
 )
 
 // GOOD: close each file at end of each iteration to avoid leaks.
 func main() {
+	before, err := fdcheck.Snapshot()
+	if err != nil { panic(err) } // Linux only: reads /proc/self/fd
 	for i := 0; i < 100; i++ {
 		f, err := os.CreateTemp("", "noleak-*.txt")
 		if err != nil { panic(err) }
@@ -14,5 +18,9 @@ func main() {
 		f.Close() // explicit close per iteration
 	}
 	fmt.Println("Created and closed 100 temp files safely.")
+
+	leaked, err := fdcheck.Leaked(before, nil)
+	if err != nil { panic(err) }
+	fmt.Printf("fdcheck: %d descriptors leaked\n", len(leaked))
 }
 
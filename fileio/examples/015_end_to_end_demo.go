@@ -4,18 +4,22 @@ import (
 	"fmt"
 	"io"
 	"os"
+
+	"gobyexamples/fileio/vfs"
 )
 
 func main() {
+	fsys, err := vfs.FromEnv()
+	must(err)
 	path := "demo_file.txt"
 
 	// 1) Open (create if missing) for read+write; truncate to start clean.
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o644)
+	f, err := fsys.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o644)
 	must(err)
 	defer f.Close()
 
 	// 2) Write some bytes.
-	n, err := f.WriteString("Hello, file!\nThis is a second line.\n")
+	n, err := io.WriteString(f, "Hello, file!\nThis is a second line.\n")
 	must(err)
 	fmt.Printf("wrote %d bytes\n", n)
 
@@ -38,7 +42,7 @@ func main() {
 	// 5) Seek to end and append more data.
 	_, err = f.Seek(0, io.SeekEnd)
 	must(err)
-	_, err = f.WriteString("APPENDED\n")
+	_, err = io.WriteString(f, "APPENDED\n")
 	must(err)
 
 	// 6) Re-read to confirm final contents.
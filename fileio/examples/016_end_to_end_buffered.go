@@ -5,13 +5,17 @@ import (
 	"fmt"
 	"io"
 	"os"
+
+	"gobyexamples/fileio/vfs"
 )
 
 func main() {
+	fsys, err := vfs.FromEnv()
+	must(err)
 	path := "demo_buffered.txt"
 
 	// 1) Open (create if missing) for read+write; truncate to start clean.
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o644)
+	f, err := fsys.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o644)
 	must(err)
 	defer f.Close()
 
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+
+	"gobyexamples/fileio/textstats"
+)
+
+// Run with: go run ./fileio/examples/wc -top 10 -fold -stop 'fileio/examples/*.go'
+// A wc that counts many files in parallel: 009_word_count.go grown up.
+
+func main() {
+	var (
+		lines   = flag.Bool("l", false, "print line counts")
+		words   = flag.Bool("w", false, "print word counts")
+		bytes   = flag.Bool("c", false, "print byte counts")
+		runes   = flag.Bool("m", false, "print rune (character) counts")
+		top     = flag.Int("top", 0, "also print the `n` most frequent words")
+		fold    = flag.Bool("fold", false, "case-fold words before counting them")
+		stop    = flag.Bool("stop", false, "leave common English words out of -top")
+		jobs    = flag.Int("j", 0, "files counted at once (default: number of CPUs)")
+		asJSON  = flag.Bool("json", false, "print the report as JSON")
+		stopExt = flag.String("stopwords", "", "comma-separated extra stop words")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: wc [flags] file|glob...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if !*lines && !*words && !*bytes && !*runes {
+		*lines, *words, *bytes = true, true, true // wc's default columns
+	}
+
+	opts := textstats.Options{Workers: *jobs, TopN: *top, Fold: *fold}
+	if *stop {
+		opts.StopWords = textstats.DefaultStopWords
+	}
+	if *stopExt != "" {
+		opts.StopWords = append(opts.StopWords, strings.Split(*stopExt, ",")...)
+	}
+
+	paths, err := textstats.Expand(flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "wc:", err)
+		os.Exit(2)
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	rep, err := textstats.Run(ctx, paths, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "wc:", err)
+		os.Exit(1)
+	}
+
+	status := 0
+	for _, f := range rep.Files {
+		if f.Err != nil {
+			fmt.Fprintln(os.Stderr, "wc:", f.Err)
+			status = 1
+		}
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(rep); err != nil {
+			fmt.Fprintln(os.Stderr, "wc:", err)
+			os.Exit(1)
+		}
+		os.Exit(status)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.AlignRight)
+	row := func(c textstats.Counts, name string) {
+		for _, col := range []struct {
+			on bool
+			n  int64
+		}{{*lines, c.Lines}, {*words, c.Words}, {*runes, c.Runes}, {*bytes, c.Bytes}} {
+			if col.on {
+				fmt.Fprintf(tw, "%d\t", col.n)
+			}
+		}
+		fmt.Fprintf(tw, " %s\n", name)
+	}
+	for _, f := range rep.Files {
+		if f.Err == nil {
+			row(f.Counts, f.Path)
+		}
+	}
+	if len(rep.Files) > 1 {
+		row(rep.Total, "total")
+	}
+	tw.Flush()
+
+	if len(rep.Top) > 0 {
+		fmt.Println()
+		for i, w := range rep.Top {
+			fmt.Printf("%3d. %-20s %d\n", i+1, w.Word, w.Count)
+		}
+	}
+	os.Exit(status)
+}
@@ -0,0 +1,265 @@
+// Package fdcheck fails tests that leave file descriptors open.
+//
+// fileio/examples/013_fd_leak_bad.go leaks a descriptor per loop iteration
+// and nothing notices until the process hits its limit. VerifyNone lists
+// the process's open descriptors (from /proc/self/fd) when a test starts
+// and again at cleanup, and reports any new ones with what they point at:
+//
+//	func TestImport(t *testing.T) {
+//		fdcheck.VerifyNone(t)
+//		...
+//	}
+//
+// Files opened through fdcheck.Open, OpenFile, Create or CreateTemp
+// instead of their os counterparts are also reported with the stack that
+// opened them, which is usually enough to find the missing Close. Use the
+// wrappers in tests and debug builds; they cost a stack capture per open.
+//
+// Only Linux has /proc/self/fd. Elsewhere the checks log that they are
+// unsupported and pass. Like leakcheck, do not combine with t.Parallel.
+package fdcheck
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// DefaultTimeout is how long VerifyNone waits for descriptors to close,
+// for code that closes them from another goroutine.
+const DefaultTimeout = time.Second
+
+// Options tunes the check. The zero value uses DefaultTimeout and the
+// built-in benign list.
+type Options struct {
+	Timeout time.Duration
+	// Ignore lists target prefixes (as in FD.Target) that are not
+	// reported, such as "socket:" for a test that keeps a listener.
+	Ignore []string
+}
+
+// benign are descriptors the Go runtime opens once, on first use of the
+// network poller, and keeps for the life of the process.
+var benign = []string{
+	"anon_inode:[eventpoll]",
+	"anon_inode:[eventfd]",
+}
+
+// FD is one open descriptor.
+type FD struct {
+	Num int
+	// Target is what /proc/self/fd/Num links to: a path (with
+	// " (deleted)" if it was removed), or "socket:[inode]", "pipe:[inode]"
+	// and so on.
+	Target string
+	// Stack is where it was opened, if that was through this package.
+	Stack string
+}
+
+// opener is what the wrappers remember about a file they opened.
+type opener struct {
+	path string // absolute, symlinks resolved
+	pcs  []uintptr
+}
+
+var (
+	mu      sync.Mutex
+	openers = map[int]opener{} // by descriptor number
+)
+
+// Open is os.Open, remembering the caller's stack for leak reports.
+func Open(name string) (*os.File, error) {
+	return track(os.Open(name))
+}
+
+// OpenFile is os.OpenFile, remembering the caller's stack.
+func OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	return track(os.OpenFile(name, flag, perm))
+}
+
+// Create is os.Create, remembering the caller's stack.
+func Create(name string) (*os.File, error) {
+	return track(os.Create(name))
+}
+
+// CreateTemp is os.CreateTemp, remembering the caller's stack.
+func CreateTemp(dir, pattern string) (*os.File, error) {
+	return track(os.CreateTemp(dir, pattern))
+}
+
+func track(f *os.File, err error) (*os.File, error) {
+	if err != nil {
+		return f, err
+	}
+	pcs := make([]uintptr, 32)
+	pcs = pcs[:runtime.Callers(3, pcs)] // skip Callers, track and the wrapper
+	path, err := filepath.Abs(f.Name())
+	if err == nil {
+		if real, err := filepath.EvalSymlinks(path); err == nil {
+			path = real
+		}
+	}
+	// SyscallConn, unlike Fd, leaves the file in non-blocking mode.
+	if rc, err := f.SyscallConn(); err == nil {
+		rc.Control(func(fd uintptr) {
+			mu.Lock()
+			openers[int(fd)] = opener{path: path, pcs: pcs}
+			mu.Unlock()
+		})
+	}
+	return f, nil
+}
+
+// stackFor returns the recorded stack for fd if it was opened through a
+// wrapper and still refers to the same file. Descriptor numbers are reused
+// after Close, so a stale entry for a different target is not trusted.
+func stackFor(fd FD) string {
+	mu.Lock()
+	o, ok := openers[fd.Num]
+	mu.Unlock()
+	if !ok || o.path != strings.TrimSuffix(fd.Target, " (deleted)") {
+		return ""
+	}
+	var b strings.Builder
+	frames := runtime.CallersFrames(o.pcs)
+	for {
+		f, more := frames.Next()
+		if strings.HasPrefix(f.Function, "testing.") || strings.HasPrefix(f.Function, "runtime.") {
+			break
+		}
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", f.Function, f.File, f.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+// Snapshot returns the descriptors open now, lowest first. It fails with
+// errors.ErrUnsupported where there is no /proc/self/fd.
+func Snapshot() ([]FD, error) {
+	fds, err := listFDs()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(fds, func(i, j int) bool { return fds[i].Num < fds[j].Num })
+	return fds, nil
+}
+
+// Leaked returns descriptors open now that were not in before (same
+// number and target) and are not benign or ignored, with their opening
+// stacks where known.
+func Leaked(before []FD, ignore []string) ([]FD, error) {
+	now, err := Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[FD]bool, len(before))
+	for _, fd := range before {
+		seen[FD{Num: fd.Num, Target: fd.Target}] = true
+	}
+	var out []FD
+	for _, fd := range now {
+		if seen[fd] || hasPrefix(fd.Target, benign) || hasPrefix(fd.Target, ignore) {
+			continue
+		}
+		fd.Stack = stackFor(fd)
+		out = append(out, fd)
+	}
+	return out, nil
+}
+
+func hasPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyNone records the open descriptors and registers a cleanup that
+// fails t if new ones are still open after DefaultTimeout.
+func VerifyNone(t testing.TB) { Verify(t, Options{}) }
+
+// Verify is VerifyNone with options.
+func Verify(t testing.TB, opts Options) {
+	t.Helper()
+	before, err := Snapshot()
+	if err != nil {
+		t.Logf("fdcheck: %v; not checking for leaks", err)
+		return
+	}
+	t.Cleanup(func() {
+		leaked, err := waitForClose(before, opts)
+		switch {
+		case err != nil:
+			t.Error(err)
+		case len(leaked) > 0:
+			t.Error(Report(leaked))
+		}
+	})
+}
+
+// VerifyTestMain runs the package's tests and then fails the binary if any
+// descriptor opened during the run is still open. Use it from TestMain:
+//
+//	func TestMain(m *testing.M) { fdcheck.VerifyTestMain(m, fdcheck.Options{}) }
+func VerifyTestMain(m *testing.M, opts Options) {
+	before, err := Snapshot()
+	code := m.Run()
+	if code == 0 && err == nil {
+		leaked, err := waitForClose(before, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+		} else if len(leaked) > 0 {
+			fmt.Fprintln(os.Stderr, Report(leaked))
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+// waitForClose polls with exponential backoff until nothing leaks or the
+// timeout passes, returning whatever is still open.
+func waitForClose(before []FD, opts Options) ([]FD, error) {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	delay := time.Millisecond
+	for {
+		leaked, err := Leaked(before, opts.Ignore)
+		if err != nil || len(leaked) == 0 || time.Now().After(deadline) {
+			return leaked, err
+		}
+		time.Sleep(delay)
+		if delay < 100*time.Millisecond {
+			delay *= 2
+		}
+	}
+}
+
+// Report formats leaked descriptors, with the stack that opened each one
+// where it is known.
+func Report(leaked []FD) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "fdcheck: %d leaked file descriptor(s)\n", len(leaked))
+	for _, fd := range leaked {
+		fmt.Fprintf(&b, "\nfd %d: %s\n", fd.Num, fd.Target)
+		if fd.Stack != "" {
+			fmt.Fprintf(&b, "opened by:\n%s", fd.Stack)
+		} else {
+			b.WriteString("(not opened through fdcheck; use fdcheck.Open to see where)\n")
+		}
+	}
+	return b.String()
+}
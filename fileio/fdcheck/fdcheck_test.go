@@ -0,0 +1,197 @@
+package fdcheck
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recorder captures what Verify reports instead of failing the real test.
+type recorder struct {
+	testing.TB
+	errs     []string
+	cleanups []func()
+}
+
+func (r *recorder) Helper()           {}
+func (r *recorder) Cleanup(f func())  { r.cleanups = append(r.cleanups, f) }
+func (r *recorder) Error(args ...any) { r.errs = append(r.errs, fmt.Sprint(args...)) }
+func (r *recorder) runCleanups() {
+	for _, f := range r.cleanups {
+		f()
+	}
+}
+func (r *recorder) failed() (bool, string) { return len(r.errs) > 0, strings.Join(r.errs, "\n") }
+
+func skipUnlessLinux(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("needs /proc/self/fd")
+	}
+}
+
+// childEnv names the file a re-executed test binary should leak, under
+// VerifyTestMain; see TestVerifyTestMain.
+const childEnv = "FDCHECK_TEST_LEAK"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(childEnv) != "" {
+		VerifyTestMain(m, Options{Timeout: 20 * time.Millisecond})
+	}
+	os.Exit(m.Run())
+}
+
+//go:noinline
+func leakyOpen(path string) (*os.File, error) { return Open(path) }
+
+func TestReportsLeakWithStack(t *testing.T) {
+	skipUnlessLinux(t)
+	path := filepath.Join(t.TempDir(), "data.txt")
+	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r := &recorder{TB: t}
+	Verify(r, Options{Timeout: 20 * time.Millisecond})
+
+	tracked, err := leakyOpen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracked.Close()
+	untracked, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer untracked.Close()
+	r.runCleanups()
+
+	failed, msg := r.failed()
+	if !failed || !strings.Contains(msg, "2 leaked file descriptor(s)") {
+		t.Fatalf("leaks not reported:\n%s", msg)
+	}
+	if !strings.Contains(msg, path) || !strings.Contains(msg, "fdcheck.leakyOpen") || !strings.Contains(msg, "fdcheck_test.go") {
+		t.Fatalf("report lacks the path or the opening stack:\n%s", msg)
+	}
+	if !strings.Contains(msg, "not opened through fdcheck") {
+		t.Fatalf("untracked file not flagged as such:\n%s", msg)
+	}
+}
+
+// A descriptor number reused by a later, untracked open must not be
+// blamed on the earlier tracked one.
+func TestReusedNumberNotMisattributed(t *testing.T) {
+	skipUnlessLinux(t)
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	os.WriteFile(a, nil, 0o644)
+	os.WriteFile(b, nil, 0o644)
+	before, err := Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := Open(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	g, err := os.Open(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	leaked, err := Leaked(before, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaked) != 1 || !strings.HasSuffix(leaked[0].Target, "/b") || leaked[0].Stack != "" {
+		t.Fatalf("leaked = %+v", leaked)
+	}
+}
+
+func TestWaitsForLateClose(t *testing.T) {
+	skipUnlessLinux(t)
+	r := &recorder{TB: t}
+	Verify(r, Options{Timeout: time.Second})
+	f, err := CreateTemp(t.TempDir(), "late-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		f.Close()
+	}()
+	r.runCleanups()
+	if failed, msg := r.failed(); failed {
+		t.Fatalf("reported a file closed in time:\n%s", msg)
+	}
+}
+
+func TestIgnore(t *testing.T) {
+	skipUnlessLinux(t)
+	r := &recorder{TB: t}
+	dir := t.TempDir()
+	Verify(r, Options{Timeout: 20 * time.Millisecond, Ignore: []string{dir}})
+	f, err := Create(filepath.Join(dir, "kept"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r.runCleanups()
+	if failed, msg := r.failed(); failed {
+		t.Fatalf("ignored file reported:\n%s", msg)
+	}
+}
+
+func TestCleanTestPasses(t *testing.T) {
+	VerifyNone(t)
+	f, err := Create(filepath.Join(t.TempDir(), "closed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+}
+
+// TestLeakInChild only does something in the child binary started by
+// TestVerifyTestMain.
+func TestLeakInChild(t *testing.T) {
+	path := os.Getenv(childEnv)
+	if path == "" || path == "-" {
+		t.Skip("run by TestVerifyTestMain")
+	}
+	if _, err := leakyOpen(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// VerifyTestMain exits, so run it in a child copy of this test binary.
+func TestVerifyTestMain(t *testing.T) {
+	skipUnlessLinux(t)
+	path := filepath.Join(t.TempDir(), "leaked.txt")
+	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	child := func(leak string) (string, error) {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestLeakInChild$")
+		cmd.Env = append(os.Environ(), childEnv+"="+leak)
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+
+	out, err := child(path)
+	var exit *exec.ExitError
+	if !errors.As(err, &exit) || exit.ExitCode() == 0 {
+		t.Fatalf("leaking run exited with %v, want a non-zero exit:\n%s", err, out)
+	}
+	if !strings.Contains(out, "1 leaked file descriptor(s)") || !strings.Contains(out, path) || !strings.Contains(out, "fdcheck.leakyOpen") {
+		t.Fatalf("report lacks the count, path or stack:\n%s", out)
+	}
+
+	if out, err := child("-"); err != nil {
+		t.Fatalf("clean run failed: %v\n%s", err, out)
+	}
+}
@@ -0,0 +1,36 @@
+package fdcheck
+
+import (
+	"os"
+	"strconv"
+)
+
+func listFDs() ([]FD, error) {
+	dir, err := os.Open("/proc/self/fd")
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+	// Reading the directory needs a descriptor of its own; leave it out.
+	self := -1
+	if rc, err := dir.SyscallConn(); err == nil {
+		rc.Control(func(fd uintptr) { self = int(fd) })
+	}
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+	fds := make([]FD, 0, len(names))
+	for _, name := range names {
+		n, err := strconv.Atoi(name)
+		if err != nil || n == self {
+			continue
+		}
+		target, err := os.Readlink("/proc/self/fd/" + name)
+		if err != nil {
+			continue // closed since the listing
+		}
+		fds = append(fds, FD{Num: n, Target: target})
+	}
+	return fds, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package fdcheck
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+func listFDs() ([]FD, error) {
+	return nil, fmt.Errorf("fdcheck: listing descriptors on %s: %w", runtime.GOOS, errors.ErrUnsupported)
+}
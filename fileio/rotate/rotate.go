@@ -0,0 +1,356 @@
+// Package rotate provides a log file writer that rolls over by size or by
+// time and prunes old backups.
+//
+// fileio/examples/006_append.go appends to one file forever. A Writer
+// appends the same way, but when the file would pass MaxSize, or Interval
+// has elapsed, it renames the file to a timestamped backup and starts a new
+// one. Backups beyond MaxBackups or older than MaxAge are deleted, and with
+// Compress they are gzipped, all on a background goroutine so Write never
+// waits for it.
+//
+// A Writer is an io.WriteCloser safe for concurrent use, so it can be the
+// output of a log/slog handler:
+//
+//	w, _ := rotate.Open("app.log", rotate.Options{MaxSize: 10 << 20, MaxBackups: 5})
+//	logger := slog.New(slog.NewJSONHandler(w, nil))
+package rotate
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gobyexamples/fileio/safeio"
+	"gobyexamples/goroutine/clock"
+)
+
+// ErrClosed is returned by Write and Rotate after Close.
+var ErrClosed = errors.New("rotate: writer closed")
+
+// timeLayout is used in backup names: app.log becomes
+// app-2006-01-02T15-04-05.000.log. It sorts lexically and has no colons.
+const timeLayout = "2006-01-02T15-04-05.000"
+
+// Options configures a Writer. The zero value rotates at 100MB, never by
+// time, and keeps every backup uncompressed.
+type Options struct {
+	MaxSize int64
+	// Interval > 0 also rotates when the clock crosses a multiple of
+	// Interval (so 24h rotates at midnight UTC), checked on each Write.
+	Interval time.Duration
+	// MaxBackups > 0 keeps only that many of the newest backups.
+	MaxBackups int
+	// MaxAge > 0 deletes backups older than that.
+	MaxAge time.Duration
+	// Compress gzips backups after rotation, as name.gz.
+	Compress bool
+	Perm     fs.FileMode // of the log file; default 0644
+	Clock    clock.Clock // nil means real time
+}
+
+// Writer is a rotating log file. Create it with Open.
+type Writer struct {
+	path string
+	opts Options
+
+	mu     sync.Mutex
+	f      *os.File // nil if reopening after a failed rotation also failed
+	size   int64
+	next   time.Time // next interval boundary; zero without Interval
+	closed bool
+
+	mill    chan struct{} // wakes the background goroutine; cap 1
+	millErr error         // guarded by mu
+	wg      sync.WaitGroup
+
+	rename func(oldpath, newpath string) error // os.Rename; replaced in tests
+}
+
+// Open opens path for appending, creating it if needed, and starts the
+// background goroutine that compresses and prunes backups. Close stops it.
+func Open(path string, opts Options) (*Writer, error) {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = 100 << 20
+	}
+	if opts.Perm == 0 {
+		opts.Perm = 0o644
+	}
+	if opts.Clock == nil {
+		opts.Clock = clock.RealClock{}
+	}
+	w := &Writer{path: path, opts: opts, mill: make(chan struct{}, 1), rename: os.Rename}
+	if err := w.openFile(); err != nil {
+		return nil, err
+	}
+	w.wg.Add(1)
+	go w.millLoop()
+	w.wake() // tidy backups left by an earlier run
+	return w, nil
+}
+
+func (w *Writer) openFile() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, w.opts.Perm)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.f, w.size = f, fi.Size()
+	if w.opts.Interval > 0 {
+		w.next = w.opts.Clock.Now().Truncate(w.opts.Interval).Add(w.opts.Interval)
+	}
+	return nil
+}
+
+// Write appends p to the current file, rotating first if p would take it
+// past MaxSize or an interval boundary has passed. p is never split across
+// files; a p larger than MaxSize gets a file to itself.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, ErrClosed
+	}
+	if w.f == nil {
+		if err := w.openFile(); err != nil {
+			return 0, err
+		}
+	}
+	due := !w.next.IsZero() && !w.opts.Clock.Now().Before(w.next)
+	if due || w.size > 0 && w.size+int64(len(p)) > w.opts.MaxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Rotate starts a new file now, as on SIGHUP.
+func (w *Writer) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	return w.rotate()
+}
+
+// rotate always leaves a file open at path if it can: when the backup
+// cannot be made, the writer keeps appending to the current file and
+// reports the error, rather than holding a closed file for good.
+func (w *Writer) rotate() error {
+	var err error
+	if w.f != nil {
+		err = w.f.Close()
+		w.f = nil
+	}
+	if err == nil {
+		err = w.moveAside()
+	}
+	if oerr := w.openFile(); oerr != nil {
+		return errors.Join(err, oerr)
+	}
+	if err != nil {
+		return err
+	}
+	w.wake()
+	return nil
+}
+
+// moveAside renames the current file to a fresh backup name.
+func (w *Writer) moveAside() error {
+	backup, err := w.backupName(w.opts.Clock.Now())
+	if err != nil {
+		return err
+	}
+	if err := w.rename(w.path, backup); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// backupName returns an unused backup name for time t, adding -1, -2 ...
+// when several rotations land in the same millisecond.
+func (w *Writer) backupName(t time.Time) (string, error) {
+	dir, prefix, ext := w.parts()
+	stamp := t.UTC().Format(timeLayout)
+	for i := 0; ; i++ {
+		name := prefix + stamp
+		if i > 0 {
+			name += "-" + strconv.Itoa(i)
+		}
+		path := filepath.Join(dir, name+ext)
+		_, err1 := os.Lstat(path)
+		_, err2 := os.Lstat(path + ".gz")
+		if errors.Is(err1, fs.ErrNotExist) && errors.Is(err2, fs.ErrNotExist) {
+			return path, nil
+		}
+		if err1 != nil && !errors.Is(err1, fs.ErrNotExist) {
+			return "", err1
+		}
+	}
+}
+
+// parts splits dir/app.log into dir, "app-" and ".log".
+func (w *Writer) parts() (dir, prefix, ext string) {
+	dir, base := filepath.Split(w.path)
+	ext = filepath.Ext(base)
+	return filepath.Clean(dir), strings.TrimSuffix(base, ext) + "-", ext
+}
+
+// Close closes the current file and waits for compression and pruning
+// to finish. It reports the first error the background work hit.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrClosed
+	}
+	w.closed = true
+	var err error
+	if w.f != nil {
+		err = w.f.Close()
+	}
+	close(w.mill)
+	w.mu.Unlock()
+
+	w.wg.Wait()
+	return errors.Join(err, w.millErr)
+}
+
+func (w *Writer) wake() {
+	select {
+	case w.mill <- struct{}{}:
+	default: // already pending
+	}
+}
+
+// millLoop compresses and prunes until Close. A wake that arrives while
+// it is working is kept in the channel and causes one more pass.
+func (w *Writer) millLoop() {
+	defer w.wg.Done()
+	for range w.mill {
+		if err := w.millOnce(); err != nil {
+			w.mu.Lock()
+			if w.millErr == nil {
+				w.millErr = err
+			}
+			w.mu.Unlock()
+		}
+	}
+}
+
+// Backup is a rotated file, as listed by Backups.
+type Backup struct {
+	Path string
+	Time time.Time // when it was rotated, to the millisecond
+	seq  int
+}
+
+// Backups lists the rotated files of path, newest first.
+func (w *Writer) Backups() ([]Backup, error) {
+	dir, prefix, ext := w.parts()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []Backup
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		mid := strings.TrimSuffix(strings.TrimSuffix(name[len(prefix):], ".gz"), ext)
+		if len(mid) < len(timeLayout) {
+			continue
+		}
+		t, err := time.Parse(timeLayout, mid[:len(timeLayout)])
+		if err != nil {
+			continue
+		}
+		seq := 0
+		if rest := mid[len(timeLayout):]; rest != "" {
+			if seq, err = strconv.Atoi(strings.TrimPrefix(rest, "-")); err != nil || rest[0] != '-' {
+				continue
+			}
+		}
+		out = append(out, Backup{Path: filepath.Join(dir, name), Time: t, seq: seq})
+	}
+	slices.SortFunc(out, func(a, b Backup) int {
+		if c := b.Time.Compare(a.Time); c != 0 {
+			return c
+		}
+		return b.seq - a.seq
+	})
+	return out, nil
+}
+
+func (w *Writer) millOnce() error {
+	backups, err := w.Backups()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	now := w.opts.Clock.Now()
+	kept := 0
+	for _, b := range backups {
+		old := w.opts.MaxAge > 0 && now.Sub(b.Time) > w.opts.MaxAge
+		if old || w.opts.MaxBackups > 0 && kept >= w.opts.MaxBackups {
+			if err := os.Remove(b.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		kept++
+		if w.opts.Compress && !strings.HasSuffix(b.Path, ".gz") {
+			errs = append(errs, compress(b.Path))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// compress writes path.gz atomically, then removes path. A crash in
+// between leaves both, and the next pass compresses again.
+func compress(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := safeio.NewAtomicWriter(path+".gz", safeio.Options{Perm: fi.Mode().Perm()})
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	zw := gzip.NewWriter(dst)
+	zw.Name = filepath.Base(path)
+	zw.ModTime = fi.ModTime()
+	if _, err := io.Copy(zw, src); err != nil {
+		return fmt.Errorf("rotate: compress %s: %w", path, err)
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := dst.Commit(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
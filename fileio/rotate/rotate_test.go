@@ -0,0 +1,212 @@
+package rotate
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gobyexamples/goroutine/clock"
+	"gobyexamples/goroutine/leakcheck"
+)
+
+func readAll(t *testing.T, path string) string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = zr
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestSizeRotationAndPruning(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	clk := clock.NewFake(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	w, err := Open(path, Options{MaxSize: 10, MaxBackups: 2, Clock: clk})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 5 {
+		fmt.Fprintf(w, "line %d\n", i) // 7 bytes: one per file
+		clk.Advance(time.Second)
+	}
+	if _, err := w.Write([]byte("this write is longer than MaxSize\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("x")); !errors.Is(err, ErrClosed) {
+		t.Fatalf("write after close: %v", err)
+	}
+
+	if got := readAll(t, path); got != "this write is longer than MaxSize\n" {
+		t.Fatalf("current file %q", got)
+	}
+	backups, err := w.Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("%d backups kept, want 2", len(backups))
+	}
+	if base := filepath.Base(backups[0].Path); base != "app-2026-01-02T03-04-10.000.log" {
+		t.Fatalf("newest backup %s", base)
+	}
+	if got := readAll(t, backups[0].Path) + readAll(t, backups[1].Path); got != "line 4\nline 3\n" {
+		t.Fatalf("backups hold %q", got)
+	}
+}
+
+func TestRotateFailureKeepsWriting(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	path := filepath.Join(t.TempDir(), "app.log")
+	clk := clock.NewFake(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	w, err := Open(path, Options{MaxSize: 10, Clock: clk})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	errRename := errors.New("rename failed")
+	w.rename = func(string, string) error { return errRename }
+
+	if _, err := w.Write([]byte("one\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Rotate(); !errors.Is(err, errRename) {
+		t.Fatalf("Rotate = %v, want the rename error", err)
+	}
+	if _, err := w.Write([]byte("two\n")); err != nil {
+		t.Fatalf("write after failed rotation: %v", err)
+	}
+	if got := readAll(t, path); got != "one\ntwo\n" {
+		t.Fatalf("current file %q", got)
+	}
+
+	w.rename = os.Rename
+	if err := w.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	backups, err := w.Backups()
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("Backups = %v, %v", backups, err)
+	}
+	if got := readAll(t, backups[0].Path); got != "one\ntwo\n" {
+		t.Fatalf("backup holds %q", got)
+	}
+}
+
+func TestIntervalAgeAndCompress(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	clk := clock.NewFake(time.Date(2026, 1, 1, 23, 0, 0, 0, time.UTC))
+	w, err := Open(path, Options{Interval: 24 * time.Hour, MaxAge: 36 * time.Hour, Compress: true, Clock: clk})
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "day 1\n")
+	clk.Advance(30 * time.Minute)
+	io.WriteString(w, "still day 1\n")
+	clk.Advance(time.Hour) // past midnight
+	io.WriteString(w, "day 2\n")
+	clk.Advance(24 * time.Hour)
+	io.WriteString(w, "day 3\n")
+	clk.Advance(24 * time.Hour)
+	io.WriteString(w, "day 4\n")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, _ := w.Backups()
+	var got []string
+	for _, b := range backups {
+		if !strings.HasSuffix(b.Path, ".log.gz") {
+			t.Fatalf("backup %s not compressed", b.Path)
+		}
+		got = append(got, filepath.Base(b.Path)+": "+readAll(t, b.Path))
+	}
+	// The day 1 backup was rotated 48h before the last one and has aged out.
+	want := "app-2026-01-04T00-30-00.000.log.gz: day 3\n|app-2026-01-03T00-30-00.000.log.gz: day 2\n"
+	if strings.Join(got, "|") != want {
+		t.Fatalf("backups:\n%s\nwant:\n%s", strings.Join(got, "|"), want)
+	}
+	if got := readAll(t, path); got != "day 4\n" {
+		t.Fatalf("current file %q", got)
+	}
+}
+
+// Many goroutines logging through slog lose and tear no records across
+// rotations.
+func TestConcurrentSlog(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	w, err := Open(path, Options{MaxSize: 4096, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewJSONHandler(w, nil))
+	const writers, each = 8, 200
+	var wg sync.WaitGroup
+	for g := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range each {
+				logger.Info("event", "g", g, "i", i)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, _ := w.Backups()
+	if len(backups) < 10 {
+		t.Fatalf("only %d rotations", len(backups))
+	}
+	paths := []string{path}
+	for _, b := range backups {
+		paths = append(paths, b.Path)
+	}
+	seen := map[[2]int]bool{}
+	for _, p := range paths {
+		sc := bufio.NewScanner(strings.NewReader(readAll(t, p)))
+		for sc.Scan() {
+			var rec struct{ G, I int }
+			if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+				t.Fatalf("%s: torn record %q", p, sc.Text())
+			}
+			seen[[2]int{rec.G, rec.I}] = true
+		}
+	}
+	if len(seen) != writers*each {
+		t.Fatalf("%d records survived, want %d", len(seen), writers*each)
+	}
+}
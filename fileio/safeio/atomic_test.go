@@ -0,0 +1,299 @@
+package safeio
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gobyexamples/fileio/vfs"
+)
+
+var errInjected = errors.New("injected failure")
+
+// faultFS fails the operation named fail and records the ones it ran.
+type faultFS struct {
+	OSFS
+	fail string
+	ops  []string
+}
+
+func (f *faultFS) op(name string) error {
+	f.ops = append(f.ops, name)
+	if name == f.fail {
+		return errInjected
+	}
+	return nil
+}
+
+func (f *faultFS) CreateTemp(dir, pattern string) (File, error) {
+	if err := f.op("create"); err != nil {
+		return nil, err
+	}
+	file, err := f.OSFS.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &faultFile{File: file, fs: f}, nil
+}
+
+func (f *faultFS) Stat(name string) (fs.FileInfo, error) {
+	if err := f.op("stat"); err != nil {
+		return nil, err
+	}
+	return f.OSFS.Stat(name)
+}
+
+func (f *faultFS) Chmod(name string, mode fs.FileMode) error {
+	if err := f.op("chmod"); err != nil {
+		return err
+	}
+	return f.OSFS.Chmod(name, mode)
+}
+
+func (f *faultFS) Chown(name string, uid, gid int) error {
+	if err := f.op("chown"); err != nil {
+		return err
+	}
+	return f.OSFS.Chown(name, uid, gid)
+}
+
+func (f *faultFS) Link(oldname, newname string) error {
+	if err := f.op("link"); err != nil {
+		return err
+	}
+	return f.OSFS.Link(oldname, newname)
+}
+
+func (f *faultFS) Rename(oldpath, newpath string) error {
+	if err := f.op("rename"); err != nil {
+		return err
+	}
+	return f.OSFS.Rename(oldpath, newpath)
+}
+
+func (f *faultFS) SyncDir(dir string) error {
+	if err := f.op("syncdir"); err != nil {
+		return err
+	}
+	return f.OSFS.SyncDir(dir)
+}
+
+type faultFile struct {
+	File
+	fs *faultFS
+}
+
+func (f *faultFile) Write(p []byte) (int, error) {
+	if err := f.fs.op("write"); err != nil {
+		return len(p) / 2, err
+	}
+	return f.File.Write(p)
+}
+
+func (f *faultFile) Sync() error {
+	if err := f.fs.op("sync"); err != nil {
+		return err
+	}
+	return f.File.Sync()
+}
+
+func (f *faultFile) Close() error {
+	if err := f.fs.op("close"); err != nil {
+		f.File.Close()
+		return err
+	}
+	return f.File.Close()
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// entries lists dir so tests can spot leftover temporary files.
+func entries(t *testing.T, dir string) []string {
+	t.Helper()
+	des, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, de := range des {
+		names = append(names, de.Name())
+	}
+	return names
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.txt")
+	if err := WriteFileAtomic(path, []byte("v1\n"), 0o600, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := os.Stat(path); fi.Mode().Perm() != 0o600 {
+		t.Fatalf("new file mode = %v", fi.Mode())
+	}
+
+	// An existing file keeps its mode, whatever perm says.
+	if err := os.Chmod(path, 0o640); err != nil {
+		t.Fatal(err)
+	}
+	fsys := &faultFS{}
+	if err := WriteFileAtomic(path, []byte("v2\n"), 0o600, Options{FS: fsys}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path); got != "v2\n" {
+		t.Fatalf("contents = %q", got)
+	}
+	if fi, _ := os.Stat(path); fi.Mode().Perm() != 0o640 {
+		t.Fatalf("mode after overwrite = %v", fi.Mode())
+	}
+	want := "[create write sync close stat chmod chown rename syncdir]"
+	if got := fmt.Sprint(fsys.ops); got != want {
+		t.Fatalf("steps = %s, want %s", got, want)
+	}
+	if names := entries(t, dir); len(names) != 1 {
+		t.Fatalf("leftover files: %v", names)
+	}
+}
+
+func TestBackup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.json")
+	opts := Options{Backup: true}
+	for _, v := range []string{"one", "two", "three"} {
+		if err := WriteFileAtomic(path, []byte(v), 0, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := readFile(t, path); got != "three" {
+		t.Fatalf("contents = %q", got)
+	}
+	if got := readFile(t, path+"~"); got != "two" {
+		t.Fatalf("backup = %q", got)
+	}
+}
+
+// Every step that fails before the rename must leave the old contents and
+// no temporary file behind.
+func TestFailureAtEachStep(t *testing.T) {
+	for _, step := range []string{"create", "write", "sync", "close", "stat", "chmod", "chown", "link", "rename"} {
+		t.Run(step, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "f")
+			if err := os.WriteFile(path, []byte("old"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			err := WriteFileAtomic(path, []byte("new contents"), 0, Options{Backup: true, FS: &faultFS{fail: step}})
+			if !errors.Is(err, errInjected) {
+				t.Fatalf("err = %v", err)
+			}
+			if got := readFile(t, path); got != "old" {
+				t.Fatalf("target changed to %q", got)
+			}
+			for _, name := range entries(t, dir) {
+				if name != "f" && name != "f~" {
+					t.Fatalf("leftover file %q", name)
+				}
+			}
+		})
+	}
+
+	t.Run("syncdir", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "f")
+		err := WriteFileAtomic(path, []byte("new"), 0, Options{FS: &faultFS{fail: "syncdir"}})
+		if !errors.Is(err, errInjected) {
+			t.Fatalf("err = %v", err)
+		}
+		if got := readFile(t, path); got != "new" {
+			t.Fatalf("contents = %q; the rename had already happened", got)
+		}
+	})
+}
+
+func TestWriterLifecycle(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "f")
+
+	// Close without Commit discards.
+	w, err := NewAtomicWriter(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("never"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if names := entries(t, dir); len(names) != 0 {
+		t.Fatalf("Close left %v", names)
+	}
+
+	// A failed write poisons Commit: no partial file is installed.
+	fsys := &faultFS{fail: "write"}
+	w, err = NewAtomicWriter(path, Options{FS: fsys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("partial")); !errors.Is(err, errInjected) {
+		t.Fatalf("write err = %v", err)
+	}
+	fsys.fail = ""
+	if err := w.Commit(); !errors.Is(err, errInjected) {
+		t.Fatalf("commit after failed write: %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("partial file installed: %v", err)
+	}
+
+	w, _ = NewAtomicWriter(path, Options{})
+	w.Write([]byte("ok"))
+	if err := w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close after Commit: %v", err)
+	}
+	if _, err := w.Write(nil); !errors.Is(err, ErrClosed) || !errors.Is(w.Commit(), ErrClosed) {
+		t.Fatal("writer usable after Commit")
+	}
+}
+
+func TestFromVFS(t *testing.T) {
+	mem := vfs.NewMem()
+	if err := mem.MkdirAll("data", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{Backup: true, FS: FromVFS(mem)}
+	for _, v := range []string{"one", "two"} {
+		if err := WriteFileAtomic("data/v.txt", []byte(v), 0, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, want := range map[string]string{"data/v.txt": "two", "data/v.txt~": "one"} {
+		if b, err := fs.ReadFile(mem, name); err != nil || string(b) != want {
+			t.Fatalf("%s = %q, %v; want %q", name, b, err, want)
+		}
+	}
+	if des, _ := fs.ReadDir(mem, "data"); len(des) != 2 {
+		t.Fatalf("leftover files: %v", des)
+	}
+
+	// Through vfs.Dir the temp file is an *os.File, so Perm is applied.
+	dir := t.TempDir()
+	if err := WriteFileAtomic("new.txt", []byte("x"), 0o640, Options{FS: FromVFS(vfs.Dir(dir))}); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(filepath.Join(dir, "new.txt")); err != nil || fi.Mode().Perm() != 0o640 {
+		t.Fatalf("new file: %v, %v", fi, err)
+	}
+	if names := entries(t, dir); len(names) != 1 {
+		t.Fatalf("leftover files: %v", names)
+	}
+}
@@ -0,0 +1,53 @@
+package safeio
+
+import (
+	"io"
+	"io/fs"
+	"os"
+)
+
+// FS is the set of filesystem operations AtomicWriter needs. OSFS is the
+// real implementation; tests wrap it to fail at a chosen step.
+type FS interface {
+	// CreateTemp creates a new file in dir, as os.CreateTemp.
+	CreateTemp(dir, pattern string) (File, error)
+	Stat(name string) (fs.FileInfo, error)
+	Chmod(name string, mode fs.FileMode) error
+	Chown(name string, uid, gid int) error
+	Link(oldname, newname string) error
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	// SyncDir flushes a directory's entries, making a rename in it durable.
+	SyncDir(dir string) error
+}
+
+// File is an open file being written.
+type File interface {
+	io.Writer
+	Name() string
+	Sync() error
+	Close() error
+}
+
+// OSFS implements FS with the os package.
+type OSFS struct{}
+
+func (OSFS) CreateTemp(dir, pattern string) (File, error) { return os.CreateTemp(dir, pattern) }
+func (OSFS) Stat(name string) (fs.FileInfo, error)        { return os.Stat(name) }
+func (OSFS) Chmod(name string, mode fs.FileMode) error    { return os.Chmod(name, mode) }
+func (OSFS) Chown(name string, uid, gid int) error        { return os.Chown(name, uid, gid) }
+func (OSFS) Link(oldname, newname string) error           { return os.Link(oldname, newname) }
+func (OSFS) Rename(oldpath, newpath string) error         { return os.Rename(oldpath, newpath) }
+func (OSFS) Remove(name string) error                     { return os.Remove(name) }
+
+func (OSFS) SyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		d.Close()
+		return err
+	}
+	return d.Close()
+}
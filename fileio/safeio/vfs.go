@@ -0,0 +1,122 @@
+package safeio
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"gobyexamples/fileio/vfs"
+)
+
+// FromVFS adapts a vfs.FS to FS, so an AtomicWriter can write to memory,
+// an overlay or a fault-injecting filesystem as well as the disk. Paths are
+// vfs names: slash-separated and relative.
+//
+// vfs has no calls for modes, owners, hard links or directory syncs, so the
+// adapter uses what the open files offer: Chmod, Chown and Sync happen only
+// where the file has those methods (as *os.File from vfs.Dir does), and
+// the Backup link is a copy.
+func FromVFS(fsys vfs.FS) FS { return vfsFS{fsys} }
+
+type vfsFS struct{ fsys vfs.FS }
+
+// vfsFile reports the name it was created under, not the OS path that
+// *os.File would, so it can be passed back to the FS.
+type vfsFile struct {
+	vfs.File
+	name string
+}
+
+func (f vfsFile) Name() string { return f.name }
+
+// CreateTemp follows os.CreateTemp: the last "*" in pattern is replaced by
+// a random string, and the file is created with O_EXCL and mode 0600.
+func (v vfsFS) CreateTemp(dir, pattern string) (File, error) {
+	prefix, suffix := pattern, ""
+	if i := strings.LastIndex(pattern, "*"); i >= 0 {
+		prefix, suffix = pattern[:i], pattern[i+1:]
+	}
+	for try := 0; ; try++ {
+		name := path.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10)+suffix)
+		f, err := v.fsys.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+		if errors.Is(err, fs.ErrExist) && try < 10000 {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return vfsFile{File: f, name: name}, nil
+	}
+}
+
+func (v vfsFS) Stat(name string) (fs.FileInfo, error) { return v.fsys.Stat(name) }
+func (v vfsFS) Rename(oldpath, newpath string) error  { return v.fsys.Rename(oldpath, newpath) }
+func (v vfsFS) Remove(name string) error              { return v.fsys.Remove(name) }
+
+func (v vfsFS) Chmod(name string, mode fs.FileMode) error {
+	return v.withFile(name, func(f fs.File) error {
+		if c, ok := f.(interface{ Chmod(fs.FileMode) error }); ok {
+			return c.Chmod(mode)
+		}
+		return nil
+	})
+}
+
+func (v vfsFS) Chown(name string, uid, gid int) error {
+	return v.withFile(name, func(f fs.File) error {
+		if c, ok := f.(interface{ Chown(uid, gid int) error }); ok {
+			return c.Chown(uid, gid)
+		}
+		return nil
+	})
+}
+
+// Link copies oldname to newname, which must not exist yet, with the same
+// permission bits.
+func (v vfsFS) Link(oldname, newname string) error {
+	src, err := v.fsys.Open(oldname)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := v.fsys.OpenFile(newname, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		v.fsys.Remove(newname)
+		return err
+	}
+	return dst.Close()
+}
+
+func (v vfsFS) SyncDir(dir string) error {
+	return v.withFile(dir, func(f fs.File) error {
+		if s, ok := f.(interface{ Sync() error }); ok {
+			return s.Sync()
+		}
+		return nil
+	})
+}
+
+func (v vfsFS) withFile(name string, fn func(fs.File) error) error {
+	f, err := v.fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	if err := fn(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
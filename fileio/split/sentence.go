@@ -0,0 +1,222 @@
+package split
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultAbbreviations are words that are followed by a period but do not
+// end a sentence. They are matched case-insensitively, without the final
+// period.
+var DefaultAbbreviations = []string{
+	"mr", "mrs", "ms", "dr", "prof", "sr", "jr", "st", "vs", "etc",
+	"e.g", "i.e", "cf", "fig", "no", "vol", "approx", "inc", "ltd", "co",
+}
+
+// SentenceOptions configures Sentences. The zero value uses
+// DefaultAbbreviations and DefaultMaxToken.
+type SentenceOptions struct {
+	Abbreviations []string
+	// MaxLen is the longest sentence returned; text with no sentence end
+	// within MaxLen bytes is cut there (on a rune boundary).
+	MaxLen int
+}
+
+// Sentences returns a SplitFunc for prose. A sentence ends at '.', '!',
+// '?' or '…' (or a run of them, like "?!" or "..."), plus any closing
+// quotes and brackets, when whitespace follows. It does not end:
+//
+//   - inside a number or word ("3.14", "example.com"), as no space follows
+//   - after an abbreviation ("Dr. Smith") or a single-letter initial
+//     ("J. R. Smith")
+//   - when the next word starts in lower case ("etc. and so on",
+//     `"Stop!" she said`)
+//
+// A blank line always ends a sentence, so headings and list items without
+// a full stop stay separate. Tokens are trimmed of surrounding whitespace.
+func Sentences(opts SentenceOptions) bufio.SplitFunc {
+	if opts.Abbreviations == nil {
+		opts.Abbreviations = DefaultAbbreviations
+	}
+	if opts.MaxLen <= 0 {
+		opts.MaxLen = DefaultMaxToken
+	}
+	abbrev := make(map[string]bool, len(opts.Abbreviations))
+	for _, a := range opts.Abbreviations {
+		abbrev[strings.ToLower(strings.TrimSuffix(a, "."))] = true
+	}
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		return leadingSpace(data, atEOF, func(data []byte) (int, []byte) {
+			w, final := window(data, atEOF, opts.MaxLen)
+			end, ok := sentenceEnd(w, final, abbrev)
+			if !ok {
+				return 0, nil // need more
+			}
+			if end < 0 { // no sentence end in the window
+				if !final {
+					return 0, nil
+				}
+				if len(w) < len(data) || !atEOF {
+					end = cut(w)
+				} else {
+					end = len(w)
+				}
+			}
+			return end, trimmed(w[:end])
+		})
+	}
+}
+
+// leadingSpace skips whitespace before calling split on the rest of data.
+// It has to happen in the same call: at EOF a Scanner stops as soon as a
+// SplitFunc advances without returning a token.
+func leadingSpace(data []byte, atEOF bool, split func([]byte) (int, []byte)) (int, []byte, error) {
+	n := skipSpace(data)
+	if n == len(data) {
+		return n, nil, nil
+	}
+	adv, tok := split(data[n:])
+	if adv == 0 {
+		return n, nil, nil // keep the skip; need more
+	}
+	return n + adv, tok, nil
+}
+
+// sentenceEnd returns the index just past the first sentence in w, -1 if
+// there is none, or ok=false if the answer depends on bytes not read yet.
+func sentenceEnd(w []byte, final bool, abbrev map[string]bool) (end int, ok bool) {
+	for i := 0; i < len(w); {
+		r, size := utf8.DecodeRune(w[i:])
+		switch {
+		case r == '\n':
+			blank, ok := blankLineAfter(w[i+1:], final)
+			if !ok {
+				return 0, false
+			}
+			if blank {
+				return i + 1, true
+			}
+		case isTerminator(r):
+			j := i + size
+			for j < len(w) {
+				r, n := utf8.DecodeRune(w[j:])
+				if !isTerminator(r) && !isCloser(r) {
+					break
+				}
+				j += n
+			}
+			if j == len(w) {
+				if !final {
+					return 0, false
+				}
+				return j, true
+			}
+			if next, _ := utf8.DecodeRune(w[j:]); !unicode.IsSpace(next) {
+				break // 3.14, example.com, "Hi."
+			}
+			if r == '.' && j == i+1 && isAbbrev(w[:i], abbrev) {
+				break
+			}
+			k := j + skipSpace(w[j:])
+			if k == len(w) || !utf8.FullRune(w[k:]) {
+				if !final {
+					return 0, false
+				}
+				return j, true
+			}
+			if next, _ := utf8.DecodeRune(w[k:]); unicode.IsLower(next) {
+				break
+			}
+			return j, true
+		}
+		i += size
+	}
+	return -1, true
+}
+
+// blankLineAfter reports whether rest starts with a line holding only
+// spaces and tabs.
+func blankLineAfter(rest []byte, final bool) (blank, ok bool) {
+	for _, b := range rest {
+		switch b {
+		case '\n':
+			return true, true
+		case ' ', '\t', '\r':
+		default:
+			return false, true
+		}
+	}
+	return final, final
+}
+
+// isAbbrev reports whether the word ending text (just before a period) is
+// an abbreviation or an initial.
+func isAbbrev(text []byte, abbrev map[string]bool) bool {
+	start := bytes.LastIndexFunc(text, unicode.IsSpace) + 1
+	word := bytes.TrimLeftFunc(text[start:], func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsNumber(r) })
+	if utf8.RuneCount(word) == 1 {
+		r, _ := utf8.DecodeRune(word)
+		return unicode.IsLetter(r)
+	}
+	return len(word) > 0 && abbrev[strings.ToLower(string(word))]
+}
+
+func isTerminator(r rune) bool { return r == '.' || r == '!' || r == '?' || r == '…' }
+
+func isCloser(r rune) bool {
+	switch r {
+	case '"', '\'', '”', '’', '»', ')', ']':
+		return true
+	}
+	return false
+}
+
+func isSpace(r rune) bool { return unicode.IsSpace(r) }
+
+// trimmed returns tok without surrounding whitespace, or nil if nothing is
+// left, so whitespace-only input produces no token.
+func trimmed(tok []byte) []byte {
+	tok = bytes.TrimSpace(tok)
+	if len(tok) == 0 {
+		return nil
+	}
+	return tok
+}
+
+// Paragraphs returns a SplitFunc whose tokens are runs of non-blank lines,
+// separated by one or more blank lines, trimmed of surrounding whitespace.
+// A paragraph longer than maxLen bytes (<= 0 means DefaultMaxToken) is cut
+// there.
+func Paragraphs(maxLen int) bufio.SplitFunc {
+	if maxLen <= 0 {
+		maxLen = DefaultMaxToken
+	}
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		return leadingSpace(data, atEOF, func(data []byte) (int, []byte) {
+			w, final := window(data, atEOF, maxLen)
+			for i := 0; i < len(w); i++ {
+				if w[i] != '\n' {
+					continue
+				}
+				blank, ok := blankLineAfter(w[i+1:], final)
+				if !ok {
+					return 0, nil
+				}
+				if blank {
+					return i + 1, trimmed(w[:i])
+				}
+			}
+			switch {
+			case !final:
+				return 0, nil
+			case len(w) < len(data) || !atEOF:
+				end := cut(w)
+				return end, trimmed(w[:end])
+			}
+			return len(w), trimmed(w)
+		})
+	}
+}
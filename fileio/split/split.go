@@ -0,0 +1,256 @@
+// Package split provides bufio.SplitFuncs for text and record formats that
+// bufio's own ScanLines and ScanWords do not cover.
+//
+// fileio/examples/004_scan_sentences.go ends a sentence at every '.', so
+// "Dr. Smith paid $3.50." comes out in four pieces. Sentences knows about
+// abbreviations, decimals and closing quotes; Paragraphs splits on blank
+// lines; FixedWidth, Delimited and LengthPrefixed read records.
+//
+// Every SplitFunc here gives the same tokens however the input is split
+// across reads, and none of them lets one token grow without bound: text
+// is cut at a maximum length, records that are too long are an error.
+// The maximum must fit in the Scanner's buffer (bufio.MaxScanTokenSize by
+// default), with a little room for lookahead.
+package split
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// DefaultMaxToken is the maximum token length when none is given: half of
+// bufio.MaxScanTokenSize, so the default Scanner always has room for it.
+const DefaultMaxToken = bufio.MaxScanTokenSize / 2
+
+var (
+	// ErrTokenTooLong is returned by Delimited for a record longer than
+	// its maximum.
+	ErrTokenTooLong = errors.New("split: token too long")
+	// ErrFrameTooLarge is returned by LengthPrefixed for a header that
+	// announces more than the maximum, before any of it is buffered.
+	ErrFrameTooLarge = errors.New("split: frame too large")
+	// ErrShortRecord is returned by FixedWidth when the input ends partway
+	// through a record.
+	ErrShortRecord = errors.New("split: short record")
+)
+
+// window returns the part of data a split decision may look at, and
+// whether nothing beyond it will ever matter: at EOF, or once max bytes are
+// buffered. Deciding only from the window is what makes the tokens
+// independent of read sizes.
+func window(data []byte, atEOF bool, max int) (w []byte, final bool) {
+	if len(data) >= max {
+		return data[:max], true
+	}
+	return data, atEOF
+}
+
+// cut returns the longest prefix of w that does not end inside a UTF-8
+// sequence, for splitting text that has no natural boundary.
+func cut(w []byte) int {
+	n := len(w)
+	for k := 1; k < utf8.UTFMax && k <= n; k++ {
+		if utf8.RuneStart(w[n-k]) {
+			if !utf8.FullRune(w[n-k:]) {
+				n -= k
+			}
+			break
+		}
+	}
+	if n == 0 {
+		n = len(w) // not UTF-8 at all; cut anyway
+	}
+	return n
+}
+
+// FixedWidth splits input into records of exactly width bytes. Input that
+// ends partway through a record is ErrShortRecord.
+func FixedWidth(width int) bufio.SplitFunc {
+	if width <= 0 {
+		panic("split: FixedWidth width must be positive")
+	}
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if len(data) >= width {
+			return width, data[:width], nil
+		}
+		if atEOF && len(data) > 0 {
+			return 0, nil, fmt.Errorf("%w: %d of %d bytes", ErrShortRecord, len(data), width)
+		}
+		return 0, nil, nil
+	}
+}
+
+// Delimited splits input on delim, except where delim is preceded by
+// escape. Tokens are returned with the escapes removed, so `a\,b` with
+// delim ',' and escape '\' is the single token "a,b", and `\\` is one
+// backslash. An escape at the very end of the input is kept as is. A
+// record of more than maxLen bytes (before unescaping) is ErrTokenTooLong;
+// maxLen <= 0 means DefaultMaxToken.
+func Delimited(delim, escape byte, maxLen int) bufio.SplitFunc {
+	if delim == escape {
+		panic("split: Delimited delim and escape must differ")
+	}
+	if maxLen <= 0 {
+		maxLen = DefaultMaxToken
+	}
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		// The delimiter of a maxLen record is at index maxLen at most.
+		w, final := window(data, atEOF, maxLen+1)
+		escaped := false
+		for i := 0; i < len(w); i++ {
+			switch w[i] {
+			case escape:
+				if i+1 == len(w) && !final {
+					return 0, nil, nil // need the escaped byte
+				}
+				escaped = true
+				i++
+			case delim:
+				return i + 1, unescape(w[:i], escape, escaped), nil
+			}
+		}
+		switch {
+		case len(data) > maxLen:
+			return 0, nil, fmt.Errorf("%w: no %q within %d bytes", ErrTokenTooLong, delim, maxLen)
+		case atEOF && len(data) > 0:
+			return len(data), unescape(data, escape, escaped), nil
+		}
+		return 0, nil, nil
+	}
+}
+
+func unescape(tok []byte, escape byte, escaped bool) []byte {
+	if !escaped {
+		return tok
+	}
+	out := make([]byte, 0, len(tok))
+	for i := 0; i < len(tok); i++ {
+		if tok[i] == escape && i+1 < len(tok) {
+			i++
+		}
+		out = append(out, tok[i])
+	}
+	return out
+}
+
+// FrameOptions configures LengthPrefixed. The zero value reads a 4-byte
+// big-endian length before each frame, up to DefaultMaxToken bytes.
+type FrameOptions struct {
+	// HeaderSize is 1, 2, 4 or 8 bytes; default 4.
+	HeaderSize int
+	// Order of a fixed-size header; default binary.BigEndian.
+	Order binary.ByteOrder
+	// Varint reads the length as an unsigned varint (as written by
+	// binary.AppendUvarint) instead, ignoring HeaderSize and Order.
+	Varint bool
+	// Max is the largest frame accepted.
+	Max int
+}
+
+// LengthPrefixed splits input into frames that each start with their
+// payload length; the tokens are the payloads. A frame cut off by EOF is
+// io.ErrUnexpectedEOF and one longer than Max is ErrFrameTooLarge.
+func LengthPrefixed(opts FrameOptions) bufio.SplitFunc {
+	if opts.HeaderSize == 0 {
+		opts.HeaderSize = 4
+	}
+	if opts.Order == nil {
+		opts.Order = binary.BigEndian
+	}
+	if opts.Max <= 0 {
+		opts.Max = DefaultMaxToken
+	}
+	switch opts.HeaderSize {
+	case 1, 2, 4, 8:
+	default:
+		panic("split: FrameOptions.HeaderSize must be 1, 2, 4 or 8")
+	}
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		size, h, err := frameHeader(data, opts)
+		if err != nil {
+			return 0, nil, err
+		}
+		if h == 0 { // header incomplete
+			if atEOF {
+				return 0, nil, io.ErrUnexpectedEOF
+			}
+			return 0, nil, nil
+		}
+		if size > uint64(opts.Max) {
+			return 0, nil, fmt.Errorf("%w: %d bytes, max %d", ErrFrameTooLarge, size, opts.Max)
+		}
+		end := h + int(size)
+		if len(data) < end {
+			if atEOF {
+				return 0, nil, io.ErrUnexpectedEOF
+			}
+			return 0, nil, nil
+		}
+		return end, data[h:end], nil
+	}
+}
+
+// frameHeader decodes the length at the start of data. h is the header's
+// size, or 0 if data does not hold all of it yet.
+func frameHeader(data []byte, opts FrameOptions) (size uint64, h int, err error) {
+	if opts.Varint {
+		size, n := binary.Uvarint(data)
+		if n < 0 {
+			return 0, 0, fmt.Errorf("%w: varint length overflows", ErrFrameTooLarge)
+		}
+		return size, n, nil
+	}
+	if len(data) < opts.HeaderSize {
+		return 0, 0, nil
+	}
+	switch opts.HeaderSize {
+	case 1:
+		size = uint64(data[0])
+	case 2:
+		size = uint64(opts.Order.Uint16(data))
+	case 4:
+		size = uint64(opts.Order.Uint32(data))
+	default:
+		size = opts.Order.Uint64(data)
+	}
+	return size, opts.HeaderSize, nil
+}
+
+// AppendFrame appends a frame for payload to dst in the format opts reads.
+func AppendFrame(dst []byte, payload []byte, opts FrameOptions) []byte {
+	if opts.Varint {
+		return append(binary.AppendUvarint(dst, uint64(len(payload))), payload...)
+	}
+	if opts.Order == nil {
+		opts.Order = binary.BigEndian
+	}
+	if opts.HeaderSize == 0 {
+		opts.HeaderSize = 4
+	}
+	var h [8]byte
+	n := uint64(len(payload))
+	switch opts.HeaderSize {
+	case 1:
+		h[0] = byte(n)
+	case 2:
+		opts.Order.PutUint16(h[:], uint16(n))
+	case 4:
+		opts.Order.PutUint32(h[:], uint32(n))
+	default:
+		opts.Order.PutUint64(h[:], n)
+	}
+	return append(append(dst, h[:opts.HeaderSize]...), payload...)
+}
+
+// skipSpace returns the index of the first non-space byte or rune in w.
+func skipSpace(w []byte) int {
+	return len(w) - len(bytes.TrimLeftFunc(w, isSpace))
+}
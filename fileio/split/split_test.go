@@ -0,0 +1,207 @@
+package split
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// scan runs split over r with a Scanner whose buffer starts at size
+// bytes and may grow to 1KB.
+func scan(split bufio.SplitFunc, r io.Reader, size int) ([]string, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, size), 1024)
+	s.Split(split)
+	var toks []string
+	for s.Scan() {
+		toks = append(toks, s.Text())
+	}
+	return toks, s.Err()
+}
+
+// sameAcrossReads scans data whole and one byte at a time, fails if the
+// two disagree, and returns the tokens and error.
+func sameAcrossReads(t *testing.T, split bufio.SplitFunc, data []byte) ([]string, error) {
+	t.Helper()
+	whole, err1 := scan(split, bytes.NewReader(data), len(data)+1)
+	bytewise, err2 := scan(split, iotest.OneByteReader(bytes.NewReader(data)), 1)
+	if !slices.Equal(whole, bytewise) || fmt.Sprint(err1) != fmt.Sprint(err2) {
+		t.Fatalf("input %q:\nwhole:    %q %v\nbytewise: %q %v", data, whole, err1, bytewise, err2)
+	}
+	return whole, err1
+}
+
+func TestSentences(t *testing.T) {
+	in := `Dr. Smith paid $3.50 for it. "Stop!" she said. Was it J. R. Tolkien?!  Yes… maybe.
+See e.g. the docs, etc. and so on.
+
+Heading
+
+Last one (really.) Trailing text`
+	want := []string{
+		"Dr. Smith paid $3.50 for it.",
+		`"Stop!" she said.`,
+		"Was it J. R. Tolkien?!",
+		"Yes… maybe.",
+		"See e.g. the docs, etc. and so on.",
+		"Heading",
+		"Last one (really.)",
+		"Trailing text",
+	}
+	got, err := sameAcrossReads(t, Sentences(SentenceOptions{}), []byte(in))
+	if err != nil || !slices.Equal(got, want) {
+		t.Fatalf("got %q, %v\nwant %q", got, err, want)
+	}
+
+	// Text with no sentence end is cut at MaxLen, never inside a rune.
+	got, _ = sameAcrossReads(t, Sentences(SentenceOptions{MaxLen: 7}), []byte("abcdefghij. Éééééé"))
+	if want := []string{"abcdefg", "hij.", "Ééé", "ééé"}; !slices.Equal(got, want) {
+		t.Fatalf("cut: got %q, want %q", got, want)
+	}
+}
+
+func TestParagraphs(t *testing.T) {
+	in := "\n  first line\nsecond line\n\n \t\r\n\nsecond para\n"
+	got, err := sameAcrossReads(t, Paragraphs(0), []byte(in))
+	if want := []string{"first line\nsecond line", "second para"}; err != nil || !slices.Equal(got, want) {
+		t.Fatalf("got %q, %v, want %q", got, err, want)
+	}
+}
+
+func TestRecords(t *testing.T) {
+	got, err := sameAcrossReads(t, FixedWidth(3), []byte("abcdefgh"))
+	if !slices.Equal(got, []string{"abc", "def"}) || !errors.Is(err, ErrShortRecord) {
+		t.Fatalf("fixed width: %q, %v", got, err)
+	}
+
+	got, err = sameAcrossReads(t, Delimited(',', '\\', 8), []byte(`a\,b,c\\,,d\`))
+	if want := []string{"a,b", `c\`, "", `d\`}; err != nil || !slices.Equal(got, want) {
+		t.Fatalf("delimited: %q, %v, want %q", got, err, want)
+	}
+	got, err = sameAcrossReads(t, Delimited(',', '\\', 8), []byte("12345678,123456789,x"))
+	if !slices.Equal(got, []string{"12345678"}) || !errors.Is(err, ErrTokenTooLong) {
+		t.Fatalf("delimited too long: %q, %v", got, err)
+	}
+}
+
+func TestLengthPrefixed(t *testing.T) {
+	for _, opts := range []FrameOptions{{}, {HeaderSize: 2, Order: binary.LittleEndian}, {Varint: true}} {
+		var data []byte
+		want := []string{"one", "", strings.Repeat("x", 300)}
+		for _, p := range want {
+			data = AppendFrame(data, []byte(p), opts)
+		}
+		got, err := sameAcrossReads(t, LengthPrefixed(opts), data)
+		if err != nil || !slices.Equal(got, want) {
+			t.Fatalf("%+v: %d frames, %v", opts, len(got), err)
+		}
+		if _, err := sameAcrossReads(t, LengthPrefixed(opts), data[:len(data)-1]); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("%+v truncated: %v", opts, err)
+		}
+		opts.Max = 299
+		if _, err := sameAcrossReads(t, LengthPrefixed(opts), data); !errors.Is(err, ErrFrameTooLarge) {
+			t.Fatalf("%+v oversized: %v", opts, err)
+		}
+	}
+}
+
+func noSpace(s string) string { return strings.Join(strings.Fields(s), "") }
+
+func FuzzSentences(f *testing.F) {
+	f.Add("Dr. Smith paid $3.50. \"Stop!\" she said.\n\nNext…", uint8(20))
+	f.Add("a. b. C? D!\"  e", uint8(0))
+	f.Add("ééé\u3000é", uint8(3))
+	f.Fuzz(func(t *testing.T, in string, m uint8) {
+		maxLen := 4 + int(m)%60
+		got, err := sameAcrossReads(t, Sentences(SentenceOptions{MaxLen: maxLen}), []byte(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tok := range got {
+			if tok == "" || len(tok) > maxLen {
+				t.Fatalf("token %q (max %d)", tok, maxLen)
+			}
+		}
+		// Splitting and trimming only ever drops whitespace.
+		if noSpace(strings.Join(got, "")) != noSpace(in) {
+			t.Fatalf("tokens %q lost text from %q", got, in)
+		}
+	})
+}
+
+func FuzzParagraphs(f *testing.F) {
+	f.Add("a\nb\n\nc\n \n\n d", uint8(10))
+	f.Add("\r\n\r\nx\r\n\r\n", uint8(0))
+	f.Fuzz(func(t *testing.T, in string, m uint8) {
+		maxLen := 4 + int(m)%60
+		got, err := sameAcrossReads(t, Paragraphs(maxLen), []byte(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tok := range got {
+			if tok == "" || len(tok) > maxLen {
+				t.Fatalf("token %q (max %d)", tok, maxLen)
+			}
+		}
+		if noSpace(strings.Join(got, "")) != noSpace(in) {
+			t.Fatalf("tokens %q lost text from %q", got, in)
+		}
+	})
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ",", `\,`).Replace(s)
+}
+
+func FuzzDelimited(f *testing.F) {
+	f.Add("a,b", `c\`)
+	f.Add("", ",,")
+	f.Fuzz(func(t *testing.T, a, b string) {
+		split := Delimited(',', '\\', 64)
+		// Any input splits the same whole or byte by byte.
+		sameAcrossReads(t, split, []byte(a+b))
+
+		// Escaped fields come back as they were.
+		in := escape(a) + "," + escape(b) + ","
+		got, err := sameAcrossReads(t, split, []byte(in))
+		switch {
+		case len(escape(a)) > 64 || len(escape(b)) > 64:
+			if !errors.Is(err, ErrTokenTooLong) {
+				t.Fatalf("%q: %v", in, err)
+			}
+		case err != nil || !slices.Equal(got, []string{a, b}):
+			t.Fatalf("%q split into %q, %v", in, got, err)
+		}
+	})
+}
+
+func FuzzLengthPrefixed(f *testing.F) {
+	f.Add([]byte("\x00\x00\x00\x03abc\x00\x00"), false)
+	f.Add([]byte("\x03abc\x80"), true)
+	f.Fuzz(func(t *testing.T, data []byte, varint bool) {
+		opts := FrameOptions{Varint: varint, Max: 512}
+		sameAcrossReads(t, LengthPrefixed(opts), data)
+
+		// Cutting data into frames and scanning them gives the pieces back.
+		var frames []byte
+		var want []string
+		for rest := data; len(rest) > 0; {
+			n := min(int(rest[0]), len(rest))
+			want = append(want, string(rest[:n]))
+			frames = AppendFrame(frames, rest[:n], opts)
+			rest = rest[max(n, 1):]
+		}
+		got, err := sameAcrossReads(t, LengthPrefixed(opts), frames)
+		if err != nil || !slices.Equal(got, want) {
+			t.Fatalf("frames %q: %q, %v", want, got, err)
+		}
+	})
+}
+
@@ -0,0 +1,319 @@
+// Package tail follows a growing log file the way `tail -F` does.
+//
+// fileio/examples/002_read_stream.go reads a file once, to EOF. A log keeps
+// growing, and logrotate either renames it away and starts a new one or
+// truncates it in place. A Tailer polls the file, hands out complete lines
+// on a channel, notices both kinds of rotation by comparing the open file
+// with what the path now names, and can save how far it got so a restart
+// carries on where it stopped.
+package tail
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"gobyexamples/fileio/safeio"
+	"gobyexamples/goroutine/clock"
+)
+
+// Line is one line of the file without its "\n" (or "\r\n").
+type Line struct {
+	Text string
+	// Offset is where the line ends in its file, just past the newline.
+	// Saving it and seeking there later resumes after this line.
+	Offset int64
+}
+
+// Options configures a Tailer. The zero value polls every 250ms, starts at
+// the end of an existing file and does not save its position.
+type Options struct {
+	Poll time.Duration
+	// FromStart reads a file that already exists when Follow is called from
+	// its first byte instead of its end. Files that appear later (after a
+	// rotation, or when the path did not exist yet) are always read from
+	// the start.
+	FromStart bool
+	// StateFile, if set, is where the position is saved (atomically, after
+	// each batch of lines and when the Tailer stops) and read back by the
+	// next Follow. A saved position wins over FromStart if it still belongs
+	// to the same file.
+	StateFile string
+	// MaxLineSize bounds memory for a line that never ends; longer lines
+	// are handed out in pieces of this size. Default 1MB.
+	MaxLineSize int
+	Clock       clock.Clock // nil means real time
+}
+
+// state is what StateFile holds.
+type state struct {
+	Path   string `json:"path"`
+	Dev    uint64 `json:"dev,omitempty"`
+	Ino    uint64 `json:"ino,omitempty"`
+	Offset int64  `json:"offset"`
+}
+
+// Tailer follows one path. Create it with Follow and read Lines until it
+// is closed.
+type Tailer struct {
+	path  string
+	opts  Options
+	lines chan Line
+	err   error // set before lines is closed
+
+	f       *os.File
+	fi      fs.FileInfo // of f when it was opened
+	offset  int64       // read position in f
+	pending []byte      // bytes after the last newline
+	saved   state       // position after the last delivered line
+	written state       // what StateFile holds
+	buf     []byte
+}
+
+// Follow starts following path until ctx is done. The path need not exist
+// yet. An error is returned only if StateFile exists but cannot be read.
+func Follow(ctx context.Context, path string, opts Options) (*Tailer, error) {
+	if opts.Poll <= 0 {
+		opts.Poll = 250 * time.Millisecond
+	}
+	if opts.MaxLineSize <= 0 {
+		opts.MaxLineSize = 1 << 20
+	}
+	if opts.Clock == nil {
+		opts.Clock = clock.RealClock{}
+	}
+	t := &Tailer{path: path, opts: opts, lines: make(chan Line), buf: make([]byte, 32*1024)}
+	var resume *state
+	if opts.StateFile != "" {
+		b, err := os.ReadFile(opts.StateFile)
+		switch {
+		case err == nil:
+			var st state
+			if err := json.Unmarshal(b, &st); err != nil {
+				return nil, err
+			}
+			if st.Path == path {
+				resume, t.saved, t.written = &st, st, st
+			}
+		case !errors.Is(err, fs.ErrNotExist):
+			return nil, err
+		}
+	}
+	go t.run(ctx, resume)
+	return t, nil
+}
+
+// Lines returns the channel lines are delivered on. It is closed when ctx
+// is done or reading fails; see Err.
+func (t *Tailer) Lines() <-chan Line { return t.lines }
+
+// Err reports why Lines was closed: nil when ctx was cancelled, otherwise
+// the read or save error that stopped the Tailer. Call it only after Lines
+// is closed.
+func (t *Tailer) Err() error { return t.err }
+
+func (t *Tailer) run(ctx context.Context, resume *state) {
+	defer close(t.lines)
+	defer func() {
+		if err := t.save(); t.err == nil {
+			t.err = err
+		}
+		if t.f != nil {
+			t.f.Close()
+		}
+	}()
+
+	first := true
+	timer := t.opts.Clock.NewTimer(t.opts.Poll)
+	defer timer.Stop()
+	for {
+		if t.f == nil {
+			if err := t.open(first, resume); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				t.err = err
+				return
+			}
+			first = false
+		}
+		if t.f != nil {
+			if err := t.poll(ctx); err != nil {
+				if ctx.Err() == nil {
+					t.err = err
+				}
+				return
+			}
+		}
+		if err := t.save(); err != nil {
+			t.err = err
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C():
+			timer.Reset(t.opts.Poll)
+		}
+	}
+}
+
+// open opens the path, positioned at the saved offset, the end or the
+// start. The first time through, a missing file is still "new": whatever
+// appears there later is read from the beginning.
+func (t *Tailer) open(first bool, resume *state) error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	var start int64
+	if first {
+		dev, ino, ok := fileID(fi)
+		switch {
+		case resume != nil && (!ok || dev == resume.Dev && ino == resume.Ino) && resume.Offset <= fi.Size():
+			start = resume.Offset
+		case resume != nil:
+			start = 0 // rotated while we were not running
+		case !t.opts.FromStart:
+			start = fi.Size()
+		}
+	}
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+	t.f, t.fi, t.offset, t.pending = f, fi, start, t.pending[:0]
+	return nil
+}
+
+// poll reads what has been appended, then checks whether the path was
+// rotated or truncated.
+func (t *Tailer) poll(ctx context.Context) error {
+	if err := t.drain(ctx); err != nil {
+		return err
+	}
+	now, err := os.Stat(t.path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil // renamed away, not recreated yet: keep reading the old file
+	case err != nil:
+		return err
+	case !os.SameFile(now, t.fi):
+		// Rotated. Lines written to the old file just before the rename are
+		// still there; read them, and its last unterminated line, first.
+		if err := t.drain(ctx); err != nil {
+			return err
+		}
+		if len(t.pending) > 0 {
+			if err := t.send(ctx, string(t.pending), t.offset); err != nil {
+				return err
+			}
+		}
+		t.f.Close()
+		t.f = nil
+		if err := t.open(false, nil); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if t.f == nil {
+			return nil
+		}
+		return t.drain(ctx)
+	case now.Size() < t.offset:
+		// Truncated in place (copytruncate). Anything half-read is gone.
+		if _, err := t.f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		t.offset, t.pending = 0, t.pending[:0]
+		return t.drain(ctx)
+	}
+	return nil
+}
+
+// drain reads to EOF, sending each complete line.
+func (t *Tailer) drain(ctx context.Context) error {
+	for {
+		n, err := t.f.Read(t.buf)
+		t.offset += int64(n)
+		data := t.buf[:n]
+		for len(data) > 0 {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				t.pending = append(t.pending, data...)
+				break
+			}
+			t.pending = append(t.pending, data[:i]...)
+			data = data[i+1:]
+			end := t.offset - int64(len(data))
+			start := end - int64(len(t.pending)) - 1
+			line, err := t.sendLong(ctx, bytes.TrimSuffix(t.pending, []byte("\r")), start)
+			if err != nil {
+				return err
+			}
+			if err := t.send(ctx, string(line), end); err != nil {
+				return err
+			}
+			t.pending = t.pending[:0]
+		}
+		if len(t.pending) >= t.opts.MaxLineSize {
+			rest, err := t.sendLong(ctx, t.pending, t.offset-int64(len(t.pending)))
+			if err != nil {
+				return err
+			}
+			t.pending = append(t.pending[:0], rest...)
+		}
+		if err == io.EOF || n == 0 && err == nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// sendLong sends MaxLineSize pieces off the front of line, which starts at
+// offset start, while it is longer than that, and returns the remainder.
+func (t *Tailer) sendLong(ctx context.Context, line []byte, start int64) ([]byte, error) {
+	max := t.opts.MaxLineSize
+	for len(line) > max {
+		start += int64(max)
+		if err := t.send(ctx, string(line[:max]), start); err != nil {
+			return nil, err
+		}
+		line = line[max:]
+	}
+	return line, nil
+}
+
+func (t *Tailer) send(ctx context.Context, text string, end int64) error {
+	select {
+	case t.lines <- Line{Text: text, Offset: end}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	dev, ino, _ := fileID(t.fi)
+	t.saved = state{Path: t.path, Dev: dev, Ino: ino, Offset: end}
+	return nil
+}
+
+// save writes the position of the last delivered line, if it changed.
+func (t *Tailer) save() error {
+	if t.opts.StateFile == "" || t.saved == t.written {
+		return nil
+	}
+	b, err := json.Marshal(t.saved)
+	if err != nil {
+		return err
+	}
+	if err := safeio.WriteFileAtomic(t.opts.StateFile, b, 0o644, safeio.Options{}); err != nil {
+		return err
+	}
+	t.written = t.saved
+	return nil
+}
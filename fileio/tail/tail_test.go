@@ -0,0 +1,182 @@
+package tail
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gobyexamples/goroutine/clock"
+	"gobyexamples/goroutine/leakcheck"
+)
+
+type harness struct {
+	t   *testing.T
+	clk *clock.Fake
+	tl  *Tailer
+}
+
+func follow(t *testing.T, ctx context.Context, path string, opts Options) *harness {
+	t.Helper()
+	clk := clock.NewFake(time.Unix(0, 0))
+	opts.Clock = clk
+	tl, err := Follow(ctx, path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &harness{t: t, clk: clk, tl: tl}
+}
+
+// step waits until the tailer is idle, runs change, then lets one poll
+// happen.
+func (h *harness) step(change func()) {
+	h.clk.BlockUntil(1)
+	change()
+	h.clk.Advance(time.Second)
+}
+
+func (h *harness) expect(want ...string) {
+	h.t.Helper()
+	for _, w := range want {
+		select {
+		case l, ok := <-h.tl.Lines():
+			if !ok {
+				h.t.Fatalf("lines closed (err %v), want %q", h.tl.Err(), w)
+			}
+			if l.Text != w {
+				h.t.Fatalf("got %q, want %q", l.Text, w)
+			}
+		case <-time.After(5 * time.Second):
+			h.t.Fatalf("timed out waiting for %q", w)
+		}
+	}
+}
+
+func appendFile(t *testing.T, path, s string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func stop(t *testing.T, cancel context.CancelFunc, tl *Tailer) {
+	t.Helper()
+	cancel()
+	for l := range tl.Lines() {
+		t.Fatalf("unexpected line %q", l.Text)
+	}
+	if err := tl.Err(); err != nil {
+		t.Fatalf("Err = %v", err)
+	}
+}
+
+func TestFollowRotateTruncate(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	stateFile := filepath.Join(dir, "app.log.offset")
+	appendFile(t, path, "a\r\nb\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h := follow(t, ctx, path, Options{FromStart: true, StateFile: stateFile})
+	h.expect("a", "b")
+
+	h.step(func() { appendFile(t, path, "c\npart") })
+	h.expect("c")
+	h.step(func() { appendFile(t, path, "ial\n") })
+	h.expect("partial")
+
+	// logrotate's default: rename, then the writer reopens a new file.
+	// The last lines and a half-written line in the old file still arrive.
+	h.step(func() {
+		if err := os.Rename(path, path+".1"); err != nil {
+			t.Fatal(err)
+		}
+		appendFile(t, path+".1", "old-tail\nno-newline")
+	})
+	h.expect("old-tail")
+	h.step(func() { appendFile(t, path, "new1\n") })
+	h.expect("no-newline", "new1")
+
+	// copytruncate: same file, cut back to zero.
+	h.step(func() {
+		if err := os.WriteFile(path, []byte("x\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	})
+	h.expect("x")
+	stop(t, cancel, h.tl)
+
+	var st state
+	b, _ := os.ReadFile(stateFile)
+	if err := json.Unmarshal(b, &st); err != nil || st.Offset != 2 || st.Path != path {
+		t.Fatalf("state %s: %v", b, err)
+	}
+
+	// A restart picks up what was written while it was down.
+	appendFile(t, path, "y\n")
+	ctx, cancel = context.WithCancel(context.Background())
+	h = follow(t, ctx, path, Options{StateFile: stateFile})
+	h.expect("y")
+	stop(t, cancel, h.tl)
+
+	// Rotated while down: the saved offset is for another file, so the new
+	// one is read from the start.
+	os.Rename(path, path+".2")
+	appendFile(t, path, "fresh\n")
+	ctx, cancel = context.WithCancel(context.Background())
+	h = follow(t, ctx, path, Options{StateFile: stateFile})
+	h.expect("fresh")
+	stop(t, cancel, h.tl)
+}
+
+func TestFollowWaitsForFile(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	path := filepath.Join(t.TempDir(), "later.log")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h := follow(t, ctx, path, Options{})
+	h.step(func() { appendFile(t, path, "first\n") })
+	h.expect("first")
+	stop(t, cancel, h.tl)
+}
+
+func TestStartAtEndAndLongLines(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, path, "old line\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h := follow(t, ctx, path, Options{MaxLineSize: 4})
+	h.step(func() { appendFile(t, path, strings.Repeat("z", 10)+"\n") })
+	h.expect("zzzz", "zzzz", "zz")
+	stop(t, cancel, h.tl)
+}
+
+// Cancelling while a line is waiting for a reader must not hang.
+func TestCancelWithUnreadLines(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, path, "one\ntwo\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tl, err := Follow(ctx, path, Options{FromStart: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	for range tl.Lines() {
+	}
+	if tl.Err() != nil {
+		t.Fatal(tl.Err())
+	}
+}
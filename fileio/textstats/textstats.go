@@ -0,0 +1,296 @@
+// Package textstats counts lines, words, bytes and runes like wc, and word
+// frequencies for top-N reports, over many files at once.
+//
+// fileio/examples/009_word_count.go counts one file on one goroutine, splits
+// on whitespace only (so "alpha," and "alpha" are different words) and
+// prints in map order. Run fans files out to a bounded worker pool, tokenizes
+// on Unicode letters and numbers, and returns results in a stable order.
+package textstats
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Counts are wc's numbers. Words are whitespace-separated, as wc counts them.
+type Counts struct {
+	Lines int64 `json:"lines"`
+	Words int64 `json:"words"`
+	Bytes int64 `json:"bytes"`
+	Runes int64 `json:"runes"`
+}
+
+func (c *Counts) add(o Counts) {
+	c.Lines += o.Lines
+	c.Words += o.Words
+	c.Bytes += o.Bytes
+	c.Runes += o.Runes
+}
+
+// WordCount is one entry of a top-N list.
+type WordCount struct {
+	Word  string `json:"word"`
+	Count int64  `json:"count"`
+}
+
+// FileResult holds the counts for one file, or why it could not be read.
+type FileResult struct {
+	Path string `json:"path"`
+	Counts
+	Err error `json:"-"`
+}
+
+// MarshalJSON adds the error message, if any, as "error".
+func (f FileResult) MarshalJSON() ([]byte, error) {
+	type plain FileResult // without this method
+	v := struct {
+		plain
+		Error string `json:"error,omitempty"`
+	}{plain: plain(f)}
+	if f.Err != nil {
+		v.Error = f.Err.Error()
+	}
+	return json.Marshal(v)
+}
+
+// Report is the result of Run. Files are in the order they were given.
+type Report struct {
+	Files []FileResult `json:"files"`
+	Total Counts       `json:"total"`
+	Top   []WordCount  `json:"top,omitempty"`
+}
+
+// Options configures counting. The zero value counts with one worker per
+// CPU and skips word frequencies.
+type Options struct {
+	Workers int
+	// TopN > 0 tallies word frequencies across all files and reports the
+	// TopN most frequent, ties broken alphabetically.
+	TopN int
+	// Fold lower-cases words before tallying, so "The" and "the" are one.
+	Fold bool
+	// StopWords are left out of the tally. They are compared after folding.
+	StopWords []string
+}
+
+// DefaultStopWords is a short list of common English words.
+var DefaultStopWords = strings.Fields(`a an and are as at be but by for from
+has have he her his i in is it its of on or she that the their they this to
+was we were will with you`)
+
+// Run counts every file in paths. A file that cannot be read gets its error
+// in its FileResult and the others are still counted; Run's own error is
+// only ctx's.
+func Run(ctx context.Context, paths []string, opts Options) (*Report, error) {
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.GOMAXPROCS(0)
+	}
+	stop := make(map[string]bool, len(opts.StopWords))
+	for _, w := range opts.StopWords {
+		if opts.Fold {
+			w = strings.ToLower(w)
+		}
+		stop[w] = true
+	}
+
+	rep := &Report{Files: make([]FileResult, len(paths))}
+	freqs := make([]map[string]int64, len(paths))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(opts.Workers, len(paths)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				rep.Files[i], freqs[i] = countFile(paths[i], opts, stop)
+			}
+		}()
+	}
+	var err error
+feed:
+	for i := range paths {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			err = ctx.Err()
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	var total map[string]int64
+	for i, f := range rep.Files {
+		rep.Total.add(f.Counts)
+		if opts.TopN > 0 && freqs[i] != nil {
+			if total == nil {
+				total = freqs[i] // reuse the first map
+				continue
+			}
+			for w, n := range freqs[i] {
+				total[w] += n
+			}
+		}
+	}
+	if opts.TopN > 0 {
+		rep.Top = Top(total, opts.TopN)
+	}
+	return rep, nil
+}
+
+func countFile(path string, opts Options, stop map[string]bool) (FileResult, map[string]int64) {
+	res := FileResult{Path: path}
+	f, err := os.Open(path)
+	if err != nil {
+		res.Err = err
+		return res, nil
+	}
+	defer f.Close()
+	var freq map[string]int64
+	if opts.TopN > 0 {
+		freq = make(map[string]int64)
+	}
+	res.Counts, res.Err = count(f, freq, opts.Fold, stop)
+	return res, freq
+}
+
+// Count returns wc's numbers for r, and when freq is non-nil adds each
+// word's occurrences to it.
+func Count(r io.Reader, freq map[string]int64, fold bool) (Counts, error) {
+	return count(r, freq, fold, nil)
+}
+
+func count(r io.Reader, freq map[string]int64, fold bool, stop map[string]bool) (Counts, error) {
+	var (
+		c      Counts
+		inWord bool   // inside a whitespace-separated word
+		tok    []byte // current letter/number token
+		apos   bool   // an apostrophe followed tok; kept if a letter comes next
+	)
+	flush := func() {
+		if len(tok) > 0 && !stop[string(tok)] {
+			freq[string(tok)]++
+		}
+		tok, apos = tok[:0], false
+	}
+	buf := make([]byte, 64*1024)
+	carry := 0 // bytes of an incomplete rune kept at the start of buf
+	for {
+		n, err := r.Read(buf[carry:])
+		c.Bytes += int64(n)
+		n += carry
+		end := n
+		if err == nil {
+			// Leave a rune cut by the buffer edge for the next read.
+			for k := 1; k < utf8.UTFMax && k <= end; k++ {
+				if utf8.RuneStart(buf[end-k]) {
+					if !utf8.FullRune(buf[end-k : end]) {
+						end -= k
+					}
+					break
+				}
+			}
+		}
+		for i := 0; i < end; {
+			r, size := rune(buf[i]), 1
+			if r >= utf8.RuneSelf {
+				r, size = utf8.DecodeRune(buf[i:end])
+			}
+			i += size
+			c.Runes++
+			if r == '\n' {
+				c.Lines++
+			}
+			if unicode.IsSpace(r) {
+				inWord = false
+			} else if !inWord {
+				inWord = true
+				c.Words++
+			}
+			if freq == nil {
+				continue
+			}
+			switch {
+			case unicode.IsLetter(r) || unicode.IsNumber(r) || len(tok) > 0 && !apos && unicode.Is(unicode.Mn, r):
+				if apos {
+					tok, apos = append(tok, '\''), false // don't, l'été
+				}
+				if fold {
+					r = unicode.ToLower(r)
+				}
+				tok = utf8.AppendRune(tok, r)
+			case (r == '\'' || r == '’') && len(tok) > 0 && !apos:
+				apos = true
+			default:
+				flush()
+			}
+		}
+		carry = copy(buf, buf[end:n])
+		if err != nil {
+			if freq != nil {
+				flush()
+			}
+			if errors.Is(err, io.EOF) {
+				return c, nil
+			}
+			return c, err
+		}
+	}
+}
+
+// Top returns the n most frequent words, most frequent first and ties in
+// alphabetical order, so the output is the same on every run.
+func Top(freq map[string]int64, n int) []WordCount {
+	all := make([]WordCount, 0, len(freq))
+	for w, c := range freq {
+		all = append(all, WordCount{w, c})
+	}
+	slices.SortFunc(all, func(a, b WordCount) int {
+		if a.Count != b.Count {
+			return cmp.Compare(b.Count, a.Count)
+		}
+		return strings.Compare(a.Word, b.Word)
+	})
+	return all[:min(n, len(all))]
+}
+
+// Expand replaces each glob pattern with the files it matches, in order
+// and without duplicates. A pattern matching nothing is kept as is, so the
+// missing file is reported rather than silently skipped.
+func Expand(patterns []string) ([]string, error) {
+	var out []string
+	seen := map[string]bool{}
+	for _, p := range patterns {
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			matches = []string{p}
+		}
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				out = append(out, m)
+			}
+		}
+	}
+	return out, nil
+}
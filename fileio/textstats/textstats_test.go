@@ -0,0 +1,105 @@
+package textstats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"gobyexamples/goroutine/leakcheck"
+)
+
+func TestCount(t *testing.T) {
+	in := "Héllo, wörld! don't\n\tl’été 42\nHELLO hello\n"
+	freq := map[string]int64{}
+	c, err := Count(strings.NewReader(in), freq, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Counts{Lines: 3, Words: 7, Bytes: int64(len(in)), Runes: int64(len([]rune(in)))}
+	if c != want {
+		t.Fatalf("counts = %+v, want %+v", c, want)
+	}
+	if got := fmt.Sprint(Top(freq, 10)); got != "[{hello 2} {42 1} {don't 1} {héllo 1} {l'été 1} {wörld 1}]" {
+		t.Fatalf("top = %s", got)
+	}
+}
+
+// Runes split across reads must decode the same as when read whole.
+func TestCountAcrossReads(t *testing.T) {
+	in := strings.Repeat("añb 日本語 ÿ'z\n", 10_000)
+	whole := map[string]int64{}
+	want, _ := Count(strings.NewReader(in), whole, false)
+	wantFreq := fmt.Sprint(Top(whole, 10))
+
+	got := map[string]int64{}
+	c, err := Count(iotest.OneByteReader(strings.NewReader(in)), got, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != want || fmt.Sprint(Top(got, 10)) != wantFreq {
+		t.Fatalf("one-byte reads: %+v %v, want %+v %s", c, Top(got, 10), want, wantFreq)
+	}
+	if want.Runes != 10_000*12 {
+		t.Fatalf("runes = %d", want.Runes)
+	}
+}
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRun(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	dir := writeFiles(t, map[string]string{
+		"a.txt": "The cat and the hat.\n",
+		"b.txt": "A cat, a bat;\nthe end\n",
+		"c.log": "not matched by the glob\n",
+	})
+	paths, err := Expand([]string{filepath.Join(dir, "*.txt"), filepath.Join(dir, "missing.txt")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep, err := Run(context.Background(), paths, Options{Workers: 2, TopN: 3, Fold: true, StopWords: DefaultStopWords})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Files) != 3 || filepath.Base(rep.Files[0].Path) != "a.txt" || filepath.Base(rep.Files[1].Path) != "b.txt" {
+		t.Fatalf("files = %+v", rep.Files)
+	}
+	if !errors.Is(rep.Files[2].Err, fs.ErrNotExist) {
+		t.Fatalf("missing file: %v", rep.Files[2].Err)
+	}
+	if rep.Total != (Counts{Lines: 3, Words: 11, Bytes: 43, Runes: 43}) {
+		t.Fatalf("total = %+v", rep.Total)
+	}
+	if got := fmt.Sprint(rep.Top); got != "[{cat 2} {bat 1} {end 1}]" {
+		t.Fatalf("top = %s", got)
+	}
+
+	// The same input gives the same report whatever the worker count.
+	for _, w := range []int{1, 8} {
+		again, _ := Run(context.Background(), paths, Options{Workers: w, TopN: 3, Fold: true, StopWords: DefaultStopWords})
+		if fmt.Sprint(again.Top, again.Total) != fmt.Sprint(rep.Top, rep.Total) {
+			t.Fatalf("workers=%d: %v %v", w, again.Top, again.Total)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Run(ctx, paths, Options{Workers: 1}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled run: %v", err)
+	}
+}
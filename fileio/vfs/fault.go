@@ -0,0 +1,232 @@
+package vfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sync"
+)
+
+// Fault describes an error to inject. A call matches when its operation is
+// Op and its name matches Path; after the first After matching calls, the
+// next Times calls (0 means all of them) fail with Err.
+type Fault struct {
+	// Op is one of "open" (Open, Create and OpenFile), "read" (Read and
+	// ReadAt), "write", "sync", "close", "rename" (matched on the old
+	// name), "remove" or "mkdir" (MkdirAll).
+	Op string
+	// Path is a path.Match pattern; "" matches every name.
+	Path  string
+	After int
+	Times int
+	// Err is the error returned, wrapped in a *fs.PathError; nil means
+	// ErrIO, or io.ErrShortWrite when Short is set.
+	Err error
+	// Short makes a failing write write half its buffer first, as a disk
+	// that fills up midway does.
+	Short bool
+}
+
+// FaultFS wraps an FS and fails chosen calls, to test how code handles a
+// disk that is full or failing. Operations that no Fault matches go
+// straight to the wrapped FS.
+type FaultFS struct {
+	fsys FS
+
+	mu     sync.Mutex
+	faults []Fault
+	calls  []int // matching calls seen, per fault
+	free   int64 // bytes left before ErrNoSpace; < 0 is unlimited
+}
+
+// NewFaultFS returns fsys with faults injected.
+func NewFaultFS(fsys FS, faults ...Fault) *FaultFS {
+	f := &FaultFS{fsys: fsys, free: -1}
+	for _, ft := range faults {
+		f.Inject(ft)
+	}
+	return f
+}
+
+// Inject adds a fault. Faults are checked in the order they were added.
+func (f *FaultFS) Inject(ft Fault) {
+	if _, err := path.Match(ft.Path, ""); err != nil {
+		panic("vfs: bad Fault.Path pattern " + ft.Path)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = append(f.faults, ft)
+	f.calls = append(f.calls, 0)
+}
+
+// SetFreeSpace lets n more bytes be written through f in total. A write
+// that does not fit writes what does and fails with ErrNoSpace. n < 0
+// removes the limit.
+func (f *FaultFS) SetFreeSpace(n int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.free = n
+}
+
+// fault returns the fault that fails op on name, if any, counting the
+// call against every fault it matches.
+func (f *FaultFS) fault(op, name string) *Fault {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var hit *Fault
+	for i := range f.faults {
+		ft := &f.faults[i]
+		if ft.Op != op {
+			continue
+		}
+		if ok, _ := path.Match(ft.Path, name); ft.Path != "" && !ok {
+			continue
+		}
+		f.calls[i]++
+		n := f.calls[i] - ft.After
+		if hit == nil && n > 0 && (ft.Times == 0 || n <= ft.Times) {
+			hit = ft
+		}
+	}
+	return hit
+}
+
+// check returns the injected error for op on name, if any.
+func (f *FaultFS) check(op, name string) error {
+	ft := f.fault(op, name)
+	if ft == nil {
+		return nil
+	}
+	return &fs.PathError{Op: op, Path: name, Err: ft.err()}
+}
+
+func (ft *Fault) err() error {
+	switch {
+	case ft.Err != nil:
+		return ft.Err
+	case ft.Short:
+		return io.ErrShortWrite
+	}
+	return ErrIO
+}
+
+func (f *FaultFS) Open(name string) (fs.File, error) {
+	if err := f.check("open", name); err != nil {
+		return nil, err
+	}
+	file, err := f.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	// Directories are returned as they are, so fs.ReadDir still works.
+	if fi, err := file.Stat(); err == nil && !fi.IsDir() {
+		if vf, ok := file.(File); ok {
+			return &faultFile{File: vf, fs: f, name: name}, nil
+		}
+	}
+	return file, nil
+}
+
+func (f *FaultFS) Stat(name string) (fs.FileInfo, error) { return f.fsys.Stat(name) }
+
+func (f *FaultFS) Create(name string) (File, error) {
+	return f.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+func (f *FaultFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	if err := f.check("open", name); err != nil {
+		return nil, err
+	}
+	file, err := f.fsys.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &faultFile{File: file, fs: f, name: name}, nil
+}
+
+func (f *FaultFS) Rename(oldname, newname string) error {
+	if ft := f.fault("rename", oldname); ft != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: ft.err()}
+	}
+	return f.fsys.Rename(oldname, newname)
+}
+
+func (f *FaultFS) Remove(name string) error {
+	if err := f.check("remove", name); err != nil {
+		return err
+	}
+	return f.fsys.Remove(name)
+}
+
+func (f *FaultFS) MkdirAll(name string, perm fs.FileMode) error {
+	if err := f.check("mkdir", name); err != nil {
+		return err
+	}
+	return f.fsys.MkdirAll(name, perm)
+}
+
+// faultFile is a file opened through a FaultFS. Faults match name, the
+// name it was opened by, rather than File.Name, which for Dir is an OS
+// path.
+type faultFile struct {
+	File
+	fs   *FaultFS
+	name string
+}
+
+func (f *faultFile) Read(p []byte) (int, error) {
+	if err := f.fs.check("read", f.name); err != nil {
+		return 0, err
+	}
+	return f.File.Read(p)
+}
+
+func (f *faultFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.fs.check("read", f.name); err != nil {
+		return 0, err
+	}
+	return f.File.ReadAt(p, off)
+}
+
+func (f *faultFile) Write(p []byte) (int, error) {
+	name := f.name
+	if ft := f.fs.fault("write", name); ft != nil {
+		n := 0
+		if ft.Short {
+			n, _ = f.File.Write(p[:len(p)/2])
+		}
+		return n, &fs.PathError{Op: "write", Path: name, Err: ft.err()}
+	}
+	f.fs.mu.Lock()
+	fits := len(p)
+	if f.fs.free >= 0 && int64(fits) > f.fs.free {
+		fits = int(f.fs.free)
+	}
+	if f.fs.free >= 0 {
+		f.fs.free -= int64(fits)
+	}
+	f.fs.mu.Unlock()
+	n, err := f.File.Write(p[:fits])
+	if err == nil && fits < len(p) {
+		err = &fs.PathError{Op: "write", Path: name, Err: ErrNoSpace}
+	}
+	return n, err
+}
+
+func (f *faultFile) Sync() error {
+	if err := f.fs.check("sync", f.name); err != nil {
+		return err
+	}
+	return f.File.Sync()
+}
+
+// Close closes the underlying file even when it reports an injected error,
+// as a failed close(2) still releases the descriptor.
+func (f *faultFile) Close() error {
+	err := f.File.Close()
+	if ferr := f.fs.check("close", f.name); ferr != nil {
+		return ferr
+	}
+	return err
+}
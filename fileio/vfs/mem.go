@@ -0,0 +1,356 @@
+package vfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// MemFS is an FS held in memory. It is safe for concurrent use, and open
+// files keep working after the name is renamed or removed, as on Unix.
+type MemFS struct {
+	mu    sync.RWMutex
+	nodes map[string]*memNode // by clean name; "." is the root
+}
+
+type memNode struct {
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// NewMem returns an empty MemFS.
+func NewMem() *MemFS {
+	return &MemFS{nodes: map[string]*memNode{
+		".": {mode: fs.ModeDir | 0o755, modTime: time.Now()},
+	}}
+}
+
+func (n *memNode) info(name string) fs.FileInfo {
+	return &fileInfo{name: path.Base(name), size: int64(len(n.data)), mode: n.mode, modTime: n.modTime}
+}
+
+// children returns the entries directly under dir. The caller holds m.mu.
+func (m *MemFS) children(dir string) []fs.DirEntry {
+	var out []fs.DirEntry
+	for name, n := range m.nodes {
+		if name != "." && parent(name) == dir {
+			out = append(out, fs.FileInfoToDirEntry(n.info(name)))
+		}
+	}
+	return out
+}
+
+// subtree returns name and every name below it. The caller holds m.mu.
+func (m *MemFS) subtree(name string) []string {
+	out := []string{name}
+	for k := range m.nodes {
+		if strings.HasPrefix(k, name+"/") {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+func (m *MemFS) Open(name string) (fs.File, error) {
+	if err := checkName("open", name); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n := m.nodes[name]
+	switch {
+	case n == nil:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case n.mode.IsDir():
+		return newDirFile(name, n.info(name), m.children(name)), nil
+	}
+	return &memFile{fs: m, name: name, node: n, flag: os.O_RDONLY}, nil
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	if err := checkName("stat", name); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n := m.nodes[name]
+	if n == nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return n.info(name), nil
+}
+
+func (m *MemFS) Create(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+// OpenFile opens a regular file; directories are opened with Open.
+func (m *MemFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	if err := checkName("open", name); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pathErr := func(err error) (File, error) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	n := m.nodes[name]
+	switch {
+	case n != nil && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return pathErr(fs.ErrExist)
+	case n != nil && n.mode.IsDir():
+		return pathErr(syscall.EISDIR)
+	case n != nil && flag&os.O_TRUNC != 0:
+		n.data = nil
+		n.modTime = time.Now()
+	case n == nil && flag&os.O_CREATE == 0:
+		return pathErr(fs.ErrNotExist)
+	case n == nil:
+		dir := m.nodes[parent(name)]
+		if dir == nil {
+			return pathErr(fs.ErrNotExist)
+		}
+		if !dir.mode.IsDir() {
+			return pathErr(syscall.ENOTDIR)
+		}
+		n = &memNode{mode: perm.Perm(), modTime: time.Now()}
+		m.nodes[name] = n
+	}
+	return &memFile{fs: m, name: name, node: n, flag: flag}, nil
+}
+
+// Rename moves a file or directory, replacing a file or empty directory of
+// the same kind at newname.
+func (m *MemFS) Rename(oldname, newname string) error {
+	linkErr := func(err error) error {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	if !fs.ValidPath(oldname) || !fs.ValidPath(newname) {
+		return linkErr(fs.ErrInvalid)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := m.nodes[oldname]
+	switch {
+	case n == nil:
+		return linkErr(fs.ErrNotExist)
+	case oldname == newname:
+		return nil
+	case oldname == "." || newname == "." || strings.HasPrefix(newname, oldname+"/"):
+		return linkErr(fs.ErrInvalid)
+	}
+	dir := m.nodes[parent(newname)]
+	switch {
+	case dir == nil:
+		return linkErr(fs.ErrNotExist)
+	case !dir.mode.IsDir():
+		return linkErr(syscall.ENOTDIR)
+	}
+	if old := m.nodes[newname]; old != nil {
+		switch {
+		case n.mode.IsDir() && !old.mode.IsDir():
+			return linkErr(syscall.ENOTDIR)
+		case !n.mode.IsDir() && old.mode.IsDir():
+			return linkErr(syscall.EISDIR)
+		case len(m.subtree(newname)) > 1:
+			return linkErr(syscall.ENOTEMPTY)
+		}
+	}
+	for _, k := range m.subtree(oldname) {
+		m.nodes[newname+k[len(oldname):]] = m.nodes[k]
+		delete(m.nodes, k)
+	}
+	return nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	pathErr := func(err error) error { return &fs.PathError{Op: "remove", Path: name, Err: err} }
+	if !fs.ValidPath(name) || name == "." {
+		return pathErr(fs.ErrInvalid)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case m.nodes[name] == nil:
+		return pathErr(fs.ErrNotExist)
+	case len(m.subtree(name)) > 1:
+		return pathErr(syscall.ENOTEMPTY)
+	}
+	delete(m.nodes, name)
+	return nil
+}
+
+func (m *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	if err := checkName("mkdir", name); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if name == "." {
+		return nil
+	}
+	elems := strings.Split(name, "/")
+	for i := range elems {
+		dir := strings.Join(elems[:i+1], "/")
+		switch n := m.nodes[dir]; {
+		case n == nil:
+			m.nodes[dir] = &memNode{mode: fs.ModeDir | perm.Perm(), modTime: time.Now()}
+		case !n.mode.IsDir():
+			return &fs.PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR}
+		}
+	}
+	return nil
+}
+
+// memFile is an open regular file. Its node is shared with the MemFS and
+// every other handle, all guarded by the MemFS's lock.
+type memFile struct {
+	fs     *MemFS
+	name   string
+	node   *memNode
+	flag   int
+	off    int64
+	closed bool
+}
+
+// check returns the error for op on f, if any. The caller holds f.fs.mu.
+func (f *memFile) check(op string, write bool) error {
+	var err error
+	switch {
+	case f.closed:
+		err = fs.ErrClosed
+	case write && f.flag&(os.O_WRONLY|os.O_RDWR) == 0:
+		err = syscall.EBADF
+	case !write && f.flag&os.O_WRONLY != 0:
+		err = syscall.EBADF
+	default:
+		return nil
+	}
+	return &fs.PathError{Op: op, Path: f.name, Err: err}
+}
+
+func (f *memFile) Name() string { return f.name }
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	f.fs.mu.RLock()
+	defer f.fs.mu.RUnlock()
+	if f.closed {
+		return nil, &fs.PathError{Op: "stat", Path: f.name, Err: fs.ErrClosed}
+	}
+	return f.node.info(f.name), nil
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("read", false); err != nil {
+		return 0, err
+	}
+	if f.off >= int64(len(f.node.data)) && len(p) > 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[min(f.off, int64(len(f.node.data))):])
+	f.off += int64(n)
+	return n, nil
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	f.fs.mu.RLock()
+	defer f.fs.mu.RUnlock()
+	if err := f.check("read", false); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "readat", Path: f.name, Err: fs.ErrInvalid}
+	}
+	var n int
+	if off < int64(len(f.node.data)) {
+		n = copy(p, f.node.data[off:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("write", true); err != nil {
+		return 0, err
+	}
+	if f.flag&os.O_APPEND != 0 {
+		f.off = int64(len(f.node.data))
+	}
+	end := f.off + int64(len(p))
+	if grow := end - int64(len(f.node.data)); grow > 0 {
+		f.node.data = append(f.node.data, make([]byte, grow)...)
+	}
+	copy(f.node.data[f.off:], p)
+	f.off = end
+	f.node.modTime = time.Now()
+	return len(p), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrClosed}
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += int64(len(f.node.data))
+	}
+	if offset < 0 || whence < io.SeekStart || whence > io.SeekEnd {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("truncate", true); err != nil {
+		return err
+	}
+	if size < 0 {
+		return &fs.PathError{Op: "truncate", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if size <= int64(len(f.node.data)) {
+		f.node.data = f.node.data[:size]
+	} else {
+		f.node.data = append(f.node.data, make([]byte, size-int64(len(f.node.data)))...)
+	}
+	f.node.modTime = time.Now()
+	return nil
+}
+
+// Sync has nothing to flush.
+func (f *memFile) Sync() error {
+	f.fs.mu.RLock()
+	defer f.fs.mu.RUnlock()
+	if f.closed {
+		return &fs.PathError{Op: "sync", Path: f.name, Err: fs.ErrClosed}
+	}
+	return nil
+}
+
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
@@ -0,0 +1,423 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+)
+
+// Overlay is a copy-on-write FS: it reads from an upper FS and a read-only
+// base beneath it, and writes only to the upper one.
+//
+// A name in upper hides the same name in base. Opening a base file for
+// writing first copies it up (unless O_TRUNC makes the copy pointless).
+// Removing or renaming away a base name records a whiteout in the Overlay
+// itself, hiding that name and everything below it in base; whiteouts are
+// not persisted.
+type Overlay struct {
+	base  fs.FS
+	upper FS
+
+	mu     sync.RWMutex
+	hidden map[string]bool // whiteouts over base
+}
+
+// NewOverlay returns an Overlay of upper over base. Use it to run code
+// that writes against real input without changing it:
+//
+//	fsys := vfs.NewOverlay(os.DirFS("testdata"), vfs.NewMem())
+func NewOverlay(base fs.FS, upper FS) *Overlay {
+	return &Overlay{base: base, upper: upper, hidden: map[string]bool{}}
+}
+
+// missing reports whether err means a name does not exist, including
+// because one of its parents is a file.
+func missing(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR)
+}
+
+// The helpers below expect the caller to hold o.mu.
+
+func (o *Overlay) whitedOut(name string) bool {
+	for {
+		if o.hidden[name] {
+			return true
+		}
+		if name == "." {
+			return false
+		}
+		name = parent(name)
+	}
+}
+
+// upperStat returns name's info in upper, or nil if it is not there.
+func (o *Overlay) upperStat(name string) (fs.FileInfo, error) {
+	fi, err := o.upper.Stat(name)
+	if missing(err) {
+		return nil, nil
+	}
+	return fi, err
+}
+
+// baseStat returns name's info in base, or nil if it is not there or is
+// whited out.
+func (o *Overlay) baseStat(name string) (fs.FileInfo, error) {
+	if o.whitedOut(name) {
+		return nil, nil
+	}
+	fi, err := fs.Stat(o.base, name)
+	if missing(err) {
+		return nil, nil
+	}
+	return fi, err
+}
+
+// stat returns name's info in the merged view and whether it comes from
+// upper.
+func (o *Overlay) stat(op, name string) (fi fs.FileInfo, inUpper bool, err error) {
+	if fi, err = o.upperStat(name); fi != nil || err != nil {
+		return fi, fi != nil, err
+	}
+	if fi, err = o.baseStat(name); fi != nil || err != nil {
+		return fi, false, err
+	}
+	return nil, false, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+// readDir lists the merged directory name: upper's entries, then base's
+// entries that upper does not shadow and are not whited out.
+func (o *Overlay) readDir(name string) ([]fs.DirEntry, error) {
+	var out []fs.DirEntry
+	seen := map[string]bool{}
+	if fi, err := o.upperStat(name); err != nil {
+		return nil, err
+	} else if fi != nil {
+		if !fi.IsDir() {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: syscall.ENOTDIR}
+		}
+		if out, err = fs.ReadDir(o.upper, name); err != nil {
+			return nil, err
+		}
+		for _, e := range out {
+			seen[e.Name()] = true
+		}
+	}
+	if o.whitedOut(name) {
+		return out, nil
+	}
+	entries, err := fs.ReadDir(o.base, name)
+	if err != nil && !missing(err) {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !seen[e.Name()] && !o.hidden[path.Join(name, e.Name())] {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (o *Overlay) Open(name string) (fs.File, error) {
+	if err := checkName("open", name); err != nil {
+		return nil, err
+	}
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	fi, inUpper, err := o.stat("open", name)
+	switch {
+	case err != nil:
+		return nil, err
+	case fi.IsDir():
+		entries, err := o.readDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return newDirFile(name, fi, entries), nil
+	case inUpper:
+		return o.upper.Open(name)
+	}
+	return o.base.Open(name)
+}
+
+func (o *Overlay) Stat(name string) (fs.FileInfo, error) {
+	if err := checkName("stat", name); err != nil {
+		return nil, err
+	}
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	fi, _, err := o.stat("stat", name)
+	return fi, err
+}
+
+func (o *Overlay) Create(name string) (File, error) {
+	return o.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+// OpenFile opens a regular file. Read-only opens of a base file return it
+// wrapped so that writes fail with EBADF; any other open is served by
+// upper, after copying the file up or checking that its parent exists.
+func (o *Overlay) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	if err := checkName("open", name); err != nil {
+		return nil, err
+	}
+	if !writable(flag) {
+		o.mu.RLock()
+		defer o.mu.RUnlock()
+	} else {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+	}
+	pathErr := func(err error) (File, error) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	fi, inUpper, err := o.stat("open", name)
+	switch {
+	case inUpper:
+		return o.upper.OpenFile(name, flag, perm)
+	case err != nil && !missing(err):
+		return nil, err
+	case fi != nil && fi.IsDir():
+		return pathErr(syscall.EISDIR)
+	case fi != nil && !writable(flag):
+		f, err := o.base.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		return &roFile{File: f, name: name}, nil
+	case fi != nil && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return pathErr(fs.ErrExist)
+	case fi != nil:
+		if flag&os.O_TRUNC != 0 {
+			err = o.mkdirUpper(parent(name))
+		} else {
+			err = o.copyUp(name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return o.upper.OpenFile(name, flag|os.O_CREATE, fi.Mode().Perm())
+	case flag&os.O_CREATE == 0:
+		return pathErr(fs.ErrNotExist)
+	}
+	dir, _, err := o.stat("open", parent(name))
+	switch {
+	case err != nil:
+		return pathErr(fs.ErrNotExist)
+	case !dir.IsDir():
+		return pathErr(syscall.ENOTDIR)
+	}
+	if err := o.mkdirUpper(parent(name)); err != nil {
+		return nil, err
+	}
+	return o.upper.OpenFile(name, flag, perm)
+}
+
+// mkdirUpper makes sure the directory name, which exists in the merged
+// view, also exists in upper, creating it and its parents with base's
+// permissions.
+func (o *Overlay) mkdirUpper(name string) error {
+	if fi, err := o.upperStat(name); fi != nil || err != nil {
+		return err
+	}
+	if err := o.mkdirUpper(parent(name)); err != nil {
+		return err
+	}
+	perm := fs.FileMode(0o755)
+	if fi, _ := o.baseStat(name); fi != nil {
+		perm = fi.Mode().Perm()
+	}
+	return o.upper.MkdirAll(name, perm)
+}
+
+// copyUp copies name, and everything below it if it is a directory, from
+// base into upper where upper does not have it already.
+func (o *Overlay) copyUp(name string) error {
+	fi, inUpper, err := o.stat("open", name)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		if err := o.mkdirUpper(name); err != nil {
+			return err
+		}
+		entries, err := o.readDir(name)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := o.copyUp(path.Join(name, e.Name())); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if inUpper {
+		return nil
+	}
+	if err := o.mkdirUpper(parent(name)); err != nil {
+		return err
+	}
+	data, err := fs.ReadFile(o.base, name)
+	if err != nil {
+		return err
+	}
+	return WriteFile(o.upper, name, data, fi.Mode().Perm())
+}
+
+func (o *Overlay) MkdirAll(name string, perm fs.FileMode) error {
+	if err := checkName("mkdir", name); err != nil {
+		return err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	fi, _, err := o.stat("mkdir", name)
+	switch {
+	case err == nil && fi.IsDir():
+		return nil
+	case err == nil:
+		return &fs.PathError{Op: "mkdir", Path: name, Err: syscall.ENOTDIR}
+	case !missing(err):
+		return err
+	}
+	// Copy up the deepest existing ancestor; upper creates the rest.
+	for dir := parent(name); ; dir = parent(dir) {
+		fi, _, err := o.stat("mkdir", dir)
+		if err == nil && !fi.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR}
+		}
+		if err == nil {
+			if err := o.mkdirUpper(dir); err != nil {
+				return err
+			}
+			break
+		}
+		if !missing(err) {
+			return err
+		}
+	}
+	return o.upper.MkdirAll(name, perm)
+}
+
+// Remove removes name from upper and whites it out in base.
+func (o *Overlay) Remove(name string) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	fi, inUpper, err := o.stat("remove", name)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		entries, err := o.readDir(name)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return &fs.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+	}
+	if inUpper {
+		if err := o.upper.Remove(name); err != nil {
+			return err
+		}
+	}
+	if fi, _ := o.baseStat(name); fi != nil {
+		o.hidden[name] = true
+	}
+	return nil
+}
+
+// Rename copies oldname up from base, renames it within upper, and whites
+// out both names in base.
+func (o *Overlay) Rename(oldname, newname string) error {
+	linkErr := func(err error) error {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	if !fs.ValidPath(oldname) || !fs.ValidPath(newname) {
+		return linkErr(fs.ErrInvalid)
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	ofi, _, err := o.stat("rename", oldname)
+	if err != nil {
+		return linkErr(fs.ErrNotExist)
+	}
+	if oldname == newname {
+		return nil
+	}
+	dir, _, err := o.stat("rename", parent(newname))
+	switch {
+	case err != nil:
+		return linkErr(fs.ErrNotExist)
+	case !dir.IsDir():
+		return linkErr(syscall.ENOTDIR)
+	}
+	// Check the target in the merged view: upper alone may not have it.
+	if nfi, _, err := o.stat("rename", newname); err == nil {
+		switch {
+		case ofi.IsDir() && !nfi.IsDir():
+			return linkErr(syscall.ENOTDIR)
+		case !ofi.IsDir() && nfi.IsDir():
+			return linkErr(syscall.EISDIR)
+		case nfi.IsDir():
+			if entries, err := o.readDir(newname); err != nil {
+				return err
+			} else if len(entries) > 0 {
+				return linkErr(syscall.ENOTEMPTY)
+			}
+		}
+	}
+	if err := o.copyUp(oldname); err != nil {
+		return err
+	}
+	if err := o.mkdirUpper(parent(newname)); err != nil {
+		return err
+	}
+	if err := o.upper.Rename(oldname, newname); err != nil {
+		return err
+	}
+	for _, name := range []string{oldname, newname} {
+		if fi, _ := o.baseStat(name); fi != nil {
+			o.hidden[name] = true
+		}
+	}
+	return nil
+}
+
+// roFile is a base file opened read-only through OpenFile.
+type roFile struct {
+	fs.File
+	name string
+}
+
+func (f *roFile) Name() string { return f.name }
+
+func (f *roFile) Write([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.name, Err: syscall.EBADF}
+}
+
+func (f *roFile) Truncate(int64) error {
+	return &fs.PathError{Op: "truncate", Path: f.name, Err: syscall.EBADF}
+}
+
+func (f *roFile) Sync() error { return nil }
+
+func (f *roFile) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := f.File.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+	return 0, &fs.PathError{Op: "seek", Path: f.name, Err: errors.ErrUnsupported}
+}
+
+func (f *roFile) ReadAt(p []byte, off int64) (int, error) {
+	if r, ok := f.File.(io.ReaderAt); ok {
+		return r.ReadAt(p, off)
+	}
+	return 0, &fs.PathError{Op: "readat", Path: f.name, Err: errors.ErrUnsupported}
+}
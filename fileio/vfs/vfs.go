@@ -0,0 +1,167 @@
+// Package vfs is a writable filesystem interface with interchangeable
+// implementations, so file-handling code can run against the real disk,
+// memory, or a disk that fails on demand.
+//
+// io/fs.FS only reads. FS adds the calls the fileio examples make through
+// package os (Create, OpenFile, Rename, Remove, MkdirAll) and has four
+// implementations:
+//
+//   - Dir: the operating system's files under a root directory
+//   - NewMem: an in-memory tree, for hermetic tests
+//   - NewOverlay: reads fall through to a base fs.FS, writes land in an
+//     upper FS (copy-on-write), so a program can read real files without
+//     modifying them
+//   - NewFaultFS: wraps another FS and injects errors such as ENOSPC and
+//     EIO, or short writes, at chosen operations and paths
+//
+// Names follow io/fs: slash-separated, relative, no "." or ".." elements
+// (fs.ValidPath). Errors are *fs.PathError (*os.LinkError for Rename) and
+// match fs.ErrNotExist, fs.ErrExist and friends with errors.Is.
+package vfs
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// File is an open file. *os.File implements it.
+type File interface {
+	fs.File
+	io.Writer
+	io.Seeker
+	io.ReaderAt
+	Name() string
+	Sync() error
+	Truncate(size int64) error
+}
+
+// FS is a filesystem that can be written as well as read. Open returns
+// directories as fs.ReadDirFile, so fs.ReadDir and fs.WalkDir work.
+type FS interface {
+	fs.StatFS
+	// Create creates or truncates name for reading and writing, as
+	// os.Create.
+	Create(name string) (File, error)
+	// OpenFile opens name with os.O_* flags, as os.OpenFile.
+	OpenFile(name string, flag int, perm fs.FileMode) (File, error)
+	Rename(oldname, newname string) error
+	// Remove removes a file or an empty directory.
+	Remove(name string) error
+	MkdirAll(name string, perm fs.FileMode) error
+}
+
+// Errors injected by FaultFS, and reported by Mem where the OS would.
+var (
+	ErrNoSpace error = syscall.ENOSPC
+	ErrIO      error = syscall.EIO
+)
+
+// WriteFile writes data to name in fsys, as os.WriteFile.
+func WriteFile(fsys FS, name string, data []byte, perm fs.FileMode) error {
+	f, err := fsys.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// FromEnv returns the filesystem named by $FILEIO_FS, for programs such
+// as the fileio examples: "overlay" (the default) reads the current
+// directory but keeps every write in memory, "mem" starts empty, and "os"
+// reads and writes the current directory.
+func FromEnv() (FS, error) {
+	switch v := os.Getenv("FILEIO_FS"); v {
+	case "", "overlay":
+		return NewOverlay(os.DirFS("."), NewMem()), nil
+	case "mem":
+		return NewMem(), nil
+	case "os":
+		return Dir("."), nil
+	default:
+		return nil, fmt.Errorf("vfs: FILEIO_FS=%q: want overlay, mem or os", v)
+	}
+}
+
+func checkName(op, name string) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return nil
+}
+
+// writable reports whether flag opens for writing or may change the file.
+func writable(flag int) bool {
+	return flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0
+}
+
+// fileInfo is the fs.FileInfo of Mem and Overlay entries.
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() fs.FileMode  { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() any           { return nil }
+
+// dirFile is an open directory whose entries were listed at Open.
+type dirFile struct {
+	name    string
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	off     int
+	closed  bool
+}
+
+func newDirFile(name string, info fs.FileInfo, entries []fs.DirEntry) *dirFile {
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return &dirFile{name: name, info: info, entries: entries}
+}
+
+func (d *dirFile) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+func (d *dirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: syscall.EISDIR}
+}
+
+func (d *dirFile) Close() error {
+	if d.closed {
+		return &fs.PathError{Op: "close", Path: d.name, Err: fs.ErrClosed}
+	}
+	d.closed = true
+	return nil
+}
+
+// ReadDir follows the fs.ReadDirFile contract.
+func (d *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.off:]
+	if n <= 0 {
+		d.off = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	rest = rest[:min(n, len(rest))]
+	d.off += len(rest)
+	return rest, nil
+}
+
+// parent returns the directory containing name ("." for top-level names).
+func parent(name string) string { return path.Dir(name) }
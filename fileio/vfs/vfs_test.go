@@ -0,0 +1,270 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"syscall"
+	"testing"
+	"testing/fstest"
+
+	"gobyexamples/goroutine/leakcheck"
+)
+
+func mustWrite(t *testing.T, fsys FS, name, data string) {
+	t.Helper()
+	if err := WriteFile(fsys, name, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustRead(t *testing.T, fsys fs.FS, name, want string) {
+	t.Helper()
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil || string(b) != want {
+		t.Fatalf("read %s: %q, %v; want %q", name, b, err, want)
+	}
+}
+
+func names(t *testing.T, fsys fs.FS, dir string) []string {
+	t.Helper()
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, e := range entries {
+		out = append(out, e.Name())
+	}
+	return out
+}
+
+// testFS checks that an empty fsys behaves like the OS.
+func testFS(t *testing.T, fsys FS) {
+	if err := fsys.MkdirAll("a/b", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, fsys, "a/b/c.txt", "hello")
+	mustWrite(t, fsys, "top.txt", "top")
+
+	f, err := fsys.OpenFile("a/b/c.txt", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(2, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("LLO, world")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if n, err := f.ReadAt(buf, 7); n != 5 || err != nil || string(buf) != "world" {
+		t.Fatalf("ReadAt: %d, %v, %q", n, err, buf)
+	}
+	if err := f.Truncate(5); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); !errors.Is(err, fs.ErrClosed) {
+		t.Fatalf("second Close: %v", err)
+	}
+	mustRead(t, fsys, "a/b/c.txt", "heLLO")
+
+	f, err = fsys.OpenFile("top.txt", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Seek(0, io.SeekStart)
+	f.Write([]byte("+more"))
+	if _, err := f.Read(buf); err == nil {
+		t.Fatal("Read of a write-only file succeeded")
+	}
+	f.Close()
+	mustRead(t, fsys, "top.txt", "top+more")
+
+	if err := fstest.TestFS(fsys, "a/b/c.txt", "top.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name string
+		err  error
+	}{
+		{"missing/x", fs.ErrNotExist},
+		{"../x", fs.ErrInvalid},
+		{"/x", fs.ErrInvalid},
+	} {
+		if _, err := fsys.Create(c.name); !errors.Is(err, c.err) {
+			t.Errorf("Create(%q): %v, want %v", c.name, err, c.err)
+		}
+	}
+	if _, err := fsys.OpenFile("top.txt", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("O_EXCL on existing file: %v", err)
+	}
+	if _, err := fsys.Open("nope"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open missing: %v", err)
+	}
+	if err := fsys.MkdirAll("top.txt/x", 0o755); !errors.Is(err, syscall.ENOTDIR) {
+		t.Errorf("MkdirAll under a file: %v", err)
+	}
+
+	if err := fsys.Rename("a", "z"); err != nil {
+		t.Fatal(err)
+	}
+	mustRead(t, fsys, "z/b/c.txt", "heLLO")
+	if _, err := fsys.Stat("a"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Stat after rename: %v", err)
+	}
+	if err := fsys.Remove("z/b"); err == nil {
+		t.Fatal("Remove of a non-empty directory succeeded")
+	}
+	for _, name := range []string{"z/b/c.txt", "z/b", "z"} {
+		if err := fsys.Remove(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := names(t, fsys, "."); !slices.Equal(got, []string{"top.txt"}) {
+		t.Fatalf("left behind %q", got)
+	}
+}
+
+func TestDir(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	testFS(t, Dir(t.TempDir()))
+}
+
+func TestMem(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	testFS(t, NewMem())
+}
+
+func TestOverlayConformance(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	testFS(t, NewOverlay(os.DirFS(t.TempDir()), NewMem()))
+}
+
+func TestOverlay(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	dir := t.TempDir()
+	disk := Dir(dir)
+	mustWrite(t, disk, "keep.txt", "base")
+	mustWrite(t, disk, "edit.txt", "base")
+	mustWrite(t, disk, "gone.txt", "base")
+	if err := disk.MkdirAll("d/e", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, disk, "d/e/f.txt", "base")
+
+	o := NewOverlay(os.DirFS(dir), NewMem())
+	f, err := o.OpenFile("edit.txt", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("+upper"))
+	f.Close()
+	mustWrite(t, o, "d/new.txt", "upper")
+	if err := o.Remove("gone.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Rename("d/e", "moved"); err != nil {
+		t.Fatal(err)
+	}
+
+	mustRead(t, o, "keep.txt", "base")
+	mustRead(t, o, "edit.txt", "base+upper")
+	mustRead(t, o, "moved/f.txt", "base")
+	if got, want := names(t, o, "."), []string{"d", "edit.txt", "keep.txt", "moved"}; !slices.Equal(got, want) {
+		t.Fatalf("root: %q, want %q", got, want)
+	}
+	if got := names(t, o, "d"); !slices.Equal(got, []string{"new.txt"}) {
+		t.Fatalf("d: %q", got)
+	}
+	for _, name := range []string{"gone.txt", "d/e", "d/e/f.txt"} {
+		if _, err := o.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Stat(%q) after whiteout: %v", name, err)
+		}
+	}
+	if err := fstest.TestFS(o, "keep.txt", "edit.txt", "d/new.txt", "moved/f.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A whited-out name can be created again, without its base contents.
+	if err := o.MkdirAll("d/e", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(t, o, "d/e"); len(got) != 0 {
+		t.Fatalf("recreated d/e: %q", got)
+	}
+
+	// Read-only opens of base files cannot write.
+	f, err = o.OpenFile("keep.txt", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("x")); !errors.Is(err, syscall.EBADF) {
+		t.Fatalf("write to read-only base file: %v", err)
+	}
+	f.Close()
+
+	// None of it reached the disk.
+	for _, name := range []string{"keep.txt", "edit.txt", "gone.txt", "d/e/f.txt"} {
+		mustRead(t, disk, name, "base")
+	}
+	if got := names(t, disk, "d"); !slices.Equal(got, []string{"e"}) {
+		t.Fatalf("disk d: %q", got)
+	}
+}
+
+func TestFaultFS(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	mem := NewMem()
+	fsys := NewFaultFS(mem,
+		Fault{Op: "sync", Path: "*.db", After: 1, Times: 1},
+		Fault{Op: "write", Path: "short.txt", Short: true},
+		Fault{Op: "rename", Err: syscall.EACCES},
+	)
+
+	f, err := fsys.Create("x.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []error{nil, ErrIO, nil} {
+		if err := f.Sync(); !errors.Is(err, want) {
+			t.Fatalf("sync %d: %v, want %v", i, err, want)
+		}
+	}
+	f.Close()
+
+	f, err = fsys.Create("short.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.Write([]byte("abcdef")); n != 3 || !errors.Is(err, io.ErrShortWrite) {
+		t.Fatalf("short write: %d, %v", n, err)
+	}
+	f.Close()
+	mustRead(t, fsys, "short.txt", "abc")
+
+	if err := fsys.Rename("x.db", "y.db"); !errors.Is(err, syscall.EACCES) {
+		t.Fatalf("rename: %v", err)
+	}
+
+	fsys.SetFreeSpace(10)
+	err = WriteFile(fsys, "full.txt", []byte("0123456789abc"), 0o644)
+	if !errors.Is(err, ErrNoSpace) {
+		t.Fatalf("write past free space: %v", err)
+	}
+	mustRead(t, mem, "full.txt", "0123456789")
+	if err := WriteFile(fsys, "more.txt", []byte("x"), 0o644); !errors.Is(err, ErrNoSpace) {
+		t.Fatalf("write on a full disk: %v", err)
+	}
+	fsys.SetFreeSpace(-1)
+	mustWrite(t, fsys, "more.txt", "x")
+}
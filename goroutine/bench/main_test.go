@@ -0,0 +1,10 @@
+package counter
+
+import (
+	"testing"
+
+	"gobyexamples/goroutine/leakcheck"
+)
+
+// Fail the run if a benchmark leaves goroutines behind.
+func TestMain(m *testing.M) { leakcheck.VerifyTestMain(m, leakcheck.Options{}) }
@@ -0,0 +1,67 @@
+// Package clock abstracts the time package so code that sleeps, ticks or
+// times out can be tested without waiting.
+//
+// Production code takes a Clock and is given RealClock{}. Tests give it a
+// *Fake, which only moves when Advance is called; BlockUntil lets a test
+// wait until the code under test is parked on a timer before advancing, so
+// no test needs a time.Sleep to "let the goroutine get there".
+//
+//	clk := clock.NewFake(time.Time{})
+//	go worker(clk)        // calls clk.Sleep(time.Minute)
+//	clk.BlockUntil(1)     // worker is now sleeping
+//	clk.Advance(time.Minute)
+package clock
+
+import "time"
+
+// Clock is the subset of the time package that code under test uses.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+	// AfterFunc calls f after d. The returned Timer's C is nil.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is *time.Timer as an interface.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker is *time.Ticker as an interface.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+	Reset(d time.Duration)
+}
+
+// RealClock uses the time package.
+type RealClock struct{}
+
+func (RealClock) Now() time.Time                         { return time.Now() }
+func (RealClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (RealClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (RealClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (RealClock) NewTimer(d time.Duration) Timer         { return realTimer{time.NewTimer(d)} }
+func (RealClock) NewTicker(d time.Duration) Ticker       { return realTicker{time.NewTicker(d)} }
+
+func (RealClock) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{time.AfterFunc(d, f)}
+}
+
+type realTimer struct{ t *time.Timer }
+
+func (r realTimer) C() <-chan time.Time        { return r.t.C }
+func (r realTimer) Stop() bool                 { return r.t.Stop() }
+func (r realTimer) Reset(d time.Duration) bool { return r.t.Reset(d) }
+
+type realTicker struct{ t *time.Ticker }
+
+func (r realTicker) C() <-chan time.Time   { return r.t.C }
+func (r realTicker) Stop()                 { r.t.Stop() }
+func (r realTicker) Reset(d time.Duration) { r.t.Reset(d) }
@@ -0,0 +1,232 @@
+package clock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func fired(c <-chan time.Time) (time.Time, bool) {
+	select {
+	case t := <-c:
+		return t, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func TestFakeTimer(t *testing.T) {
+	f := NewFake(epoch)
+	tm := f.NewTimer(time.Second)
+	f.Advance(999 * time.Millisecond)
+	if _, ok := fired(tm.C()); ok {
+		t.Fatal("fired early")
+	}
+	f.Advance(time.Millisecond)
+	if at, ok := fired(tm.C()); !ok || !at.Equal(epoch.Add(time.Second)) {
+		t.Fatalf("fired=%v at %v", ok, at)
+	}
+	if tm.Stop() {
+		t.Fatal("Stop after firing reported active")
+	}
+
+	if tm.Reset(time.Second); !tm.Stop() {
+		t.Fatal("Stop after Reset reported inactive")
+	}
+	f.Advance(time.Hour)
+	if _, ok := fired(tm.C()); ok {
+		t.Fatal("stopped timer fired")
+	}
+	if f.Waiters() != 0 {
+		t.Fatalf("waiters = %d", f.Waiters())
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	f := NewFake(epoch)
+	tk := f.NewTicker(10 * time.Millisecond)
+	defer tk.Stop()
+	var ticks []time.Duration
+	for i := 0; i < 3; i++ {
+		f.Advance(10 * time.Millisecond)
+		at, ok := fired(tk.C())
+		if !ok {
+			t.Fatalf("tick %d missing", i)
+		}
+		ticks = append(ticks, at.Sub(epoch))
+	}
+	if ticks[2] != 30*time.Millisecond {
+		t.Fatalf("ticks = %v", ticks)
+	}
+
+	// A slow receiver gets one buffered tick, not a backlog.
+	f.Advance(100 * time.Millisecond)
+	if _, ok := fired(tk.C()); !ok {
+		t.Fatal("no tick after long advance")
+	}
+	if _, ok := fired(tk.C()); ok {
+		t.Fatal("ticks queued up")
+	}
+
+	tk.Reset(time.Second)
+	f.Advance(500 * time.Millisecond)
+	if _, ok := fired(tk.C()); ok {
+		t.Fatal("old period still in effect after Reset")
+	}
+}
+
+func TestSleepAndBlockUntil(t *testing.T) {
+	f := NewFake(epoch)
+	woke := make(chan time.Time)
+	for i := 1; i <= 2; i++ {
+		go func() {
+			f.Sleep(time.Duration(i) * time.Minute)
+			woke <- f.Now()
+		}()
+	}
+	f.BlockUntil(2)
+	f.Advance(time.Minute)
+	if at := <-woke; !at.Equal(epoch.Add(time.Minute)) {
+		t.Fatalf("first sleeper woke at %v", at)
+	}
+	select {
+	case <-woke:
+		t.Fatal("second sleeper woke early")
+	default:
+	}
+	f.Advance(time.Minute)
+	<-woke
+}
+
+func TestAfterFuncOrderAndNow(t *testing.T) {
+	f := NewFake(epoch)
+	var got []time.Duration
+	for _, d := range []time.Duration{3, 1, 2} {
+		f.AfterFunc(d*time.Second, func() { got = append(got, f.Since(epoch)) })
+	}
+	stopped := f.AfterFunc(time.Second, func() { t.Error("stopped AfterFunc ran") })
+	stopped.Stop()
+	f.Advance(10 * time.Second)
+	want := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}
+	if len(got) != 3 || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Fatalf("callbacks saw %v, want %v", got, want)
+	}
+	if f.Since(epoch) != 10*time.Second {
+		t.Fatalf("Now after Advance = %v", f.Now())
+	}
+}
+
+func TestFakeNonPositiveDurations(t *testing.T) {
+	f := NewFake(epoch)
+	f.Sleep(0)
+	if at := <-f.After(-time.Second); !at.Equal(epoch) {
+		t.Fatalf("After(-1s) fired at %v", at)
+	}
+	tm := f.NewTimer(time.Second)
+	tm.Reset(0)
+	if at, ok := fired(tm.C()); !ok || !at.Equal(epoch) {
+		t.Fatalf("Reset(0): fired=%v at %v", ok, at)
+	}
+	ran := make(chan struct{})
+	f.AfterFunc(0, func() { close(ran) })
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("AfterFunc(0) did not run without Advance")
+	}
+	if n := f.Waiters(); n != 0 {
+		t.Fatalf("%d waiters left pending", n)
+	}
+}
+
+func TestWithTimeoutOnFake(t *testing.T) {
+	f := NewFake(epoch)
+	ctx, cancel := WithTimeout(context.Background(), f, time.Minute)
+	defer cancel()
+	if dl, ok := ctx.Deadline(); !ok || !dl.Equal(epoch.Add(time.Minute)) {
+		t.Fatalf("deadline = %v, %v", dl, ok)
+	}
+	f.Advance(59 * time.Second)
+	if ctx.Err() != nil {
+		t.Fatal("expired early")
+	}
+	f.Advance(time.Second)
+	select {
+	case <-ctx.Done():
+	default:
+		t.Fatal("not done after deadline")
+	}
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		t.Fatalf("Err = %v", ctx.Err())
+	}
+
+	// Cancel and parent cancellation still work, and stop the timer.
+	ctx2, cancel2 := WithTimeout(context.Background(), f, time.Minute)
+	cancel2()
+	if !errors.Is(ctx2.Err(), context.Canceled) || f.Waiters() != 0 {
+		t.Fatalf("Err = %v, waiters = %d", ctx2.Err(), f.Waiters())
+	}
+	parent, cancelParent := context.WithCancel(context.WithValue(context.Background(), epoch, "v"))
+	ctx3, cancel3 := WithTimeout(parent, f, time.Minute)
+	defer cancel3()
+	if ctx3.Value(epoch) != "v" {
+		t.Fatal("values not inherited")
+	}
+	cancelParent()
+	<-ctx3.Done()
+	if !errors.Is(ctx3.Err(), context.Canceled) {
+		t.Fatalf("Err = %v", ctx3.Err())
+	}
+
+	// A deadline already in the past is expired at once.
+	past, cancel4 := WithDeadline(context.Background(), f, epoch)
+	defer cancel4()
+	if !errors.Is(past.Err(), context.DeadlineExceeded) {
+		t.Fatalf("past deadline Err = %v", past.Err())
+	}
+}
+
+func TestWithTimeoutCancelledParent(t *testing.T) {
+	f := NewFake(epoch)
+	parent, cancelParent := context.WithCancel(context.Background())
+	cancelParent()
+	ctx, cancel := WithTimeout(parent, f, time.Minute)
+	defer cancel()
+	if !errors.Is(ctx.Err(), context.Canceled) || f.Waiters() != 0 {
+		t.Fatalf("Err = %v, waiters = %d", ctx.Err(), f.Waiters())
+	}
+
+	// Parent cancellation and clock advances racing with WithTimeout
+	// must still stop the timer.
+	for range 100 {
+		parent, cancelParent := context.WithCancel(context.Background())
+		go cancelParent()
+		go f.Advance(time.Minute)
+		ctx, cancel := WithTimeout(parent, f, time.Minute)
+		<-ctx.Done()
+		cancel()
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for f.Waiters() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d timers left pending", f.Waiters())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRealClock(t *testing.T) {
+	var c Clock = RealClock{}
+	ctx, cancel := WithTimeout(context.Background(), c, time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		t.Fatalf("Err = %v", ctx.Err())
+	}
+	done := make(chan struct{})
+	c.AfterFunc(time.Millisecond, func() { close(done) })
+	<-done
+}
@@ -0,0 +1,79 @@
+package clock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WithTimeout is context.WithTimeout measured on c.
+func WithTimeout(parent context.Context, c Clock, d time.Duration) (context.Context, context.CancelFunc) {
+	return WithDeadline(parent, c, c.Now().Add(d))
+}
+
+// WithDeadline is context.WithDeadline measured on c: with a *Fake the
+// context expires (with context.DeadlineExceeded) when the clock is
+// advanced past deadline.
+func WithDeadline(parent context.Context, c Clock, deadline time.Time) (context.Context, context.CancelFunc) {
+	if _, ok := c.(RealClock); ok {
+		return context.WithDeadline(parent, deadline)
+	}
+	if cur, ok := parent.Deadline(); ok && !cur.After(deadline) {
+		return context.WithCancel(parent)
+	}
+	ctx := &deadlineCtx{Context: parent, deadline: deadline, done: make(chan struct{})}
+	d := deadline.Sub(c.Now())
+	if d <= 0 {
+		ctx.cancel(context.DeadlineExceeded)
+		return ctx, func() {}
+	}
+	if err := parent.Err(); err != nil {
+		ctx.cancel(err)
+		return ctx, func() {}
+	}
+	// Register under mu so that a cancel racing with us (the parent's, or
+	// the timer's on a clock advanced elsewhere) waits and then sees stop.
+	ctx.mu.Lock()
+	t := c.AfterFunc(d, func() { ctx.cancel(context.DeadlineExceeded) })
+	stopParent := context.AfterFunc(parent, func() { ctx.cancel(parent.Err()) })
+	ctx.stop = func() {
+		t.Stop()
+		stopParent()
+	}
+	ctx.mu.Unlock()
+	return ctx, func() { ctx.cancel(context.Canceled) }
+}
+
+type deadlineCtx struct {
+	context.Context // parent, for Value
+	deadline        time.Time
+	done            chan struct{}
+
+	mu   sync.Mutex
+	err  error
+	stop func()
+}
+
+func (c *deadlineCtx) Deadline() (time.Time, bool) { return c.deadline, true }
+func (c *deadlineCtx) Done() <-chan struct{}       { return c.done }
+
+func (c *deadlineCtx) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *deadlineCtx) cancel(err error) {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return
+	}
+	c.err = err
+	close(c.done)
+	stop := c.stop
+	c.mu.Unlock()
+	if stop != nil {
+		stop()
+	}
+}
@@ -0,0 +1,206 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake is a Clock whose time only moves when Advance is called. Timers,
+// tickers, sleeps and AfterFunc callbacks fire during Advance, in deadline
+// order, with Now reading the deadline being fired.
+type Fake struct {
+	mu      sync.Mutex
+	cond    sync.Cond // signalled when the set of waiters changes
+	now     time.Time
+	waiters []*fakeTimer
+}
+
+// NewFake returns a fake clock reading start.
+func NewFake(start time.Time) *Fake {
+	f := &Fake{now: start}
+	f.cond.L = &f.mu
+	return f
+}
+
+type fakeTimer struct {
+	f      *Fake
+	at     time.Time
+	period time.Duration // > 0 for tickers
+	c      chan time.Time
+	fn     func() // AfterFunc
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *Fake) Since(t time.Time) time.Duration { return f.Now().Sub(t) }
+
+// Sleep blocks until the clock has been advanced by d. Like time.Sleep it
+// returns at once for d <= 0.
+func (f *Fake) Sleep(d time.Duration) { <-f.NewTimer(d).C() }
+
+func (f *Fake) After(d time.Duration) <-chan time.Time { return f.NewTimer(d).C() }
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{f: f, c: make(chan time.Time, 1)}
+	f.schedule(t, d)
+	return t
+}
+
+// AfterFunc calls fn from within Advance, on the advancing goroutine, so
+// its effects are visible when Advance returns. fn must not call Advance.
+// For d <= 0 there is nothing to wait for, and fn runs in its own goroutine
+// at once, as with time.AfterFunc.
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	t := &fakeTimer{f: f, fn: fn}
+	f.schedule(t, d)
+	return t
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	t := &fakeTimer{f: f, period: d, c: make(chan time.Time, 1)}
+	f.schedule(t, d)
+	return fakeTicker{t}
+}
+
+// schedule arms t to fire d from now. Timers and AfterFuncs with d <= 0
+// fire immediately instead of waiting for an Advance.
+func (f *Fake) schedule(t *fakeTimer, d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t.at = f.now.Add(d)
+	if d <= 0 && t.period == 0 {
+		if t.fn != nil {
+			go t.fn()
+			return
+		}
+		select {
+		case t.c <- f.now:
+		default:
+		}
+		return
+	}
+	f.waiters = append(f.waiters, t)
+	f.cond.Broadcast()
+}
+
+// unschedule reports whether t was pending. f.mu must be held.
+func (f *Fake) unschedule(t *fakeTimer) bool {
+	for i, w := range f.waiters {
+		if w == t {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			f.cond.Broadcast()
+			return true
+		}
+	}
+	return false
+}
+
+// Advance moves the clock forward by d, firing everything due on the way.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	end := f.now.Add(d)
+	for {
+		t := f.next(end)
+		if t == nil {
+			break
+		}
+		if t.at.After(f.now) {
+			f.now = t.at
+		}
+		switch {
+		case t.fn != nil:
+			f.unschedule(t)
+			f.mu.Unlock()
+			t.fn()
+			f.mu.Lock()
+		case t.period > 0:
+			select {
+			case t.c <- f.now:
+			default: // like time.Ticker, drop ticks for slow receivers
+			}
+			t.at = t.at.Add(t.period)
+		default:
+			f.unschedule(t)
+			t.c <- f.now
+		}
+	}
+	if end.After(f.now) {
+		f.now = end
+	}
+	f.mu.Unlock()
+}
+
+// next returns the earliest waiter due by end. f.mu must be held.
+func (f *Fake) next(end time.Time) *fakeTimer {
+	var first *fakeTimer
+	for _, t := range f.waiters {
+		if !t.at.After(end) && (first == nil || t.at.Before(first.at)) {
+			first = t
+		}
+	}
+	return first
+}
+
+// BlockUntil waits until at least n timers, tickers, sleeps or AfterFuncs
+// are pending on the clock.
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
+
+// Waiters returns how many timers, tickers, sleeps and AfterFuncs are
+// pending.
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+// Stop prevents the timer from firing and, as with Go 1.23 timers, drains
+// a value that was sent but not yet received.
+func (t *fakeTimer) Stop() bool {
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+	t.drain()
+	return t.f.unschedule(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.f.mu.Lock()
+	was := t.f.unschedule(t)
+	t.drain()
+	if t.period > 0 {
+		t.period = d
+	}
+	t.f.mu.Unlock()
+	t.f.schedule(t, d)
+	return was
+}
+
+func (t *fakeTimer) drain() {
+	if t.c == nil {
+		return
+	}
+	select {
+	case <-t.c:
+	default:
+	}
+}
+
+// Ticker's Stop and Reset have no results; fakeTicker adapts fakeTimer.
+type fakeTicker struct{ *fakeTimer }
+
+func (t fakeTicker) Stop()                 { t.fakeTimer.Stop() }
+func (t fakeTicker) Reset(d time.Duration) { t.fakeTimer.Reset(d) }
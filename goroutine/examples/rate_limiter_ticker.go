@@ -3,30 +3,45 @@ package main
 import (
 	"fmt"
 	"time"
+
+	"gobyexamples/goroutine/clock"
 )
 
 // Run with: go run goroutine/examples/rate_limiter_ticker.go
-// Token bucket using time.Ticker and a buffered channel as the bucket.
+// Test with: go test goroutine/examples/rate_limiter_ticker.go goroutine/examples/rate_limiter_ticker_test.go
+// Token bucket using a Ticker and a buffered channel as the bucket. The
+// clock is injected so the test drives it with clock.Fake instead of sleeping.
 func main() {
-	bucket := make(chan struct{}, 5) // capacity = burst size
-	// fill tokens periodically
-	t := time.NewTicker(50 * time.Millisecond)
-	defer t.Stop()
-	go func() {
-		for range t.C {
-			select {
-			case bucket <- struct{}{}:
-				// added a token
-			default:
-				// bucket full; drop token
-			}
-		}
-	}()
+	clk := clock.RealClock{}
+	bucket, stop := tokenBucket(clk, 50*time.Millisecond, 5)
+	defer stop()
 
 	// use tokens to rate-limit work
 	for i := 0; i < 12; i++ {
 		<-bucket
-		fmt.Printf("req %d at %v\n", i, time.Now().Format("15:04:05.000"))
+		fmt.Printf("req %d at %v\n", i, clk.Now().Format("15:04:05.000"))
 	}
 }
 
+// tokenBucket adds a token every interval, holding at most burst.
+func tokenBucket(clk clock.Clock, every time.Duration, burst int) (<-chan struct{}, func()) {
+	bucket := make(chan struct{}, burst) // capacity = burst size
+	t := clk.NewTicker(every)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-t.C():
+				select {
+				case bucket <- struct{}{}:
+					// added a token
+				default:
+					// bucket full; drop token
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return bucket, func() { t.Stop(); close(done) }
+}
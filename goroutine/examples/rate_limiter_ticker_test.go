@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"gobyexamples/goroutine/clock"
+	"gobyexamples/goroutine/leakcheck"
+)
+
+func TestTokenBucketPacesRequests(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	bucket, stop := tokenBucket(clk, 50*time.Millisecond, 5)
+	defer stop()
+
+	for i := 1; i <= 12; i++ {
+		select {
+		case <-bucket:
+			t.Fatalf("req %d admitted before its token", i)
+		default:
+		}
+		clk.Advance(50 * time.Millisecond)
+		<-bucket
+		if got := clk.Since(start); got != time.Duration(i)*50*time.Millisecond {
+			t.Fatalf("req %d at %v", i, got)
+		}
+	}
+}
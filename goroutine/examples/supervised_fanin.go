@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gobyexamples/goroutine/supervisor"
+)
+
+// Run with: go run goroutine/examples/supervised_fanin.go
+// fanin_context.go with flaky producers: a panicking producer is restarted
+// by a supervisor instead of silently disappearing from the fan-in.
+func main() {
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	out := make(chan int)
+	sup := supervisor.New("producers", supervisor.Options{
+		MaxRestarts: 5,
+		Within:      time.Second,
+		Backoff:     10 * time.Millisecond,
+	})
+	for i := 0; i < 3; i++ {
+		id := i
+		sup.AddFunc(fmt.Sprintf("producer-%d", id), func(ctx context.Context) error {
+			for n := id * 100; ; n++ {
+				if id == 1 && n%5 == 4 {
+					panic(fmt.Sprintf("producer %d hit a bad record", id))
+				}
+				select {
+				case <-ctx.Done():
+					return nil
+				case out <- n:
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+		})
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- sup.Run(ctx) }()
+	for {
+		select {
+		case v := <-out:
+			fmt.Print(v, " ")
+		case err := <-done:
+			fmt.Println()
+			for _, c := range sup.State().Children {
+				fmt.Printf("%s: %s, %d restart(s)\n", c.Name, c.Status, c.Restarts)
+			}
+			fmt.Println("supervisor exited:", err)
+			return
+		}
+	}
+}
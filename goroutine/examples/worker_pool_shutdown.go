@@ -5,46 +5,72 @@ import (
 	"fmt"
 	"sync"
 	"time"
+
+	"gobyexamples/goroutine/clock"
 )
 
 // Run with: go run goroutine/examples/worker_pool_shutdown.go
-// Worker pool with bounded parallelism and graceful shutdown.
+// Test with: go test goroutine/examples/worker_pool_shutdown.go goroutine/examples/worker_pool_shutdown_test.go
+// Worker pool with bounded parallelism and graceful shutdown. Job time is
+// measured on an injected clock so the test runs on clock.Fake.
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	for r := range runPool(ctx, clock.RealClock{}, 3, 10, 30*time.Millisecond) {
+		fmt.Print(r, " ")
+	}
+	fmt.Println("\ndone")
+}
+
+// runPool processes jobs 0..n-1 on workers goroutines, each job taking
+// cost on clk. The results channel closes once every worker has exited,
+// either because jobs ran out or ctx was cancelled.
+func runPool(ctx context.Context, clk clock.Clock, workers, n int, cost time.Duration) <-chan string {
 	jobs := make(chan int)
 	results := make(chan string)
 
-	const N = 3 // workers
 	var wg sync.WaitGroup
-	for i := 0; i < N; i++ {
+	for i := 0; i < workers; i++ {
 		wg.Add(1)
-		go func(id int){
+		go func(id int) {
 			defer wg.Done()
 			for {
 				select {
 				case <-ctx.Done():
 					return
 				case j, ok := <-jobs:
-					if !ok { return }
-					time.Sleep(30*time.Millisecond)
-					results <- fmt.Sprintf("w%d:%d", id, j)
+					if !ok {
+						return
+					}
+					select {
+					case <-clk.After(cost): // the "work"
+					case <-ctx.Done():
+						return
+					}
+					select {
+					case results <- fmt.Sprintf("w%d:%d", id, j):
+					case <-ctx.Done():
+						return
+					}
 				}
 			}
 		}(i)
 	}
 
 	// results closer
-	go func(){ wg.Wait(); close(results) }()
+	go func() { wg.Wait(); close(results) }()
 
 	// producer
-	go func(){
-		for i := 0; i < 10; i++ { jobs <- i }
-		close(jobs)
+	go func() {
+		defer close(jobs)
+		for i := 0; i < n; i++ {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
 	}()
-
-	for r := range results { fmt.Print(r, " ") }
-	fmt.Println("\ndone")
+	return results
 }
-
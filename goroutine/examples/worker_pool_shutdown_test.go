@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gobyexamples/goroutine/clock"
+	"gobyexamples/goroutine/leakcheck"
+)
+
+func TestPoolRunsInRounds(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	clk := clock.NewFake(time.Time{})
+	results := runPool(context.Background(), clk, 3, 10, 30*time.Millisecond)
+
+	got := 0
+	for round := 1; round <= 4; round++ { // ceil(10/3) rounds of 30ms
+		busy := min(3, 10-got)
+		clk.BlockUntil(busy)
+		clk.Advance(30 * time.Millisecond)
+		for i := 0; i < busy; i++ {
+			<-results
+			got++
+		}
+	}
+	if _, ok := <-results; ok {
+		t.Fatal("results not closed after all jobs")
+	}
+	if el := clk.Since(time.Time{}); el != 120*time.Millisecond {
+		t.Fatalf("took %v of fake time, want 120ms", el)
+	}
+}
+
+func TestPoolShutdownMidJob(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	clk := clock.NewFake(time.Time{})
+	ctx, cancel := context.WithCancel(context.Background())
+	results := runPool(ctx, clk, 3, 10, 30*time.Millisecond)
+
+	clk.BlockUntil(3) // all workers are mid-job
+	cancel()
+	for r := range results {
+		t.Fatalf("result %q delivered after cancel", r)
+	}
+}
@@ -0,0 +1,229 @@
+// Package leakcheck fails tests that leave goroutines behind.
+//
+// Call VerifyNone at the start of a test: it records the goroutines alive
+// then, and at cleanup waits (with backoff, up to a deadline) for every
+// goroutine started since to exit. Goroutines that remain are reported with
+// their stacks, grouped by the place that created them.
+//
+//	func TestWorker(t *testing.T) {
+//		leakcheck.VerifyNone(t)
+//		...
+//	}
+//
+// Goroutines from parallel tests look like leaks, so do not combine it with
+// t.Parallel. For whole packages use VerifyTestMain.
+package leakcheck
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// DefaultTimeout is how long VerifyNone waits for goroutines to exit.
+const DefaultTimeout = 2 * time.Second
+
+// Options tunes the check. The zero value uses DefaultTimeout and the
+// built-in benign list.
+type Options struct {
+	Timeout time.Duration
+	// Ignore lists function names (or prefixes); a goroutine whose stack
+	// contains a matching frame is not reported.
+	Ignore []string
+}
+
+// benign are runtime and testing goroutines that come and go on their own.
+var benign = []string{
+	"testing.(*T).Run",
+	"testing.(*T).Parallel",
+	"testing.runTests",
+	"testing.(*M).",
+	"testing.tRunner.func",
+	"runtime.ensureSigM",
+	"os/signal.signal_recv",
+	"os/signal.loop",
+	"runtime/trace.Start",
+	"runtime.ReadTrace",
+}
+
+// Goroutine is one parsed entry of runtime.Stack(all=true).
+type Goroutine struct {
+	ID        int
+	State     string
+	Top       string // function at the top of the stack
+	CreatedBy string // "pkg.func (file:line)"; empty for main
+	Stack     string // full text as printed by the runtime
+}
+
+// Snapshot returns all live goroutines except the caller's.
+func Snapshot() []Goroutine {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	blocks := strings.Split(strings.TrimSpace(string(buf)), "\n\n")
+	// The first block is always the calling goroutine.
+	out := make([]Goroutine, 0, len(blocks))
+	for _, b := range blocks[1:] {
+		if g, ok := parse(b); ok {
+			out = append(out, g)
+		}
+	}
+	return out
+}
+
+func parse(block string) (Goroutine, bool) {
+	lines := strings.Split(block, "\n")
+	// goroutine 7 [chan receive, 2 minutes]:
+	head := strings.TrimPrefix(lines[0], "goroutine ")
+	idStr, rest, ok := strings.Cut(head, " ")
+	if !ok {
+		return Goroutine{}, false
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return Goroutine{}, false
+	}
+	g := Goroutine{ID: id, Stack: block}
+	g.State = strings.TrimSuffix(strings.TrimPrefix(rest, "["), "]:")
+	if len(lines) > 1 {
+		g.Top = funcName(lines[1])
+	}
+	for i, l := range lines {
+		if fn, ok := strings.CutPrefix(l, "created by "); ok {
+			fn, _, _ = strings.Cut(fn, " in goroutine ")
+			loc := ""
+			if i+1 < len(lines) {
+				loc = strings.TrimSpace(lines[i+1])
+				loc, _, _ = strings.Cut(loc, " +0x")
+			}
+			g.CreatedBy = fmt.Sprintf("%s (%s)", fn, loc)
+		}
+	}
+	return g, true
+}
+
+// funcName turns "pkg.fn(0x1, 0x2)" into "pkg.fn".
+func funcName(frame string) string {
+	if i := strings.LastIndex(frame, "("); i > 0 {
+		return frame[:i]
+	}
+	return frame
+}
+
+func (g Goroutine) matches(names []string) bool {
+	for _, line := range strings.Split(g.Stack, "\n") {
+		for _, n := range names {
+			if strings.HasPrefix(strings.TrimPrefix(line, "created by "), n) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Leaked returns goroutines alive now that were not in before and are not
+// benign or ignored.
+func Leaked(before []Goroutine, ignore []string) []Goroutine {
+	seen := make(map[int]bool, len(before))
+	for _, g := range before {
+		seen[g.ID] = true
+	}
+	var out []Goroutine
+	for _, g := range Snapshot() {
+		if seen[g.ID] || g.matches(benign) || g.matches(ignore) {
+			continue
+		}
+		out = append(out, g)
+	}
+	return out
+}
+
+// VerifyNone records the current goroutines and registers a cleanup that
+// fails t if new ones are still running after DefaultTimeout.
+func VerifyNone(t testing.TB) { Verify(t, Options{}) }
+
+// Verify is VerifyNone with options.
+func Verify(t testing.TB, opts Options) {
+	t.Helper()
+	before := Snapshot()
+	t.Cleanup(func() {
+		if leaked := waitForExit(before, opts); len(leaked) > 0 {
+			t.Error(Report(leaked))
+		}
+	})
+}
+
+// VerifyTestMain runs the package's tests and then fails the binary if any
+// goroutine started during the run is still alive. Use it from TestMain:
+//
+//	func TestMain(m *testing.M) { leakcheck.VerifyTestMain(m, leakcheck.Options{}) }
+func VerifyTestMain(m *testing.M, opts Options) {
+	before := Snapshot()
+	code := m.Run()
+	if code == 0 {
+		if leaked := waitForExit(before, opts); len(leaked) > 0 {
+			fmt.Fprintln(os.Stderr, Report(leaked))
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+// waitForExit polls with exponential backoff until nothing leaks or the
+// timeout passes, returning whatever is still alive.
+func waitForExit(before []Goroutine, opts Options) []Goroutine {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	delay := time.Millisecond
+	for {
+		leaked := Leaked(before, opts.Ignore)
+		if len(leaked) == 0 || time.Now().After(deadline) {
+			return leaked
+		}
+		time.Sleep(delay)
+		if delay < 100*time.Millisecond {
+			delay *= 2
+		}
+	}
+}
+
+// Report formats leaked goroutines grouped by creation site, largest group
+// first, printing one representative stack per group.
+func Report(leaked []Goroutine) string {
+	groups := make(map[string][]Goroutine)
+	for _, g := range leaked {
+		groups[g.CreatedBy] = append(groups[g.CreatedBy], g)
+	}
+	sites := make([]string, 0, len(groups))
+	for s := range groups {
+		sites = append(sites, s)
+	}
+	sort.Slice(sites, func(i, j int) bool {
+		if len(groups[sites[i]]) != len(groups[sites[j]]) {
+			return len(groups[sites[i]]) > len(groups[sites[j]])
+		}
+		return sites[i] < sites[j]
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "leakcheck: %d leaked goroutine(s)\n", len(leaked))
+	for _, s := range sites {
+		gs := groups[s]
+		fmt.Fprintf(&b, "\n%d goroutine(s) created by %s, e.g.:\n%s\n", len(gs), s, gs[0].Stack)
+	}
+	return b.String()
+}
@@ -0,0 +1,83 @@
+package leakcheck
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recorder captures what Verify reports instead of failing the real test.
+type recorder struct {
+	testing.TB
+	errs     []string
+	cleanups []func()
+}
+
+func (r *recorder) Helper()           {}
+func (r *recorder) Cleanup(f func())  { r.cleanups = append(r.cleanups, f) }
+func (r *recorder) Error(args ...any) { r.errs = append(r.errs, fmt.Sprint(args...)) }
+func (r *recorder) runCleanups() {
+	for _, f := range r.cleanups {
+		f()
+	}
+}
+func (r *recorder) failed() (bool, string) { return len(r.errs) > 0, strings.Join(r.errs, "\n") }
+
+//go:noinline
+func leakyWorker(block chan struct{}) { <-block }
+
+func TestDetectsLeakGroupedByCreator(t *testing.T) {
+	r := &recorder{TB: t}
+	Verify(r, Options{Timeout: 50 * time.Millisecond})
+
+	block := make(chan struct{})
+	defer close(block)
+	for i := 0; i < 3; i++ {
+		go leakyWorker(block)
+	}
+	r.runCleanups()
+
+	failed, msg := r.failed()
+	if !failed {
+		t.Fatal("leak not detected")
+	}
+	if !strings.Contains(msg, "3 leaked goroutine(s)") {
+		t.Fatalf("wrong count in report:\n%s", msg)
+	}
+	if !strings.Contains(msg, "3 goroutine(s) created by gobyexamples/goroutine/leakcheck.TestDetectsLeakGroupedByCreator") {
+		t.Fatalf("not grouped by creation site:\n%s", msg)
+	}
+	if !strings.Contains(msg, "leakyWorker") {
+		t.Fatalf("report lacks the leaked stack:\n%s", msg)
+	}
+}
+
+func TestWaitsForSlowExit(t *testing.T) {
+	r := &recorder{TB: t}
+	Verify(r, Options{Timeout: time.Second})
+	go time.Sleep(30 * time.Millisecond) // exits on its own before the deadline
+	r.runCleanups()
+	if failed, msg := r.failed(); failed {
+		t.Fatalf("reported a goroutine that exited in time:\n%s", msg)
+	}
+}
+
+func TestIgnore(t *testing.T) {
+	r := &recorder{TB: t}
+	Verify(r, Options{Timeout: 20 * time.Millisecond, Ignore: []string{"gobyexamples/goroutine/leakcheck.leakyWorker"}})
+	block := make(chan struct{})
+	defer close(block)
+	go leakyWorker(block)
+	r.runCleanups()
+	if failed, msg := r.failed(); failed {
+		t.Fatalf("ignored goroutine reported:\n%s", msg)
+	}
+}
+
+func TestCleanTestPasses(t *testing.T) {
+	VerifyNone(t)
+	done := make(chan struct{})
+	go func() { close(done) }()
+	<-done
+}
@@ -0,0 +1,119 @@
+// Package pipeline builds typed channel pipelines out of reusable stages,
+// replacing the hand-wired gen/square stages of
+// goroutine/examples/cancel_pipeline.go and fanin_context.go.
+//
+// Every stage runs its goroutines under one Pipeline. The first stage error
+// cancels the shared context (like errgroup), every goroutine selects on that
+// context for each send and receive, and Wait returns only after all of them
+// have exited, so cancelling never leaks goroutines. Stages stopped by
+// cancellation return ctx.Err(); Wait reports the first real error, or the
+// parent's cause if the parent was cancelled, so truncated output is never
+// mistaken for complete output.
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Pipeline owns the goroutines of all stages attached to it.
+type Pipeline struct {
+	parent context.Context
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	once   sync.Once
+	err    error
+
+	mu        sync.Mutex
+	running   int  // stage goroutines not yet returned
+	parentCut bool // the parent was done when the last of them returned
+}
+
+// New returns a Pipeline whose stages stop when ctx is cancelled or any stage
+// fails.
+func New(ctx context.Context) *Pipeline {
+	child, cancel := context.WithCancel(ctx)
+	return &Pipeline{parent: ctx, ctx: child, cancel: cancel}
+}
+
+// Context is cancelled when the parent is, when a stage fails, or after Wait.
+func (p *Pipeline) Context() context.Context { return p.ctx }
+
+// Cancel stops all stages, e.g. when the consumer has seen enough. It is not
+// an error: Wait still returns nil if no stage failed.
+func (p *Pipeline) Cancel() { p.cancel() }
+
+// Go runs fn as part of the pipeline; use it to write custom stages. A
+// non-nil error is recorded (first one wins) and cancels the pipeline. fn
+// should return ctx.Err() when it stops because ctx is done; that is not
+// recorded, as it only echoes whatever cancelled the pipeline.
+func (p *Pipeline) Go(fn func(ctx context.Context) error) {
+	p.wg.Add(1)
+	p.mu.Lock()
+	p.running++
+	p.mu.Unlock()
+	go func() {
+		defer p.wg.Done()
+		defer p.finish()
+		if err := fn(p.ctx); err != nil && !p.cancelled(err) {
+			p.once.Do(func() {
+				p.err = err
+				p.cancel()
+			})
+		}
+	}()
+}
+
+// finish records, as the last running stage returns, whether the parent
+// was cancelled before the pipeline completed.
+func (p *Pipeline) finish() {
+	p.mu.Lock()
+	p.running--
+	if p.running == 0 {
+		p.parentCut = p.parent.Err() != nil
+	}
+	p.mu.Unlock()
+}
+
+// cancelled reports whether err is the pipeline's context error.
+func (p *Pipeline) cancelled(err error) bool {
+	return p.ctx.Err() != nil &&
+		(errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded))
+}
+
+// Wait blocks until every stage goroutine has returned and reports the first
+// stage error or, failing that, context.Cause of the parent if it was
+// cancelled before the stages finished. A parent cancelled after that did
+// not cut anything short and is not reported. The final stage's output must
+// be drained (or the pipeline cancelled) for Wait to return.
+func (p *Pipeline) Wait() error {
+	p.wg.Wait()
+	p.cancel()
+	if p.err == nil && p.parentCut {
+		return context.Cause(p.parent)
+	}
+	return p.err
+}
+
+// send delivers v unless ctx is done first.
+func send[T any](ctx context.Context, out chan<- T, v T) bool {
+	select {
+	case out <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// recv returns the next value from in; ok is false when in is closed or ctx
+// is done.
+func recv[T any](ctx context.Context, in <-chan T) (v T, ok bool) {
+	select {
+	case v, ok = <-in:
+		return v, ok
+	case <-ctx.Done():
+		return v, false
+	}
+}
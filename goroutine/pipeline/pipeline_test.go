@@ -0,0 +1,239 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"runtime"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+)
+
+// checkNoLeak fails if the goroutine count does not settle back to the
+// value observed at the start of the test.
+func checkNoLeak(t *testing.T) {
+	t.Helper()
+	before := runtime.NumGoroutine()
+	t.Cleanup(func() {
+		deadline := time.Now().Add(2 * time.Second)
+		for runtime.NumGoroutine() > before {
+			if time.Now().After(deadline) {
+				t.Errorf("goroutines: before=%d after=%d", before, runtime.NumGoroutine())
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+}
+
+func ints(n int) []int {
+	s := make([]int, n)
+	for i := range s {
+		s[i] = i
+	}
+	return s
+}
+
+func collect[T any](in <-chan T) []T {
+	var out []T
+	for v := range in {
+		out = append(out, v)
+	}
+	return out
+}
+
+func square(_ context.Context, v int) (int, error) { return v * v, nil }
+
+func TestSquarePipeline(t *testing.T) {
+	checkNoLeak(t)
+	p := New(context.Background())
+	src := FromSlice(p, ints(10))
+	even := Filter(p, src, func(v int) bool { return v%2 == 0 })
+	got := collect(Map(p, even, square, MapOptions{}))
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{0, 4, 16, 36, 64}; !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestMapOrderedParallel(t *testing.T) {
+	checkNoLeak(t)
+	p := New(context.Background())
+	jittery := func(_ context.Context, v int) (int, error) {
+		time.Sleep(time.Duration(rand.Intn(300)) * time.Microsecond)
+		return v * 2, nil
+	}
+	got := collect(Map(p, FromSlice(p, ints(200)), jittery, MapOptions{Workers: 8, Ordered: true}))
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range got {
+		if v != i*2 {
+			t.Fatalf("out of order at %d: %v", i, got[:i+1])
+		}
+	}
+	if len(got) != 200 {
+		t.Fatalf("len = %d", len(got))
+	}
+}
+
+func TestMapUnorderedParallel(t *testing.T) {
+	checkNoLeak(t)
+	p := New(context.Background())
+	got := collect(Map(p, FromSlice(p, ints(100)), square, MapOptions{Workers: 4}))
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Ints(got)
+	for i, v := range got {
+		if v != i*i {
+			t.Fatalf("missing %d", i*i)
+		}
+	}
+}
+
+func TestFirstErrorCancelsEverything(t *testing.T) {
+	checkNoLeak(t)
+	boom := errors.New("boom")
+	p := New(context.Background())
+	endless := Source(p, func(_ context.Context, emit func(int) bool) error {
+		for i := 0; emit(i); i++ {
+		}
+		return nil
+	})
+	failing := Map(p, endless, func(_ context.Context, v int) (int, error) {
+		if v == 50 {
+			return 0, boom
+		}
+		return v, nil
+	}, MapOptions{Workers: 4, Ordered: true})
+	Sink(p, failing, func(context.Context, int) error { return nil })
+	if err := p.Wait(); !errors.Is(err, boom) {
+		t.Fatalf("Wait = %v, want boom", err)
+	}
+}
+
+// Mirrors cancel_pipeline.go: the consumer stops early and cancels.
+func TestEarlyCancelNoLeak(t *testing.T) {
+	checkNoLeak(t)
+	p := New(context.Background())
+	endless := Source(p, func(_ context.Context, emit func(int) bool) error {
+		for i := 0; emit(i); i++ {
+		}
+		return nil
+	})
+	sq := Map(p, endless, square, MapOptions{Workers: 3, Ordered: true})
+	branches := Tee(p, sq, 2)
+	merged := Merge(p, FanOut(p, branches[0], 3)...)
+	batches := Batch(p, merged, 4, time.Millisecond)
+	go func() {
+		for range branches[1] {
+		}
+	}()
+	for b := range batches {
+		if len(b) > 0 && b[0] > 100 {
+			p.Cancel()
+			break
+		}
+	}
+	if err := p.Wait(); err != nil {
+		t.Fatalf("Wait = %v", err)
+	}
+}
+
+func TestBatchBySizeAndTime(t *testing.T) {
+	checkNoLeak(t)
+	p := New(context.Background())
+	in := make(chan int)
+	batches := Batch(p, in, 3, 20*time.Millisecond)
+	go func() {
+		for i := 0; i < 4; i++ {
+			in <- i
+		}
+		// the 4th value waits alone until maxWait flushes it
+		time.Sleep(60 * time.Millisecond)
+		in <- 4
+		close(in)
+	}()
+	got := collect(batches)
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]int{{0, 1, 2}, {3}, {4}}
+	if len(got) != len(want) {
+		t.Fatalf("batches = %v, want %v", got, want)
+	}
+	for i := range want {
+		if !slices.Equal(got[i], want[i]) {
+			t.Fatalf("batches = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestTeeAndFanOutMerge(t *testing.T) {
+	checkNoLeak(t)
+	p := New(context.Background())
+	outs := Tee(p, FromSlice(p, ints(20)), 2)
+	merged := Merge(p, FanOut(p, outs[0], 4)...)
+	done := make(chan []int)
+	go func() { done <- collect(outs[1]) }()
+	fanned := collect(merged)
+	copyB := <-done
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Ints(fanned)
+	if !slices.Equal(fanned, ints(20)) || !slices.Equal(copyB, ints(20)) {
+		t.Fatalf("fanned=%v tee=%v", fanned, copyB)
+	}
+}
+
+func TestParentContextCancel(t *testing.T) {
+	checkNoLeak(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	p := New(ctx)
+	endless := Source(p, func(_ context.Context, emit func(int) bool) error {
+		for i := 0; emit(i); i++ {
+		}
+		return nil
+	})
+	Sink(p, Map(p, endless, square, MapOptions{Workers: 2}), func(context.Context, int) error { return nil })
+	time.Sleep(5 * time.Millisecond)
+	cancel()
+	if err := p.Wait(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Wait = %v, want context.Canceled", err)
+	}
+
+	// The parent's cause is reported as is.
+	errStop := errors.New("stop")
+	ctx, cancelCause := context.WithCancelCause(context.Background())
+	p = New(ctx)
+	Sink(p, FromSlice(p, []int{1, 2, 3}), func(context.Context, int) error {
+		cancelCause(errStop)
+		return nil
+	})
+	if err := p.Wait(); !errors.Is(err, errStop) {
+		t.Fatalf("Wait = %v, want %v", err, errStop)
+	}
+
+	// Cancelling the parent after every stage finished is not an error.
+	ctx, cancel = context.WithCancel(context.Background())
+	p = New(ctx)
+	done := make(chan struct{})
+	Sink(p, FromSlice(p, []int{1, 2, 3}), func(_ context.Context, v int) error {
+		if v == 3 {
+			close(done)
+		}
+		return nil
+	})
+	<-done
+	time.Sleep(5 * time.Millisecond) // let the stage goroutines return
+	cancel()
+	if err := p.Wait(); err != nil {
+		t.Fatalf("Wait after completion = %v, want nil", err)
+	}
+}
@@ -0,0 +1,277 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Source starts a stage that produces values by calling emit. emit returns
+// false once the pipeline is cancelled; gen should then return ctx.Err()
+// promptly.
+func Source[T any](p *Pipeline, gen func(ctx context.Context, emit func(T) bool) error) <-chan T {
+	out := make(chan T)
+	p.Go(func(ctx context.Context) error {
+		defer close(out)
+		return gen(ctx, func(v T) bool { return send(ctx, out, v) })
+	})
+	return out
+}
+
+// FromSlice emits each item of items in order.
+func FromSlice[T any](p *Pipeline, items []T) <-chan T {
+	return Source(p, func(ctx context.Context, emit func(T) bool) error {
+		for _, v := range items {
+			if !emit(v) {
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+}
+
+// MapOptions tunes Map. The zero value runs one worker.
+type MapOptions struct {
+	// Workers is the number of goroutines calling fn concurrently.
+	Workers int
+	// Ordered keeps output in input order. At most Workers results are held
+	// back while waiting for a slow item.
+	Ordered bool
+}
+
+// Map applies fn to each value. An error from fn fails the pipeline.
+func Map[T, U any](p *Pipeline, in <-chan T, fn func(context.Context, T) (U, error), opts MapOptions) <-chan U {
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	if opts.Ordered && workers > 1 {
+		return mapOrdered(p, in, fn, workers)
+	}
+	out := make(chan U)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		p.Go(func(ctx context.Context) error {
+			defer wg.Done()
+			for {
+				v, ok := recv(ctx, in)
+				if !ok {
+					return ctx.Err()
+				}
+				u, err := fn(ctx, v)
+				if err != nil {
+					return err
+				}
+				if !send(ctx, out, u) {
+					return ctx.Err()
+				}
+			}
+		})
+	}
+	p.Go(func(context.Context) error { wg.Wait(); close(out); return nil })
+	return out
+}
+
+// mapOrdered gives every item its own one-slot result channel and queues
+// those channels in input order; the collector reads them in that order.
+func mapOrdered[T, U any](p *Pipeline, in <-chan T, fn func(context.Context, T) (U, error), workers int) <-chan U {
+	type job struct {
+		v   T
+		res chan U
+	}
+	jobs := make(chan job)
+	order := make(chan chan U, workers)
+	out := make(chan U)
+
+	p.Go(func(ctx context.Context) error { // dispatcher
+		defer close(jobs)
+		defer close(order)
+		for {
+			v, ok := recv(ctx, in)
+			if !ok {
+				return ctx.Err()
+			}
+			res := make(chan U, 1)
+			if !send(ctx, order, res) || !send(ctx, jobs, job{v: v, res: res}) {
+				return ctx.Err()
+			}
+		}
+	})
+	for w := 0; w < workers; w++ {
+		p.Go(func(ctx context.Context) error {
+			for j := range jobs {
+				u, err := fn(ctx, j.v)
+				if err != nil {
+					return err
+				}
+				j.res <- u // buffered; never blocks
+			}
+			return nil
+		})
+	}
+	p.Go(func(ctx context.Context) error { // collector
+		defer close(out)
+		for {
+			res, ok := recv(ctx, order)
+			if !ok {
+				return ctx.Err()
+			}
+			u, ok := recv(ctx, res)
+			if !ok || !send(ctx, out, u) {
+				return ctx.Err()
+			}
+		}
+	})
+	return out
+}
+
+// Filter passes through values for which keep returns true.
+func Filter[T any](p *Pipeline, in <-chan T, keep func(T) bool) <-chan T {
+	out := make(chan T)
+	p.Go(func(ctx context.Context) error {
+		defer close(out)
+		for {
+			v, ok := recv(ctx, in)
+			if !ok {
+				return ctx.Err()
+			}
+			if keep(v) && !send(ctx, out, v) {
+				return ctx.Err()
+			}
+		}
+	})
+	return out
+}
+
+// Batch groups values into slices of up to n, flushing a partial batch when
+// maxWait has passed since its first value arrived or when in closes.
+func Batch[T any](p *Pipeline, in <-chan T, n int, maxWait time.Duration) <-chan []T {
+	out := make(chan []T)
+	p.Go(func(ctx context.Context) error {
+		defer close(out)
+		timer := time.NewTimer(maxWait)
+		timer.Stop()
+		defer timer.Stop()
+		var buf []T
+		flush := func() bool {
+			timer.Stop()
+			if len(buf) == 0 {
+				return true
+			}
+			b := buf
+			buf = nil
+			return send(ctx, out, b)
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case v, ok := <-in:
+				if !ok {
+					flush()
+					return ctx.Err()
+				}
+				if len(buf) == 0 {
+					timer.Reset(maxWait)
+				}
+				buf = append(buf, v)
+				if len(buf) >= n && !flush() {
+					return ctx.Err()
+				}
+			case <-timer.C:
+				if !flush() {
+					return ctx.Err()
+				}
+			}
+		}
+	})
+	return out
+}
+
+// FanOut starts n competing consumers of in: each value goes to exactly one
+// of the returned channels, whichever is ready first.
+func FanOut[T any](p *Pipeline, in <-chan T, n int) []<-chan T {
+	outs := make([]<-chan T, n)
+	for i := range outs {
+		out := make(chan T)
+		outs[i] = out
+		p.Go(func(ctx context.Context) error {
+			defer close(out)
+			for {
+				v, ok := recv(ctx, in)
+				if !ok || !send(ctx, out, v) {
+					return ctx.Err()
+				}
+			}
+		})
+	}
+	return outs
+}
+
+// Merge (fan-in) forwards values from all ins to one channel, closing it
+// after every input has closed.
+func Merge[T any](p *Pipeline, ins ...<-chan T) <-chan T {
+	out := make(chan T)
+	var wg sync.WaitGroup
+	wg.Add(len(ins))
+	for _, in := range ins {
+		p.Go(func(ctx context.Context) error {
+			defer wg.Done()
+			for {
+				v, ok := recv(ctx, in)
+				if !ok || !send(ctx, out, v) {
+					return ctx.Err()
+				}
+			}
+		})
+	}
+	p.Go(func(context.Context) error { wg.Wait(); close(out); return nil })
+	return out
+}
+
+// Tee copies every value to each of n outputs. The slowest consumer sets the
+// pace for all of them.
+func Tee[T any](p *Pipeline, in <-chan T, n int) []<-chan T {
+	chans := make([]chan T, n)
+	outs := make([]<-chan T, n)
+	for i := range chans {
+		chans[i] = make(chan T)
+		outs[i] = chans[i]
+	}
+	p.Go(func(ctx context.Context) error {
+		defer func() {
+			for _, c := range chans {
+				close(c)
+			}
+		}()
+		for {
+			v, ok := recv(ctx, in)
+			if !ok {
+				return ctx.Err()
+			}
+			for _, c := range chans {
+				if !send(ctx, c, v) {
+					return ctx.Err()
+				}
+			}
+		}
+	})
+	return outs
+}
+
+// Sink consumes in, calling fn for each value. An error from fn fails the
+// pipeline.
+func Sink[T any](p *Pipeline, in <-chan T, fn func(context.Context, T) error) {
+	p.Go(func(ctx context.Context) error {
+		for {
+			v, ok := recv(ctx, in)
+			if !ok {
+				return ctx.Err()
+			}
+			if err := fn(ctx, v); err != nil {
+				return err
+			}
+		}
+	})
+}
@@ -0,0 +1,186 @@
+package ratelimit
+
+import (
+	"slices"
+	"sort"
+	"time"
+)
+
+// NewTokenBucket returns a token bucket holding up to burst tokens that
+// refills at r. Refill is computed lazily from the time since the last call,
+// so no goroutine or ticker is needed. A nil clk uses RealClock.
+func NewTokenBucket(r Rate, burst int, clk Clock) *Limiter {
+	b := &tokenBucket{burst: burst, interval: r.interval(), tokens: float64(burst)}
+	l := newLimiter(b, clk)
+	b.last = l.clock.Now()
+	return l
+}
+
+type tokenBucket struct {
+	burst    int
+	interval time.Duration
+	tokens   float64 // may go negative: tokens owed to reservations
+	last     time.Time
+}
+
+func (b *tokenBucket) advance(now time.Time) {
+	if b.interval > 0 && now.After(b.last) {
+		b.tokens += float64(now.Sub(b.last)) / float64(b.interval)
+		if b.tokens > float64(b.burst) {
+			b.tokens = float64(b.burst)
+		}
+	}
+	if now.After(b.last) {
+		b.last = now
+	}
+}
+
+func (b *tokenBucket) reserve(now time.Time, n int, maxWait time.Duration) (time.Duration, bool) {
+	b.advance(now)
+	left := b.tokens - float64(n)
+	var delay time.Duration
+	if left < 0 {
+		if b.interval <= 0 {
+			return 0, false // rate 0: only the initial burst is ever available
+		}
+		delay = time.Duration(-left * float64(b.interval))
+	}
+	if delay > maxWait {
+		return 0, false
+	}
+	b.tokens = left
+	return delay, true
+}
+
+func (b *tokenBucket) unreserve(now time.Time, n int, at time.Time) {
+	if at.Before(now) {
+		return // already in use
+	}
+	b.advance(now)
+	b.tokens += float64(n)
+	if b.tokens > float64(b.burst) {
+		b.tokens = float64(b.burst)
+	}
+}
+
+func (b *tokenBucket) setRate(now time.Time, r Rate) {
+	b.advance(now)
+	b.interval = r.interval()
+}
+
+func (b *tokenBucket) capacity() int { return b.burst }
+
+// NewSlidingWindow returns a sliding-window log limiter: at most r.Count
+// events in any window of length r.Per. It keeps one timestamp per event, so
+// memory grows with Count; in exchange it has no boundary bursts.
+func NewSlidingWindow(r Rate, clk Clock) *Limiter {
+	return newLimiter(&slidingLog{limit: r.Count, window: r.Per}, clk)
+}
+
+type slidingLog struct {
+	limit  int
+	window time.Duration
+	log    []time.Time // sorted; may contain future times booked by Reserve
+}
+
+func (s *slidingLog) evict(now time.Time) {
+	cut := now.Add(-s.window)
+	i := 0
+	for i < len(s.log) && !s.log[i].After(cut) {
+		i++
+	}
+	s.log = s.log[i:]
+}
+
+func (s *slidingLog) reserve(now time.Time, n int, maxWait time.Duration) (time.Duration, bool) {
+	s.evict(now)
+	at := now
+	if over := len(s.log) + n - s.limit; over > 0 {
+		// The over-th oldest entry must leave the window first.
+		at = s.log[over-1].Add(s.window)
+		if at.Before(now) {
+			at = now
+		}
+	}
+	delay := at.Sub(now)
+	if delay > maxWait {
+		return 0, false
+	}
+	idx := sort.Search(len(s.log), func(i int) bool { return s.log[i].After(at) })
+	s.log = slices.Insert(s.log, idx, slices.Repeat([]time.Time{at}, n)...)
+	return delay, true
+}
+
+func (s *slidingLog) unreserve(now time.Time, n int, at time.Time) {
+	if at.Before(now) {
+		return // already happened; it counts against the window
+	}
+	for ; n > 0; n-- {
+		idx, found := slices.BinarySearchFunc(s.log, at, time.Time.Compare)
+		if !found {
+			return
+		}
+		s.log = slices.Delete(s.log, idx, idx+1)
+	}
+}
+
+func (s *slidingLog) setRate(now time.Time, r Rate) {
+	s.limit, s.window = r.Count, r.Per
+	s.evict(now)
+}
+
+func (s *slidingLog) capacity() int { return s.limit }
+
+// NewGCRA returns a Generic Cell Rate Algorithm limiter: it stores a single
+// timestamp (the theoretical arrival time of the next event) and allows
+// bursts of up to burst events. Memory is O(1) regardless of rate.
+func NewGCRA(r Rate, burst int, clk Clock) *Limiter {
+	return newLimiter(&gcra{interval: r.interval(), burst: burst}, clk)
+}
+
+type gcra struct {
+	interval time.Duration
+	burst    int
+	tat      time.Time // theoretical arrival time
+}
+
+func (g *gcra) reserve(now time.Time, n int, maxWait time.Duration) (time.Duration, bool) {
+	if g.interval <= 0 {
+		return 0, false
+	}
+	tat := g.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	newTat := tat.Add(time.Duration(n) * g.interval)
+	// Allowed once newTat is within burst intervals of now.
+	allowAt := newTat.Add(-time.Duration(g.burst) * g.interval)
+	delay := allowAt.Sub(now)
+	if delay < 0 {
+		delay = 0
+	}
+	if delay > maxWait {
+		return 0, false
+	}
+	g.tat = newTat
+	return delay, true
+}
+
+func (g *gcra) unreserve(now time.Time, n int, at time.Time) {
+	if at.Before(now) {
+		return
+	}
+	g.tat = g.tat.Add(-time.Duration(n) * g.interval)
+}
+
+func (g *gcra) setRate(now time.Time, r Rate) {
+	old := g.interval
+	g.interval = r.interval()
+	// Rescale the debt that is still outstanding to the new interval.
+	if old > 0 && g.tat.After(now) {
+		owed := float64(g.tat.Sub(now)) / float64(old)
+		g.tat = now.Add(time.Duration(owed * float64(g.interval)))
+	}
+}
+
+func (g *gcra) capacity() int { return g.burst }
@@ -0,0 +1,20 @@
+package ratelimit
+
+import (
+	"time"
+
+	"gobyexamples/goroutine/clock"
+)
+
+// Clock is the part of clock.Clock that limiters use. Tests pass a
+// *clock.Fake and use clock.WithTimeout for deadlines on the same clock.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is clock.Timer.
+type Timer = clock.Timer
+
+// RealClock uses the time package.
+type RealClock = clock.RealClock
@@ -0,0 +1,207 @@
+// Package httplimit is net/http admission control: per-client rate limiting
+// built on goroutine/ratelimit and a cap on concurrent in-flight requests with
+// a bounded, time-limited queue. Rejected requests get 429 Too Many Requests
+// with a Retry-After header.
+package httplimit
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gobyexamples/goroutine/ratelimit"
+)
+
+// KeyFunc extracts the client key a request is limited by.
+type KeyFunc func(*http.Request) (string, error)
+
+// ByIP keys by the client IP. trustedProxies is the number of reverse
+// proxies you control in front of the server, each appending the address it
+// received the request from to X-Forwarded-For. With 0 the key is the remote
+// address. Otherwise it is the entry the outermost trusted proxy appended,
+// counted from the right: entries further left came from the client and can
+// be anything, so they are never used. A request with fewer entries than
+// trustedProxies is keyed by its remote address.
+func ByIP(trustedProxies int) KeyFunc {
+	return func(r *http.Request) (string, error) {
+		if trustedProxies > 0 {
+			var hops []string
+			for _, v := range r.Header.Values("X-Forwarded-For") {
+				for _, h := range strings.Split(v, ",") {
+					hops = append(hops, strings.TrimSpace(h))
+				}
+			}
+			if len(hops) >= trustedProxies {
+				return hops[len(hops)-trustedProxies], nil
+			}
+		}
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return r.RemoteAddr, nil
+		}
+		return host, nil
+	}
+}
+
+// ByHeader keys by the value of header name (e.g. an API key). Requests
+// without the header are rejected with 400.
+func ByHeader(name string) KeyFunc {
+	return func(r *http.Request) (string, error) {
+		v := r.Header.Get(name)
+		if v == "" {
+			return "", errors.New("missing " + name + " header")
+		}
+		return v, nil
+	}
+}
+
+// Metrics counts admission decisions. It can be published with
+// expvar.Publish("httplimit", m) since it implements expvar.Var.
+type Metrics struct {
+	RateAllowed   atomic.Int64 // passed RateLimit (ConcurrencyLimit may still reject)
+	RateLimited   atomic.Int64 // rejected by RateLimit
+	QueueFull     atomic.Int64 // rejected by ConcurrencyLimit: queue full
+	QueueTimeouts atomic.Int64 // rejected by ConcurrencyLimit: waited too long
+	InFlight      atomic.Int64 // currently executing (gauge)
+	Queued        atomic.Int64 // currently waiting for a slot (gauge)
+}
+
+// Snapshot returns the current values by name.
+func (m *Metrics) Snapshot() map[string]int64 {
+	return map[string]int64{
+		"rate_allowed":   m.RateAllowed.Load(),
+		"rate_limited":   m.RateLimited.Load(),
+		"queue_full":     m.QueueFull.Load(),
+		"queue_timeouts": m.QueueTimeouts.Load(),
+		"in_flight":      m.InFlight.Load(),
+		"queued":         m.Queued.Load(),
+	}
+}
+
+// String renders Snapshot as JSON (expvar.Var).
+func (m *Metrics) String() string {
+	b, _ := json.Marshal(m.Snapshot())
+	return string(b)
+}
+
+// RateLimit rejects requests whose key has no capacity left in limiters.
+// The Retry-After value comes from a reservation, so it says exactly when
+// the client's next request would be admitted. m may be nil.
+func RateLimit(limiters *ratelimit.Keyed[string], key KeyFunc, m *Metrics) func(http.Handler) http.Handler {
+	if m == nil {
+		m = new(Metrics)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k, err := key(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			res := limiters.Reserve(k)
+			if !res.OK() || res.Delay() > 0 {
+				wait := res.Delay()
+				res.Cancel()
+				m.RateLimited.Add(1)
+				tooMany(w, wait)
+				return
+			}
+			m.RateAllowed.Add(1)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ConcurrencyOptions configures ConcurrencyLimit.
+type ConcurrencyOptions struct {
+	// MaxInFlight is the number of requests served at once. It must be
+	// positive.
+	MaxInFlight int
+	// MaxQueue bounds how many requests may wait for a slot; 0 rejects as
+	// soon as all slots are busy.
+	MaxQueue int
+	// QueueTimeout is the longest a request waits for a slot; 0 waits
+	// until a slot frees up or the client goes away.
+	QueueTimeout time.Duration
+	// RetryAfter is advertised on rejection. Defaults to one second.
+	RetryAfter time.Duration
+}
+
+// ConcurrencyLimit caps in-flight requests. Excess requests queue for up to
+// QueueTimeout (or until the client goes away) and are then rejected with
+// 429. m may be nil.
+func ConcurrencyLimit(opts ConcurrencyOptions, m *Metrics) func(http.Handler) http.Handler {
+	if opts.MaxInFlight <= 0 {
+		panic("httplimit: ConcurrencyOptions.MaxInFlight must be positive")
+	}
+	if m == nil {
+		m = new(Metrics)
+	}
+	if opts.RetryAfter <= 0 {
+		opts.RetryAfter = time.Second
+	}
+	slots := make(chan struct{}, opts.MaxInFlight)
+	var waiting atomic.Int64
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case slots <- struct{}{}:
+			default:
+				if waiting.Add(1) > int64(opts.MaxQueue) {
+					waiting.Add(-1)
+					m.QueueFull.Add(1)
+					tooMany(w, opts.RetryAfter)
+					return
+				}
+				m.Queued.Add(1)
+				ok := acquire(r, slots, opts.QueueTimeout)
+				m.Queued.Add(-1)
+				waiting.Add(-1)
+				if !ok {
+					m.QueueTimeouts.Add(1)
+					tooMany(w, opts.RetryAfter)
+					return
+				}
+			}
+			m.InFlight.Add(1)
+			defer func() {
+				m.InFlight.Add(-1)
+				<-slots
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func acquire(r *http.Request, slots chan struct{}, timeout time.Duration) bool {
+	var expired <-chan time.Time // nil: never
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		expired = t.C
+	}
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-expired:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+func tooMany(w http.ResponseWriter, retryAfter time.Duration) {
+	secs := int(math.Ceil(retryAfter.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+}
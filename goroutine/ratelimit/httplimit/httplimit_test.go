@@ -0,0 +1,204 @@
+package httplimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gobyexamples/goroutine/clock"
+	"gobyexamples/goroutine/ratelimit"
+)
+
+var ok = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+
+func get(h http.Handler, mod func(*http.Request)) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if mod != nil {
+		mod(req)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func withKey(k string) func(*http.Request) {
+	return func(r *http.Request) { r.Header.Set("X-API-Key", k) }
+}
+
+func TestRateLimitPerKey(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	limiters := ratelimit.NewKeyed(func(string) *ratelimit.Limiter {
+		return ratelimit.NewTokenBucket(ratelimit.Rate{Count: 1, Per: 2 * time.Second}, 2, clk)
+	}, time.Minute, clk)
+	var m Metrics
+	h := RateLimit(limiters, ByHeader("X-API-Key"), &m)(ok)
+
+	for i := 0; i < 2; i++ {
+		if rec := get(h, withKey("alice")); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: %d", i, rec.Code)
+		}
+	}
+	rec := get(h, withKey("alice"))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("3rd request: %d, want 429", rec.Code)
+	}
+	if ra := rec.Header().Get("Retry-After"); ra != "2" {
+		t.Fatalf("Retry-After = %q, want 2", ra)
+	}
+	if rec := get(h, withKey("bob")); rec.Code != http.StatusOK {
+		t.Fatalf("bob limited by alice's usage: %d", rec.Code)
+	}
+	if rec := get(h, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("missing key: %d, want 400", rec.Code)
+	}
+
+	clk.Advance(2 * time.Second)
+	if rec := get(h, withKey("alice")); rec.Code != http.StatusOK {
+		t.Fatalf("after refill: %d", rec.Code)
+	}
+	if m.RateAllowed.Load() != 4 || m.RateLimited.Load() != 1 {
+		t.Fatalf("metrics = %s", m.String())
+	}
+}
+
+func TestByIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:5555"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.2")
+	if k, _ := ByIP(0)(req); k != "10.0.0.1" {
+		t.Fatalf("ByIP(0) = %q", k)
+	}
+	if k, _ := ByIP(1)(req); k != "10.0.0.2" {
+		t.Fatalf("ByIP(1) = %q", k)
+	}
+	if k, _ := ByIP(2)(req); k != "203.0.113.7" {
+		t.Fatalf("ByIP(2) = %q", k)
+	}
+	if k, _ := ByIP(3)(req); k != "10.0.0.1" {
+		t.Fatalf("ByIP(3) with two entries = %q", k)
+	}
+
+	// A client-supplied leading entry does not change the key.
+	req.Header.Set("X-Forwarded-For", "198.51.100.99, 203.0.113.7, 10.0.0.2")
+	if k, _ := ByIP(2)(req); k != "203.0.113.7" {
+		t.Fatalf("ByIP(2) with spoofed entry = %q", k)
+	}
+	req.Header.Del("X-Forwarded-For")
+	req.Header.Add("X-Forwarded-For", "198.51.100.99")
+	req.Header.Add("X-Forwarded-For", "203.0.113.7")
+	if k, _ := ByIP(1)(req); k != "203.0.113.7" {
+		t.Fatalf("ByIP(1) over repeated headers = %q", k)
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	release := make(chan struct{})
+	entered := make(chan struct{}, 4)
+	slow := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		entered <- struct{}{}
+		<-release
+	})
+	var m Metrics
+	h := ConcurrencyLimit(ConcurrencyOptions{
+		MaxInFlight:  1,
+		MaxQueue:     1,
+		QueueTimeout: time.Second,
+		RetryAfter:   3 * time.Second,
+	}, &m)(slow)
+
+	results := make(chan int, 2)
+	go func() { results <- get(h, nil).Code }() // takes the slot
+	<-entered
+	go func() { results <- get(h, nil).Code }() // queues
+	for m.Queued.Load() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	rec := get(h, nil) // queue full
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "3" {
+		t.Fatalf("overflow: %d Retry-After=%q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if m.InFlight.Load() != 1 {
+		t.Fatalf("in flight = %d", m.InFlight.Load())
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		if code := <-results; code != http.StatusOK {
+			t.Fatalf("admitted request got %d", code)
+		}
+	}
+	if m.QueueFull.Load() != 1 || m.InFlight.Load() != 0 {
+		t.Fatalf("metrics = %s", m.String())
+	}
+}
+
+func TestConcurrencyQueueTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	entered := make(chan struct{}, 1)
+	slow := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		entered <- struct{}{}
+		<-release
+	})
+	var m Metrics
+	h := ConcurrencyLimit(ConcurrencyOptions{MaxInFlight: 1, MaxQueue: 5, QueueTimeout: 20 * time.Millisecond}, &m)(slow)
+	go get(h, nil)
+	<-entered
+	rec := get(h, nil)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Fatalf("queued request: %d Retry-After=%q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if m.QueueTimeouts.Load() != 1 || m.Queued.Load() != 0 {
+		t.Fatalf("metrics = %s", m.String())
+	}
+}
+
+func TestConcurrencyNoQueueTimeout(t *testing.T) {
+	release := make(chan struct{})
+	entered := make(chan struct{}, 2)
+	slow := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		entered <- struct{}{}
+		<-release
+	})
+	var m Metrics
+	h := ConcurrencyLimit(ConcurrencyOptions{MaxInFlight: 1, MaxQueue: 2}, &m)(slow)
+	first := make(chan int)
+	go func() { first <- get(h, nil).Code }()
+	<-entered
+
+	// With no QueueTimeout a queued request waits for its client...
+	ctx, cancel := context.WithCancel(context.Background())
+	gone := make(chan int)
+	go func() { gone <- get(h, func(r *http.Request) { *r = *r.WithContext(ctx) }).Code }()
+	// ...or for a slot.
+	second := make(chan int)
+	go func() { second <- get(h, nil).Code }()
+	for m.Queued.Load() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if m.QueueTimeouts.Load() != 0 {
+		t.Fatal("queued request timed out with QueueTimeout 0")
+	}
+	cancel()
+	if code := <-gone; code != http.StatusTooManyRequests {
+		t.Fatalf("abandoned request got %d", code)
+	}
+	close(release)
+	for _, c := range []chan int{first, second} {
+		if code := <-c; code != http.StatusOK {
+			t.Fatalf("admitted request got %d", code)
+		}
+	}
+}
+
+func TestConcurrencyLimitNeedsSlots(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("MaxInFlight 0 did not panic")
+		}
+	}()
+	ConcurrencyLimit(ConcurrencyOptions{}, nil)
+}
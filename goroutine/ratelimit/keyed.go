@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Keyed holds one Limiter per key (client IP, API token, ...). Limiters not
+// used for idleTTL are dropped during lazy sweeps on later calls, so the map
+// does not grow forever and no janitor goroutine is needed.
+type Keyed[K comparable] struct {
+	mu         sync.Mutex
+	limiters   map[K]*keyedEntry
+	newLimiter func(K) *Limiter
+	idleTTL    time.Duration
+	clock      Clock
+	lastSweep  time.Time
+}
+
+type keyedEntry struct {
+	l        *Limiter
+	lastUsed time.Time
+}
+
+// NewKeyed returns per-key limiters built on demand by newLimiter. A nil clk
+// uses RealClock; pass the same clock to the limiters newLimiter creates.
+func NewKeyed[K comparable](newLimiter func(K) *Limiter, idleTTL time.Duration, clk Clock) *Keyed[K] {
+	if clk == nil {
+		clk = RealClock{}
+	}
+	return &Keyed[K]{
+		limiters:   make(map[K]*keyedEntry),
+		newLimiter: newLimiter,
+		idleTTL:    idleTTL,
+		clock:      clk,
+		lastSweep:  clk.Now(),
+	}
+}
+
+// Get returns the limiter for key, creating it if needed.
+func (k *Keyed[K]) Get(key K) *Limiter {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	now := k.clock.Now()
+	if k.idleTTL > 0 && now.Sub(k.lastSweep) >= k.idleTTL {
+		k.sweepLocked(now)
+	}
+	e, ok := k.limiters[key]
+	if !ok {
+		e = &keyedEntry{l: k.newLimiter(key)}
+		k.limiters[key] = e
+	}
+	e.lastUsed = now
+	return e.l
+}
+
+// Allow is Get(key).Allow().
+func (k *Keyed[K]) Allow(key K) bool { return k.Get(key).Allow() }
+
+// Reserve is Get(key).Reserve().
+func (k *Keyed[K]) Reserve(key K) *Reservation { return k.Get(key).Reserve() }
+
+// Wait is Get(key).Wait(ctx).
+func (k *Keyed[K]) Wait(ctx context.Context, key K) error { return k.Get(key).Wait(ctx) }
+
+// SetRate changes the rate of key's limiter.
+func (k *Keyed[K]) SetRate(key K, r Rate) { k.Get(key).SetRate(r) }
+
+// Len returns the number of tracked keys.
+func (k *Keyed[K]) Len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.limiters)
+}
+
+// Sweep drops limiters idle for at least idleTTL and returns how many.
+func (k *Keyed[K]) Sweep() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.sweepLocked(k.clock.Now())
+}
+
+func (k *Keyed[K]) sweepLocked(now time.Time) int {
+	k.lastSweep = now
+	n := 0
+	for key, e := range k.limiters {
+		if now.Sub(e.lastUsed) >= k.idleTTL {
+			delete(k.limiters, key)
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,188 @@
+// Package ratelimit provides rate limiters that compute availability from
+// timestamps instead of refilling with a goroutine and a ticker, as
+// goroutine/examples/rate_limiter_ticker.go does.
+//
+// All algorithms share one Limiter API: Allow (never waits), Reserve (books
+// capacity and says how long to wait), Wait (blocks, honouring the context)
+// and SetRate. Time comes from an injectable Clock so tests are
+// deterministic.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Rate is Count events per Per.
+type Rate struct {
+	Count int
+	Per   time.Duration
+}
+
+// PerSecond returns a Rate of n events per second.
+func PerSecond(n int) Rate { return Rate{Count: n, Per: time.Second} }
+
+// interval is the time between events at this rate.
+func (r Rate) interval() time.Duration {
+	if r.Count <= 0 {
+		return 0
+	}
+	return r.Per / time.Duration(r.Count)
+}
+
+func (r Rate) String() string { return fmt.Sprintf("%d/%v", r.Count, r.Per) }
+
+// ErrExceedsBurst is returned when n can never be satisfied because it is
+// larger than the limiter's burst (or window limit).
+var ErrExceedsBurst = errors.New("ratelimit: n exceeds burst")
+
+// ErrWouldExceedDeadline is returned by Wait when the required delay ends
+// after the context's deadline, so waiting would be pointless.
+var ErrWouldExceedDeadline = errors.New("ratelimit: wait would exceed context deadline")
+
+// algorithm is the per-strategy state. Methods are called with Limiter.mu held.
+type algorithm interface {
+	// reserve books n events if they can start within maxWait and returns
+	// the delay before they may proceed. ok=false means nothing was booked.
+	reserve(now time.Time, n int, maxWait time.Duration) (delay time.Duration, ok bool)
+	// unreserve gives back n events booked for time at.
+	unreserve(now time.Time, n int, at time.Time)
+	setRate(now time.Time, r Rate)
+	// capacity is the largest n a single call may ask for.
+	capacity() int
+}
+
+// Limiter is safe for concurrent use.
+type Limiter struct {
+	mu    sync.Mutex
+	clock Clock
+	alg   algorithm
+}
+
+func newLimiter(alg algorithm, clk Clock) *Limiter {
+	if clk == nil {
+		clk = RealClock{}
+	}
+	return &Limiter{clock: clk, alg: alg}
+}
+
+// Allow reports whether one event may happen now.
+func (l *Limiter) Allow() bool { return l.AllowN(1) }
+
+// AllowN reports whether n events may happen now, consuming them if so.
+func (l *Limiter) AllowN(n int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if n > l.alg.capacity() {
+		return false
+	}
+	_, ok := l.alg.reserve(l.clock.Now(), n, 0)
+	return ok
+}
+
+// Reservation is capacity booked ahead of time.
+type Reservation struct {
+	l       *Limiter
+	n       int
+	ok      bool // guarded by l.mu; cleared by Cancel
+	exceeds bool // n is above the limiter's capacity
+	at      time.Time
+	delay   time.Duration
+}
+
+// OK is false if the request can never be satisfied (n above burst), or
+// after Cancel.
+func (r *Reservation) OK() bool {
+	r.l.mu.Lock()
+	defer r.l.mu.Unlock()
+	return r.ok
+}
+
+// Delay is how long the caller must wait before acting, as of reservation.
+func (r *Reservation) Delay() time.Duration { return r.delay }
+
+// Cancel returns the booked capacity so later callers can use it. Call it
+// when the reservation will not be used.
+func (r *Reservation) Cancel() {
+	r.l.mu.Lock()
+	defer r.l.mu.Unlock()
+	if !r.ok {
+		return
+	}
+	r.ok = false
+	r.l.alg.unreserve(r.l.clock.Now(), r.n, r.at)
+}
+
+// Reserve books one event. See ReserveN.
+func (l *Limiter) Reserve() *Reservation { return l.ReserveN(1) }
+
+// ReserveN books n events, however far in the future that is. The caller
+// should wait Delay before acting, or Cancel.
+func (l *Limiter) ReserveN(n int) *Reservation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.reserveLocked(n, maxDuration)
+}
+
+func (l *Limiter) reserveLocked(n int, maxWait time.Duration) *Reservation {
+	r := &Reservation{l: l, n: n}
+	if n > l.alg.capacity() {
+		r.exceeds = true
+		return r
+	}
+	now := l.clock.Now()
+	delay, ok := l.alg.reserve(now, n, maxWait)
+	r.ok, r.delay, r.at = ok, delay, now.Add(delay)
+	return r
+}
+
+// Wait blocks until one event may proceed or ctx is done.
+func (l *Limiter) Wait(ctx context.Context) error { return l.WaitN(ctx, 1) }
+
+// WaitN blocks until n events may proceed. If ctx has a deadline that the
+// wait would overrun, it fails immediately without consuming capacity.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	maxWait := maxDuration
+	if dl, ok := ctx.Deadline(); ok {
+		maxWait = dl.Sub(l.clock.Now())
+	}
+	r := l.reserveLocked(n, maxWait)
+	ok, delay := r.ok, r.delay
+	l.mu.Unlock()
+
+	if !ok {
+		if r.exceeds {
+			return fmt.Errorf("%w: n=%d", ErrExceedsBurst, n)
+		}
+		return ErrWouldExceedDeadline
+	}
+	if delay <= 0 {
+		return nil
+	}
+	t := l.clock.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C():
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		return ctx.Err()
+	}
+}
+
+// SetRate changes the rate from now on. Capacity already accrued at the old
+// rate is kept.
+func (l *Limiter) SetRate(r Rate) {
+	l.mu.Lock()
+	l.alg.setRate(l.clock.Now(), r)
+	l.mu.Unlock()
+}
+
+const maxDuration time.Duration = 1<<63 - 1
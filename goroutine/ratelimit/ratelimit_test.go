@@ -0,0 +1,216 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"gobyexamples/goroutine/clock"
+)
+
+// newFakeClock returns a fake clock; Wait's deadline checks work with it
+// as long as contexts are made with clock.WithTimeout/WithDeadline on it.
+func newFakeClock() *clock.Fake { return clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) }
+
+// allowed counts how many of n back-to-back Allow calls succeed.
+func allowed(l *Limiter, n int) int {
+	ok := 0
+	for i := 0; i < n; i++ {
+		if l.Allow() {
+			ok++
+		}
+	}
+	return ok
+}
+
+func TestTokenBucketLazyRefill(t *testing.T) {
+	clk := newFakeClock()
+	l := NewTokenBucket(PerSecond(10), 5, clk) // 1 token / 100ms, burst 5
+
+	if got := allowed(l, 10); got != 5 {
+		t.Fatalf("initial burst = %d, want 5", got)
+	}
+	clk.Advance(250 * time.Millisecond)
+	if got := allowed(l, 10); got != 2 {
+		t.Fatalf("after 250ms = %d, want 2", got)
+	}
+	clk.Advance(time.Hour)
+	if got := allowed(l, 10); got != 5 {
+		t.Fatalf("refill capped at burst: got %d", got)
+	}
+	if l.AllowN(6) {
+		t.Fatal("AllowN above burst succeeded")
+	}
+}
+
+func TestTokenBucketReserveAndCancel(t *testing.T) {
+	clk := newFakeClock()
+	l := NewTokenBucket(PerSecond(10), 1, clk)
+	l.Allow()
+	r := l.Reserve()
+	if !r.OK() || r.Delay() != 100*time.Millisecond {
+		t.Fatalf("reserve ok=%v delay=%v", r.OK(), r.Delay())
+	}
+	r2 := l.Reserve()
+	if r2.Delay() != 200*time.Millisecond {
+		t.Fatalf("second reserve delay = %v", r2.Delay())
+	}
+	r2.Cancel()
+	r.Cancel()
+	clk.Advance(100 * time.Millisecond)
+	if !l.Allow() {
+		t.Fatal("cancelled reservations were not returned")
+	}
+	if r := l.ReserveN(2); r.OK() {
+		t.Fatal("ReserveN above burst should not be OK")
+	}
+
+	// Cancelling twice, even concurrently, gives the capacity back once.
+	l.Allow()
+	r = l.Reserve()
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() { defer wg.Done(); r.Cancel() }()
+	}
+	wg.Wait()
+	if r.OK() {
+		t.Fatal("cancelled reservation still OK")
+	}
+	if l.Allow() {
+		t.Fatal("double Cancel returned capacity twice")
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	clk := newFakeClock()
+	l := NewSlidingWindow(Rate{Count: 3, Per: time.Second}, clk)
+	if got := allowed(l, 5); got != 3 {
+		t.Fatalf("first window = %d, want 3", got)
+	}
+	clk.Advance(500 * time.Millisecond)
+	if l.Allow() {
+		t.Fatal("window still full after 500ms")
+	}
+	r := l.Reserve()
+	if r.Delay() != 500*time.Millisecond {
+		t.Fatalf("reserve delay = %v, want 500ms", r.Delay())
+	}
+	clk.Advance(500 * time.Millisecond)
+	// The first three expired; one slot is taken by the reservation.
+	if got := allowed(l, 5); got != 2 {
+		t.Fatalf("after window slid = %d, want 2", got)
+	}
+}
+
+func TestGCRA(t *testing.T) {
+	clk := newFakeClock()
+	l := NewGCRA(PerSecond(10), 3, clk)
+	if got := allowed(l, 10); got != 3 {
+		t.Fatalf("burst = %d, want 3", got)
+	}
+	clk.Advance(100 * time.Millisecond)
+	if got := allowed(l, 10); got != 1 {
+		t.Fatalf("after one interval = %d, want 1", got)
+	}
+	if d := l.Reserve().Delay(); d != 100*time.Millisecond {
+		t.Fatalf("reserve delay = %v", d)
+	}
+}
+
+func TestSetRate(t *testing.T) {
+	for name, mk := range map[string]func(Clock) *Limiter{
+		"token": func(c Clock) *Limiter { return NewTokenBucket(PerSecond(1), 1, c) },
+		"gcra":  func(c Clock) *Limiter { return NewGCRA(PerSecond(1), 1, c) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			clk := newFakeClock()
+			l := mk(clk)
+			l.Allow()
+			l.SetRate(PerSecond(100))
+			clk.Advance(10 * time.Millisecond)
+			if !l.Allow() {
+				t.Fatal("faster rate not applied")
+			}
+		})
+	}
+	clk := newFakeClock()
+	sw := NewSlidingWindow(Rate{Count: 1, Per: time.Second}, clk)
+	sw.Allow()
+	sw.SetRate(Rate{Count: 2, Per: time.Second})
+	if !sw.Allow() {
+		t.Fatal("sliding window limit not raised")
+	}
+}
+
+func TestWaitUsesClock(t *testing.T) {
+	clk := newFakeClock()
+	l := NewTokenBucket(PerSecond(10), 1, clk)
+	l.Allow()
+
+	done := make(chan error)
+	go func() { done <- l.Wait(context.Background()) }()
+	clk.BlockUntil(1)
+	select {
+	case <-done:
+		t.Fatal("Wait returned before the clock advanced")
+	default:
+	}
+	clk.Advance(100 * time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitCancelAndDeadline(t *testing.T) {
+	clk := newFakeClock()
+	l := NewTokenBucket(PerSecond(10), 1, clk)
+	l.Allow()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- l.Wait(ctx) }()
+	clk.BlockUntil(1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v", err)
+	}
+	// The cancelled wait gave its token back.
+	clk.Advance(100 * time.Millisecond)
+	if !l.Allow() {
+		t.Fatal("token not returned after cancelled Wait")
+	}
+
+	// Deadline closer than the needed delay: fail fast.
+	short, cancel2 := clock.WithTimeout(context.Background(), clk, 10*time.Millisecond)
+	defer cancel2()
+	if err := l.Wait(short); !errors.Is(err, ErrWouldExceedDeadline) {
+		t.Fatalf("err = %v, want ErrWouldExceedDeadline", err)
+	}
+	if err := l.WaitN(context.Background(), 5); !errors.Is(err, ErrExceedsBurst) {
+		t.Fatalf("err = %v, want ErrExceedsBurst", err)
+	}
+}
+
+func TestKeyedIdleEviction(t *testing.T) {
+	clk := newFakeClock()
+	k := NewKeyed(func(string) *Limiter { return NewTokenBucket(PerSecond(1), 1, clk) }, time.Minute, clk)
+	if !k.Allow("a") || k.Allow("a") {
+		t.Fatal("per-key limit not applied")
+	}
+	if !k.Allow("b") {
+		t.Fatal("keys must not share a limiter")
+	}
+	clk.Advance(30 * time.Second)
+	k.Allow("b")
+	clk.Advance(40 * time.Second)
+	k.Get("c") // triggers a lazy sweep: a idle 70s, b idle 40s
+	if k.Len() != 2 {
+		t.Fatalf("Len = %d, want 2 (a evicted)", k.Len())
+	}
+	if n := k.Sweep(); n != 0 {
+		t.Fatalf("Sweep evicted %d", n)
+	}
+}
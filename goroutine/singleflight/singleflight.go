@@ -0,0 +1,173 @@
+// Package singleflight deduplicates concurrent calls that compute the same
+// thing. While a call for a key is in flight, later callers for that key wait
+// for its result instead of starting their own.
+//
+// Compared to golang.org/x/sync/singleflight it is generic, each waiter can
+// give up through its own context without cancelling the call for the
+// others, results can be cached for a short TTL, and a panic in the function
+// is re-raised in every waiter instead of only one.
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// ErrGoexit is returned to waiters when the function called runtime.Goexit
+// (for example via t.FailNow in a test helper).
+var ErrGoexit = errors.New("singleflight: function called runtime.Goexit")
+
+// PanicError is the value re-panicked in every waiter when the shared
+// function panics.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("singleflight: panic: %v\n\n%s", p.Value, p.Stack)
+}
+
+// Options configures a Group. The zero value disables caching.
+type Options struct {
+	// CacheTTL keeps successful results for this long after the call
+	// finishes, so a burst of callers right after completion is also served.
+	CacheTTL time.Duration
+	// Now overrides time.Now for cache expiry (tests).
+	Now func() time.Time
+}
+
+// Group deduplicates calls by key. The zero value is not usable; use NewGroup.
+type Group[K comparable, V any] struct {
+	mu    sync.Mutex
+	calls map[K]*call[V]
+	cache map[K]cached[V]
+	ttl   time.Duration
+	now   func() time.Time
+}
+
+type call[V any] struct {
+	done     chan struct{}
+	cancel   context.CancelFunc
+	waiters  int // callers still waiting; guarded by Group.mu
+	dups     int // callers that joined after the first; guarded by Group.mu
+	val      V
+	err      error
+	panicErr *PanicError
+	shared   bool
+}
+
+type cached[V any] struct {
+	val     V
+	expires time.Time
+}
+
+// NewGroup returns an empty Group.
+func NewGroup[K comparable, V any](opts Options) *Group[K, V] {
+	now := opts.Now
+	if now == nil {
+		now = time.Now
+	}
+	return &Group[K, V]{
+		calls: make(map[K]*call[V]),
+		cache: make(map[K]cached[V]),
+		ttl:   opts.CacheTTL,
+		now:   now,
+	}
+}
+
+// Do returns the result of fn for key, running fn only if no call for key is
+// already in flight (or cached). shared reports whether the result was also
+// handed to other callers or came from the cache.
+//
+// fn receives a context that carries ctx's values but not its cancellation:
+// it is cancelled only once every waiter has given up. If ctx ends first, Do
+// returns ctx.Err() and the call keeps running for the remaining waiters.
+func (g *Group[K, V]) Do(ctx context.Context, key K, fn func(context.Context) (V, error)) (v V, err error, shared bool) {
+	g.mu.Lock()
+	if g.ttl > 0 {
+		if c, ok := g.cache[key]; ok {
+			if g.now().Before(c.expires) {
+				g.mu.Unlock()
+				return c.val, nil, true
+			}
+			delete(g.cache, key)
+		}
+	}
+	if c, ok := g.calls[key]; ok {
+		c.waiters++
+		c.dups++
+		g.mu.Unlock()
+		return g.wait(ctx, key, c)
+	}
+	callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	c := &call[V]{done: make(chan struct{}), cancel: cancel, waiters: 1}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	go g.run(callCtx, key, c, fn)
+	return g.wait(ctx, key, c)
+}
+
+// Forget drops any cached result for key and detaches an in-flight call, so
+// the next Do starts a fresh call. Current waiters still get the old result.
+func (g *Group[K, V]) Forget(key K) {
+	g.mu.Lock()
+	delete(g.calls, key)
+	delete(g.cache, key)
+	g.mu.Unlock()
+}
+
+func (g *Group[K, V]) wait(ctx context.Context, key K, c *call[V]) (v V, err error, shared bool) {
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		last := c.waiters == 0
+		if last && g.calls[key] == c {
+			delete(g.calls, key) // don't let new callers join a cancelled call
+		}
+		shared = c.dups > 0
+		g.mu.Unlock()
+		if last {
+			c.cancel()
+		}
+		return v, ctx.Err(), shared
+	}
+	if c.panicErr != nil {
+		panic(c.panicErr)
+	}
+	return c.val, c.err, c.shared
+}
+
+func (g *Group[K, V]) run(ctx context.Context, key K, c *call[V], fn func(context.Context) (V, error)) {
+	normalReturn := false
+	defer func() {
+		if !normalReturn {
+			if r := recover(); r != nil {
+				c.panicErr = &PanicError{Value: r, Stack: debug.Stack()}
+			} else {
+				c.err = ErrGoexit
+			}
+		}
+		c.cancel()
+		g.mu.Lock()
+		current := g.calls[key] == c // false after Forget or once a newer call took the key
+		if current {
+			delete(g.calls, key)
+		}
+		if current && normalReturn && c.err == nil && g.ttl > 0 {
+			g.cache[key] = cached[V]{val: c.val, expires: g.now().Add(g.ttl)}
+		}
+		c.shared = c.dups > 0
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	c.val, c.err = fn(ctx)
+	normalReturn = true
+}
@@ -0,0 +1,233 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDedupSameKey(t *testing.T) {
+	g := NewGroup[string, int](Options{})
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fn := func(context.Context) (int, error) {
+		calls.Add(1)
+		<-release
+		return 42, nil
+	}
+
+	const n = 100
+	var wg sync.WaitGroup
+	var sharedCount atomic.Int32
+	started := make(chan struct{}, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			started <- struct{}{}
+			v, err, shared := g.Do(context.Background(), "k", fn)
+			if err != nil || v != 42 {
+				t.Errorf("Do = %d, %v", v, err)
+			}
+			if shared {
+				sharedCount.Add(1)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		<-started
+	}
+	time.Sleep(10 * time.Millisecond) // let callers reach Do
+	close(release)
+	wg.Wait()
+	if calls.Load() != 1 {
+		t.Fatalf("fn ran %d times, want 1", calls.Load())
+	}
+	if sharedCount.Load() != n {
+		t.Fatalf("%d callers saw shared=true, want %d", sharedCount.Load(), n)
+	}
+}
+
+func TestDifferentKeysRunIndependently(t *testing.T) {
+	g := NewGroup[int, string](Options{})
+	var calls atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		for dup := 0; dup < 4; dup++ {
+			wg.Add(1)
+			go func(k int) {
+				defer wg.Done()
+				v, _, _ := g.Do(context.Background(), k, func(context.Context) (string, error) {
+					calls.Add(1)
+					time.Sleep(5 * time.Millisecond)
+					return fmt.Sprint(k), nil
+				})
+				if v != fmt.Sprint(k) {
+					t.Errorf("key %d got %q", k, v)
+				}
+			}(i)
+		}
+	}
+	wg.Wait()
+	if c := calls.Load(); c < 50 || c > 200 {
+		t.Fatalf("calls = %d", c)
+	}
+}
+
+// One waiter leaving must not cancel the call for the others; the last one
+// leaving must.
+func TestWaiterCancellation(t *testing.T) {
+	g := NewGroup[string, int](Options{})
+	callCancelled := make(chan struct{})
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (int, error) {
+		select {
+		case <-release:
+			return 1, nil
+		case <-ctx.Done():
+			close(callCancelled)
+			return 0, ctx.Err()
+		}
+	}
+
+	impatient, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { _, err, _ := g.Do(impatient, "k", fn); errc <- err }()
+	time.Sleep(5 * time.Millisecond)
+	patient := make(chan int, 1)
+	go func() { v, _, _ := g.Do(context.Background(), "k", fn); patient <- v }()
+	time.Sleep(5 * time.Millisecond)
+
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Fatalf("impatient err = %v", err)
+	}
+	select {
+	case <-callCancelled:
+		t.Fatal("shared call cancelled while a waiter remained")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	if v := <-patient; v != 1 {
+		t.Fatalf("patient got %d", v)
+	}
+
+	// Sole waiter gives up: the call is cancelled.
+	g2 := NewGroup[string, int](Options{})
+	callCancelled = make(chan struct{})
+	release = make(chan struct{})
+	ctx, cancel2 := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel2()
+	g2.Do(ctx, "k", fn)
+	select {
+	case <-callCancelled:
+	case <-time.After(time.Second):
+		t.Fatal("call not cancelled after last waiter left")
+	}
+}
+
+func TestPanicPropagatesToAllWaiters(t *testing.T) {
+	g := NewGroup[string, int](Options{})
+	release := make(chan struct{})
+	fn := func(context.Context) (int, error) {
+		<-release
+		panic("boom")
+	}
+	var wg sync.WaitGroup
+	var panics atomic.Int32
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				var pe *PanicError
+				if r := recover(); r != nil {
+					if err, ok := r.(error); ok && errors.As(err, &pe) && pe.Value == "boom" {
+						panics.Add(1)
+					}
+				}
+			}()
+			g.Do(context.Background(), "k", fn)
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if panics.Load() != 5 {
+		t.Fatalf("%d waiters saw the panic, want 5", panics.Load())
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	var now atomic.Int64
+	clock := func() time.Time { return time.Unix(0, now.Load()) }
+	g := NewGroup[string, int](Options{CacheTTL: time.Second, Now: clock})
+	var calls atomic.Int32
+	fn := func(context.Context) (int, error) { return int(calls.Add(1)), nil }
+
+	g.Do(context.Background(), "k", fn)
+	if v, _, shared := g.Do(context.Background(), "k", fn); v != 1 || !shared {
+		t.Fatalf("cached Do = %d, shared=%v", v, shared)
+	}
+	now.Add(int64(2 * time.Second))
+	if v, _, _ := g.Do(context.Background(), "k", fn); v != 2 {
+		t.Fatalf("expired Do = %d, want fresh call", v)
+	}
+	g.Forget("k")
+	if v, _, _ := g.Do(context.Background(), "k", fn); v != 3 {
+		t.Fatalf("after Forget = %d", v)
+	}
+
+	failing := func(context.Context) (int, error) { calls.Add(1); return 0, errors.New("x") }
+	before := calls.Load()
+	g.Do(context.Background(), "err", failing)
+	g.Do(context.Background(), "err", failing)
+	if calls.Load()-before != 2 {
+		t.Fatal("errors must not be cached")
+	}
+}
+
+func TestForgetInFlight(t *testing.T) {
+	g := NewGroup[string, int](Options{CacheTTL: time.Hour})
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fn := func(context.Context) (int, error) {
+		n := calls.Add(1)
+		if n == 1 {
+			<-release
+		}
+		return int(n), nil
+	}
+
+	first := make(chan int, 1)
+	go func() { v, _, _ := g.Do(context.Background(), "k", fn); first <- v }()
+	for calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	g.Forget("k")
+	close(release)
+	if v := <-first; v != 1 {
+		t.Fatalf("detached call returned %d to its waiter", v)
+	}
+	// The detached call must not have cached its result.
+	if v, _, _ := g.Do(context.Background(), "k", fn); v != 2 {
+		t.Fatalf("Do after Forget = %d, want a fresh call", v)
+	}
+}
+
+func TestCancelledSoleWaiterNotShared(t *testing.T) {
+	g := NewGroup[string, int](Options{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err, shared := g.Do(ctx, "k", func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) || shared {
+		t.Fatalf("Do = %v, shared=%v; want Canceled, false", err, shared)
+	}
+}
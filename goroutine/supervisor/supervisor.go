@@ -0,0 +1,434 @@
+// Package supervisor keeps long-running goroutines alive, Erlang style.
+//
+// A Supervisor owns an ordered list of child services. When a child returns
+// or panics it is restarted according to its Restart policy and the
+// supervisor's Strategy, with exponential backoff between restarts. If
+// children fail more than MaxRestarts times Within a window the supervisor
+// stops them all and returns ErrTooManyRestarts, so a parent supervisor (a
+// Supervisor is itself a Service) can restart the whole subtree.
+//
+// Cancelling the context passed to Run stops the children in reverse start
+// order, giving each its ShutdownTimeout to return.
+package supervisor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Service is a long-running task. Run should block until ctx is cancelled
+// or the work fails.
+type Service interface {
+	Run(ctx context.Context) error
+}
+
+// ServiceFunc adapts a function to Service.
+type ServiceFunc func(ctx context.Context) error
+
+func (f ServiceFunc) Run(ctx context.Context) error { return f(ctx) }
+
+// Strategy decides which children are restarted when one exits.
+type Strategy int
+
+const (
+	// OneForOne restarts only the child that exited.
+	OneForOne Strategy = iota
+	// OneForAll stops every other child and restarts them all.
+	OneForAll
+	// RestForOne restarts the child and every child added after it, for
+	// when later children depend on earlier ones.
+	RestForOne
+)
+
+// Restart says when a child that exited should be started again.
+type Restart int
+
+const (
+	// Permanent children are always restarted.
+	Permanent Restart = iota
+	// Transient children are restarted only after an error or panic.
+	Transient
+	// Temporary children are never restarted.
+	Temporary
+)
+
+// Child describes one supervised service.
+type Child struct {
+	Name    string
+	Service Service
+	Restart Restart
+	// ShutdownTimeout bounds how long shutdown waits for Run to return after
+	// its context is cancelled. Zero uses Options.ShutdownTimeout.
+	ShutdownTimeout time.Duration
+}
+
+// Options configures a Supervisor. The zero value is a one-for-one
+// supervisor allowing 3 restarts in 5 seconds with no backoff.
+type Options struct {
+	Strategy Strategy
+	// MaxRestarts within Within before the supervisor gives up.
+	MaxRestarts int
+	Within      time.Duration
+	// Backoff is the delay before the first restart in a window; it doubles
+	// with each further restart up to MaxBackoff (default 10s).
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// ShutdownTimeout is the default per-child stop timeout (default 5s).
+	ShutdownTimeout time.Duration
+}
+
+// ErrTooManyRestarts is returned by Run when restart intensity is exceeded.
+var ErrTooManyRestarts = errors.New("supervisor: too many restarts")
+
+// PanicError is the error recorded for a child that panicked.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (p *PanicError) Error() string { return fmt.Sprintf("panic: %v\n\n%s", p.Value, p.Stack) }
+
+type child struct {
+	spec     Child
+	status   Status
+	restarts int
+	lastErr  error
+	gen      int // bumped on every start/stop so stale exits are ignored
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// Supervisor runs and restarts a set of children. Add children before
+// calling Run.
+type Supervisor struct {
+	name string
+	opts Options
+
+	mu       sync.Mutex
+	children []*child
+	status   Status
+	running  bool
+}
+
+// New returns an idle supervisor.
+func New(name string, opts Options) *Supervisor {
+	if opts.MaxRestarts <= 0 {
+		opts.MaxRestarts = 3
+	}
+	if opts.Within <= 0 {
+		opts.Within = 5 * time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 10 * time.Second
+	}
+	if opts.ShutdownTimeout <= 0 {
+		opts.ShutdownTimeout = 5 * time.Second
+	}
+	return &Supervisor{name: name, opts: opts}
+}
+
+// Add appends a child. Children start in the order they were added.
+func (s *Supervisor) Add(c Child) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		panic("supervisor: Add after Run")
+	}
+	if c.ShutdownTimeout <= 0 {
+		c.ShutdownTimeout = s.opts.ShutdownTimeout
+	}
+	s.children = append(s.children, &child{spec: c})
+}
+
+// AddFunc is Add for a permanent ServiceFunc.
+func (s *Supervisor) AddFunc(name string, f func(ctx context.Context) error) {
+	s.Add(Child{Name: name, Service: ServiceFunc(f)})
+}
+
+type exit struct {
+	i, gen int
+	err    error
+}
+
+// Run starts the children and supervises them until ctx is cancelled (it
+// then stops them and returns nil) or restart intensity is exceeded.
+func (s *Supervisor) Run(ctx context.Context) error {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return errors.New("supervisor: " + s.name + " already running")
+	}
+	s.running = true
+	s.status = Running
+	n := len(s.children)
+	s.mu.Unlock()
+
+	quit := make(chan struct{})
+	defer close(quit)
+	exits := make(chan exit)
+	for i := 0; i < n; i++ {
+		s.start(ctx, i, 0, exits, quit)
+	}
+
+	var window []time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			s.stopAll(Stopped)
+			return nil
+		case e := <-exits:
+			if ctx.Err() != nil {
+				// The child saw the cancellation before we did.
+				s.stopAll(Stopped)
+				return nil
+			}
+			if !s.exited(e) {
+				continue
+			}
+			now := time.Now()
+			window = prune(window, now.Add(-s.opts.Within))
+			window = append(window, now)
+			if len(window) > s.opts.MaxRestarts {
+				s.stopAll(Failed)
+				return fmt.Errorf("%w: %s: child %q: %v", ErrTooManyRestarts, s.name, s.children[e.i].spec.Name, e.err)
+			}
+
+			from, to := e.i, e.i+1
+			switch s.opts.Strategy {
+			case OneForAll:
+				from, to = 0, n
+			case RestForOne:
+				to = n
+			}
+			again := []int{e.i}
+			for j := to - 1; j >= from; j-- {
+				if j != e.i && s.stop(j) {
+					again = append(again, j)
+				}
+			}
+			sort.Ints(again)
+			delay := s.backoff(len(window))
+			for _, j := range again {
+				s.mu.Lock()
+				s.children[j].restarts++
+				s.mu.Unlock()
+				s.start(ctx, j, delay, exits, quit)
+			}
+		}
+	}
+}
+
+// exited records a child's exit and reports whether it must be restarted.
+func (s *Supervisor) exited(e exit) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.children[e.i]
+	if e.gen != c.gen {
+		return false // stopped on purpose
+	}
+	c.cancel()
+	c.cancel = nil
+	if e.err != nil {
+		c.lastErr = e.err
+	}
+	if c.spec.Restart == Permanent || (c.spec.Restart == Transient && e.err != nil) {
+		return true
+	}
+	c.status = Stopped
+	return false
+}
+
+func (s *Supervisor) backoff(restarts int) time.Duration {
+	d := s.opts.Backoff
+	for i := 1; i < restarts && d < s.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, s.opts.MaxBackoff)
+}
+
+func prune(ts []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(ts) && ts[i].Before(cutoff) {
+		i++
+	}
+	return ts[i:]
+}
+
+// start launches child i after delay.
+func (s *Supervisor) start(ctx context.Context, i int, delay time.Duration, exits chan<- exit, quit <-chan struct{}) {
+	s.mu.Lock()
+	c := s.children[i]
+	// Children are cancelled one at a time by stop, not all at once by ctx,
+	// so shutdown can proceed in order.
+	cctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	c.gen++
+	gen := c.gen
+	c.cancel = cancel
+	c.done = make(chan struct{})
+	done := c.done
+	c.status = Running
+	if delay > 0 {
+		c.status = Restarting
+	}
+	s.mu.Unlock()
+
+	go func() {
+		err := s.run(cctx, c, gen, delay)
+		close(done)
+		select {
+		case exits <- exit{i, gen, err}:
+		case <-quit:
+		}
+	}()
+}
+
+func (s *Supervisor) run(ctx context.Context, c *child, gen int, delay time.Duration) (err error) {
+	if delay > 0 {
+		t := time.NewTimer(delay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		s.mu.Lock()
+		if c.gen == gen {
+			c.status = Running
+		}
+		s.mu.Unlock()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return c.spec.Service.Run(ctx)
+}
+
+// stop cancels child i and waits up to its ShutdownTimeout for it to
+// return. It reports whether the child was live.
+func (s *Supervisor) stop(i int) bool {
+	s.mu.Lock()
+	c := s.children[i]
+	cancel, done := c.cancel, c.done
+	c.gen++
+	c.cancel = nil
+	c.status = Stopped
+	s.mu.Unlock()
+	if cancel == nil {
+		return false
+	}
+	cancel()
+	t := time.NewTimer(c.spec.ShutdownTimeout)
+	defer t.Stop()
+	select {
+	case <-done:
+	case <-t.C:
+		s.mu.Lock()
+		c.lastErr = fmt.Errorf("supervisor: %q did not stop within %v; abandoned", c.spec.Name, c.spec.ShutdownTimeout)
+		s.mu.Unlock()
+	}
+	return true
+}
+
+// stopAll stops the children last-started first.
+func (s *Supervisor) stopAll(final Status) {
+	for j := len(s.children) - 1; j >= 0; j-- {
+		s.stop(j)
+	}
+	s.mu.Lock()
+	s.status = final
+	s.running = false
+	s.mu.Unlock()
+}
+
+// Status is the lifecycle state of a supervisor or child.
+type Status int
+
+const (
+	Idle Status = iota
+	Running
+	Restarting // waiting out the backoff
+	Stopped
+	Failed // gave up after too many restarts
+)
+
+func (s Status) String() string {
+	switch s {
+	case Idle:
+		return "idle"
+	case Running:
+		return "running"
+	case Restarting:
+		return "restarting"
+	case Stopped:
+		return "stopped"
+	case Failed:
+		return "failed"
+	}
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+func (s Status) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
+
+// State is a point-in-time view of a supervisor tree.
+type State struct {
+	Name      string  `json:"name"`
+	Status    Status  `json:"status"`
+	Restarts  int     `json:"restarts,omitempty"`
+	LastError string  `json:"last_error,omitempty"`
+	Children  []State `json:"children,omitempty"`
+}
+
+// Healthy reports whether st is running and so is every child that has not
+// finished for good.
+func (st State) Healthy() bool {
+	if st.Status != Running {
+		return false
+	}
+	for _, c := range st.Children {
+		if c.Status != Stopped && !c.Healthy() {
+			return false
+		}
+	}
+	return true
+}
+
+// State returns the current state, descending into nested supervisors.
+func (s *Supervisor) State() State {
+	s.mu.Lock()
+	st := State{Name: s.name, Status: s.status, Children: make([]State, len(s.children))}
+	subs := make(map[int]*Supervisor)
+	for i, c := range s.children {
+		cs := State{Name: c.spec.Name, Status: c.status, Restarts: c.restarts}
+		if c.lastErr != nil {
+			cs.LastError = c.lastErr.Error()
+		}
+		st.Children[i] = cs
+		if sub, ok := c.spec.Service.(*Supervisor); ok {
+			subs[i] = sub
+		}
+	}
+	s.mu.Unlock()
+	for i, sub := range subs {
+		st.Children[i].Children = sub.State().Children
+	}
+	return st
+}
+
+// ServeHTTP serves State as JSON: 200 when healthy, 503 otherwise.
+func (s *Supervisor) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	st := s.State()
+	w.Header().Set("Content-Type", "application/json")
+	if !st.Healthy() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(st)
+}
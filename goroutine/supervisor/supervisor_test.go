@@ -0,0 +1,284 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gobyexamples/goroutine/leakcheck"
+)
+
+var (
+	errBoom  = errors.New("boom")
+	errPanic = errors.New("panic instead")
+)
+
+// eventLog records start/stop events across children in order.
+type eventLog struct {
+	mu  sync.Mutex
+	evs []string
+}
+
+func (l *eventLog) add(ev string) {
+	l.mu.Lock()
+	l.evs = append(l.evs, ev)
+	l.mu.Unlock()
+}
+
+func (l *eventLog) events() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.evs)
+}
+
+// probe runs until cancelled, or until told to fail through fail.
+type probe struct {
+	name   string
+	log    *eventLog
+	starts atomic.Int32
+	fail   chan error // errPanic panics
+}
+
+func newProbe(name string, log *eventLog) *probe {
+	return &probe{name: name, log: log, fail: make(chan error, 1)}
+}
+
+func (p *probe) Run(ctx context.Context) error {
+	p.starts.Add(1)
+	p.log.add("start " + p.name)
+	select {
+	case <-ctx.Done():
+		p.log.add("stop " + p.name)
+		return nil
+	case err := <-p.fail:
+		if err == errPanic {
+			panic("boom")
+		}
+		return err
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// runAsync runs s and returns a func that cancels it and returns Run's error.
+func runAsync(s *Supervisor) func() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+	return func() error { cancel(); return <-done }
+}
+
+func TestOneForOneRestartsPanickingChild(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	log := new(eventLog)
+	a, b := newProbe("a", log), newProbe("b", log)
+	s := New("root", Options{})
+	s.Add(Child{Name: "a", Service: a})
+	s.Add(Child{Name: "b", Service: b})
+	stop := runAsync(s)
+
+	waitFor(t, "children to start", func() bool { return a.starts.Load() == 1 && b.starts.Load() == 1 })
+	a.fail <- errPanic
+	waitFor(t, "a to restart", func() bool { return a.starts.Load() == 2 })
+	if b.starts.Load() != 1 {
+		t.Fatalf("sibling restarted under one-for-one")
+	}
+	st := s.State()
+	if st.Children[0].Restarts != 1 || !strings.Contains(st.Children[0].LastError, "panic: boom") {
+		t.Fatalf("state = %+v", st.Children[0])
+	}
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.State().Status; got != Stopped {
+		t.Fatalf("status after shutdown = %v", got)
+	}
+}
+
+func TestStrategies(t *testing.T) {
+	for _, tc := range []struct {
+		strategy Strategy
+		starts   []int32
+		stops    []string // sibling stops, in order
+	}{
+		{OneForOne, []int32{1, 2, 1}, nil},
+		{OneForAll, []int32{2, 2, 2}, []string{"stop c", "stop a"}},
+		{RestForOne, []int32{1, 2, 2}, []string{"stop c"}},
+	} {
+		t.Run(tc.strategy.name(), func(t *testing.T) {
+			log := new(eventLog)
+			ps := []*probe{newProbe("a", log), newProbe("b", log), newProbe("c", log)}
+			s := New("root", Options{Strategy: tc.strategy})
+			for _, p := range ps {
+				s.Add(Child{Name: p.name, Service: p})
+			}
+			stop := runAsync(s)
+			defer stop()
+
+			waitFor(t, "children to start", func() bool { return len(log.events()) == 3 })
+			ps[1].fail <- errBoom
+			waitFor(t, "b to restart", func() bool { return ps[1].starts.Load() == 2 })
+			waitFor(t, "restarts to settle", func() bool {
+				for i, p := range ps {
+					if p.starts.Load() != tc.starts[i] {
+						return false
+					}
+				}
+				return true
+			})
+			var stops []string
+			for _, ev := range log.events() {
+				if strings.HasPrefix(ev, "stop") {
+					stops = append(stops, ev)
+				}
+			}
+			if !slices.Equal(stops, tc.stops) {
+				t.Fatalf("sibling stops = %v, want %v", stops, tc.stops)
+			}
+		})
+	}
+}
+
+func (s Strategy) name() string { return [...]string{"one-for-one", "one-for-all", "rest-for-one"}[s] }
+
+func TestRestartIntensityWithBackoff(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	var starts atomic.Int32
+	s := New("root", Options{MaxRestarts: 2, Within: time.Second, Backoff: 20 * time.Millisecond})
+	s.AddFunc("crashy", func(context.Context) error {
+		starts.Add(1)
+		return errBoom
+	})
+	begin := time.Now()
+	err := s.Run(context.Background())
+	if !errors.Is(err, ErrTooManyRestarts) || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("err = %v", err)
+	}
+	if starts.Load() != 3 {
+		t.Fatalf("starts = %d, want 3 (initial + 2 restarts)", starts.Load())
+	}
+	if el := time.Since(begin); el < 60*time.Millisecond { // 20ms + 40ms backoff
+		t.Fatalf("gave up after %v; backoff not applied", el)
+	}
+	if st := s.State(); st.Status != Failed || st.Healthy() {
+		t.Fatalf("state = %+v", st)
+	}
+}
+
+func TestRestartPolicies(t *testing.T) {
+	for _, tc := range []struct {
+		restart Restart
+		err     error
+		starts  int32
+	}{
+		{Transient, nil, 1},
+		{Transient, errBoom, 2},
+		{Temporary, errBoom, 1},
+		{Permanent, nil, 2},
+	} {
+		log := new(eventLog)
+		p := newProbe("p", log)
+		s := New("root", Options{})
+		s.Add(Child{Name: "p", Service: p, Restart: tc.restart})
+		stop := runAsync(s)
+		waitFor(t, "start", func() bool { return p.starts.Load() == 1 })
+		p.fail <- tc.err
+		if tc.starts == 2 {
+			waitFor(t, "restart", func() bool { return p.starts.Load() == 2 })
+		} else {
+			waitFor(t, "stopped", func() bool { return s.State().Children[0].Status == Stopped })
+			time.Sleep(10 * time.Millisecond)
+			if p.starts.Load() != 1 {
+				t.Fatalf("restart=%d err=%v: restarted", tc.restart, tc.err)
+			}
+			if !s.State().Healthy() {
+				t.Fatal("a finished child made the tree unhealthy")
+			}
+		}
+		stop()
+	}
+}
+
+func TestShutdownOrderAndTimeout(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	log := new(eventLog)
+	release := make(chan struct{})
+	defer close(release)
+	s := New("root", Options{})
+	s.Add(Child{Name: "a", Service: newProbe("a", log)})
+	s.Add(Child{Name: "stuck", ShutdownTimeout: 20 * time.Millisecond, Service: ServiceFunc(func(context.Context) error {
+		log.add("start stuck")
+		<-release // ignores ctx
+		return nil
+	})})
+	s.Add(Child{Name: "c", Service: newProbe("c", log)})
+	stop := runAsync(s)
+	waitFor(t, "children to start", func() bool { return len(log.events()) == 3 })
+
+	begin := time.Now()
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	if el := time.Since(begin); el < 20*time.Millisecond || el > time.Second {
+		t.Fatalf("shutdown took %v", el)
+	}
+	if got := log.events()[3:]; !slices.Equal(got, []string{"stop c", "stop a"}) {
+		t.Fatalf("shutdown order = %v", got)
+	}
+	if st := s.State().Children[1]; !strings.Contains(st.LastError, "abandoned") {
+		t.Fatalf("stuck child state = %+v", st)
+	}
+}
+
+func TestNestedSupervisorEscalates(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	var flakyStarts atomic.Int32
+	inner := New("inner", Options{MaxRestarts: 1})
+	inner.AddFunc("flaky", func(ctx context.Context) error {
+		if flakyStarts.Add(1) <= 2 {
+			return errBoom
+		}
+		<-ctx.Done()
+		return nil
+	})
+	outer := New("outer", Options{})
+	outer.Add(Child{Name: "inner", Service: inner})
+	outer.Add(Child{Name: "sibling", Service: newProbe("sibling", new(eventLog))})
+	stop := runAsync(outer)
+	defer stop()
+
+	waitFor(t, "inner restarted by outer", func() bool { return flakyStarts.Load() == 3 })
+	st := outer.State()
+	in := st.Children[0]
+	if in.Restarts != 1 || !strings.Contains(in.LastError, ErrTooManyRestarts.Error()) {
+		t.Fatalf("inner as seen by outer = %+v", in)
+	}
+	if len(in.Children) != 1 || in.Children[0].Name != "flaky" || in.Children[0].Status != Running {
+		t.Fatalf("nested state = %+v", in.Children)
+	}
+	if !st.Healthy() {
+		t.Fatalf("tree unhealthy: %+v", st)
+	}
+
+	rec := httptest.NewRecorder()
+	outer.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"name":"flaky","status":"running"`) {
+		t.Fatalf("health check: %d %s", rec.Code, rec.Body)
+	}
+}
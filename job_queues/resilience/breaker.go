@@ -0,0 +1,330 @@
+// Package resilience guards outbound calls from workers so a failing
+// downstream cannot take the callers down with it.
+//
+// A Breaker stops calling a dependency once it is clearly failing and probes
+// it again after a cool-down; a Bulkhead bounds how many calls to one
+// dependency may be in flight at once; Retry is the retry-with-backoff loop
+// from JobQueuesGuide.md section 5, made aware of open breakers. All three
+// take a func(context.Context) error, so they nest:
+//
+//	err := resilience.Retry(ctx, ropts, func(ctx context.Context) error {
+//		return br.Do(ctx, func(ctx context.Context) error {
+//			return bh.Do(ctx, call)
+//		})
+//	})
+//
+// Transport applies a Breaker and a Bulkhead to an http.RoundTripper.
+// Time comes from a clock.Clock; nil means real time.
+package resilience
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"gobyexamples/goroutine/clock"
+)
+
+// State is a breaker's position.
+type State int
+
+const (
+	// Closed lets every call through and counts the outcomes.
+	Closed State = iota
+	// Open rejects calls with ErrOpen until OpenTimeout has passed.
+	Open
+	// HalfOpen lets a few probe calls through to decide whether to close.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// ErrOpen is returned instead of making a call while the breaker is open,
+// or while half-open and all probe slots are taken.
+var ErrOpen = errors.New("resilience: circuit breaker is open")
+
+// Options configures a Breaker. The zero value trips after 5 consecutive
+// failures, or when at least half of 20 or more calls in the last 10
+// seconds failed, and probes again after 5 seconds.
+type Options struct {
+	// Window is the rolling period failure rates are measured over, split
+	// into Buckets slots (defaults 10s and 10) that expire one at a time.
+	Window  time.Duration
+	Buckets int
+	// FailureRate trips the breaker when failures/calls in the window reach
+	// it (default 0.5), once the window holds at least MinCalls (default 20).
+	FailureRate float64
+	MinCalls    int
+	// ConsecutiveFailures trips the breaker regardless of the window
+	// (default 5).
+	ConsecutiveFailures int
+	// OpenTimeout is how long the breaker stays open before probing
+	// (default 5s).
+	OpenTimeout time.Duration
+	// HalfOpenCalls is how many probes may run at once while half-open, and
+	// how many must succeed in a row to close again (default 1).
+	HalfOpenCalls int
+	// IsFailure classifies the error returned to Do. The default counts
+	// every error except context.Canceled, which is the caller giving up
+	// rather than the dependency failing.
+	IsFailure func(error) bool
+	// OnStateChange is called after every transition, outside the
+	// breaker's lock, so it may call State.
+	OnStateChange func(name string, from, to State)
+	Clock         clock.Clock
+}
+
+// Counts is a snapshot of the calls the breaker has seen.
+type Counts struct {
+	Calls, Failures     int // in the rolling window
+	ConsecutiveFailures int
+}
+
+type bucket struct {
+	epoch           int64 // which Window/Buckets slice of time this holds
+	calls, failures int
+}
+
+// Breaker is a circuit breaker. It is safe for concurrent use.
+type Breaker struct {
+	name  string
+	opts  Options
+	clock clock.Clock
+	width time.Duration // of one bucket
+	start time.Time     // bucket epochs count from here
+
+	mu          sync.Mutex
+	state       State
+	gen         uint64 // bumped on every transition so stale outcomes are ignored
+	buckets     []bucket
+	consecutive int
+	openedAt    time.Time
+	probes      int // half-open calls in flight
+	probeWins   int // half-open successes in a row
+}
+
+// NewBreaker returns a closed breaker. name is passed to OnStateChange and
+// helps tell breakers apart in logs.
+func NewBreaker(name string, opts Options) *Breaker {
+	if opts.Window <= 0 {
+		opts.Window = 10 * time.Second
+	}
+	if opts.Buckets <= 0 {
+		opts.Buckets = 10
+	}
+	if opts.FailureRate <= 0 {
+		opts.FailureRate = 0.5
+	}
+	if opts.MinCalls <= 0 {
+		opts.MinCalls = 20
+	}
+	if opts.ConsecutiveFailures <= 0 {
+		opts.ConsecutiveFailures = 5
+	}
+	if opts.OpenTimeout <= 0 {
+		opts.OpenTimeout = 5 * time.Second
+	}
+	if opts.HalfOpenCalls <= 0 {
+		opts.HalfOpenCalls = 1
+	}
+	if opts.IsFailure == nil {
+		opts.IsFailure = func(err error) bool { return err != nil && !errors.Is(err, context.Canceled) }
+	}
+	clk := opts.Clock
+	if clk == nil {
+		clk = clock.RealClock{}
+	}
+	width := opts.Window / time.Duration(opts.Buckets)
+	if width <= 0 {
+		width = 1
+	}
+	return &Breaker{
+		name:    name,
+		opts:    opts,
+		clock:   clk,
+		width:   width,
+		start:   clk.Now(),
+		buckets: make([]bucket, opts.Buckets),
+	}
+}
+
+// Name returns the name given to NewBreaker.
+func (b *Breaker) Name() string { return b.name }
+
+// Do calls fn if the breaker allows it and records the outcome. It returns
+// ErrOpen without calling fn while the breaker is open. A panic in fn is
+// recorded as a failure and then continues up the stack.
+func (b *Breaker) Do(ctx context.Context, fn func(context.Context) error) error {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+	returned := false
+	defer func() {
+		if !returned {
+			done(false) // fn panicked; free the half-open probe slot
+		}
+	}()
+	err = fn(ctx)
+	returned = true
+	done(!b.opts.IsFailure(err))
+	return err
+}
+
+// Allow is the two-step form of Do for callers that decide success
+// themselves, such as Transport looking at status codes. On success the
+// caller must call done exactly once with the call's outcome.
+func (b *Breaker) Allow() (done func(success bool), err error) {
+	b.mu.Lock()
+	now := b.clock.Now()
+	change := b.advance(now)
+	switch {
+	case b.state == Open:
+		err = ErrOpen
+	case b.state == HalfOpen && b.probes >= b.opts.HalfOpenCalls:
+		err = ErrOpen
+	case b.state == HalfOpen:
+		b.probes++
+	}
+	gen := b.gen
+	b.mu.Unlock()
+	b.notify(change)
+	if err != nil {
+		return nil, err
+	}
+	var once sync.Once
+	return func(success bool) {
+		once.Do(func() { b.record(gen, success) })
+	}, nil
+}
+
+// State returns the current state, moving from open to half-open if the
+// timeout has passed.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	change := b.advance(b.clock.Now())
+	s := b.state
+	b.mu.Unlock()
+	b.notify(change)
+	return s
+}
+
+// Counts returns the outcomes in the current window.
+func (b *Breaker) Counts() Counts {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := Counts{ConsecutiveFailures: b.consecutive}
+	c.Calls, c.Failures = b.window(b.clock.Now())
+	return c
+}
+
+// transition describes a state change to report once the lock is released.
+type transition struct {
+	from, to State
+	ok       bool
+}
+
+func (b *Breaker) notify(t transition) {
+	if t.ok && b.opts.OnStateChange != nil {
+		b.opts.OnStateChange(b.name, t.from, t.to)
+	}
+}
+
+func (b *Breaker) record(gen uint64, success bool) {
+	b.mu.Lock()
+	now := b.clock.Now()
+	change := b.advance(now)
+	if gen != b.gen {
+		// The call started in an earlier state; its outcome says nothing
+		// about the current one.
+		b.mu.Unlock()
+		b.notify(change)
+		return
+	}
+	switch b.state {
+	case Closed:
+		bk := b.bucket(now)
+		bk.calls++
+		if success {
+			b.consecutive = 0
+		} else {
+			bk.failures++
+			b.consecutive++
+			calls, failures := b.window(now)
+			if b.consecutive >= b.opts.ConsecutiveFailures ||
+				calls >= b.opts.MinCalls && float64(failures) >= b.opts.FailureRate*float64(calls) {
+				change = b.setState(Open, now)
+			}
+		}
+	case HalfOpen:
+		b.probes--
+		if !success {
+			change = b.setState(Open, now)
+		} else if b.probeWins++; b.probeWins >= b.opts.HalfOpenCalls {
+			change = b.setState(Closed, now)
+		}
+	}
+	b.mu.Unlock()
+	b.notify(change)
+}
+
+// advance moves an open breaker to half-open once OpenTimeout has passed.
+func (b *Breaker) advance(now time.Time) transition {
+	if b.state == Open && now.Sub(b.openedAt) >= b.opts.OpenTimeout {
+		return b.setState(HalfOpen, now)
+	}
+	return transition{}
+}
+
+func (b *Breaker) setState(s State, now time.Time) transition {
+	t := transition{from: b.state, to: s, ok: true}
+	b.state = s
+	b.gen++
+	b.probes, b.probeWins = 0, 0
+	switch s {
+	case Open:
+		b.openedAt = now
+	case Closed:
+		// Start afresh so failures from before the outage cannot trip the
+		// breaker again straight away.
+		clear(b.buckets)
+		b.consecutive = 0
+	}
+	return t
+}
+
+// bucket returns the slot for now, clearing it if it last held an older
+// slice of time.
+func (b *Breaker) bucket(now time.Time) *bucket {
+	epoch := b.epoch(now)
+	bk := &b.buckets[int(epoch%int64(len(b.buckets)))]
+	if bk.epoch != epoch {
+		*bk = bucket{epoch: epoch}
+	}
+	return bk
+}
+
+// window sums the buckets that are still inside the rolling window.
+func (b *Breaker) window(now time.Time) (calls, failures int) {
+	epoch := b.epoch(now)
+	for _, bk := range b.buckets {
+		if epoch-bk.epoch < int64(len(b.buckets)) {
+			calls += bk.calls
+			failures += bk.failures
+		}
+	}
+	return calls, failures
+}
+
+func (b *Breaker) epoch(now time.Time) int64 { return int64(now.Sub(b.start) / b.width) }
@@ -0,0 +1,82 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gobyexamples/goroutine/clock"
+)
+
+// ErrBulkheadFull is returned when no slot frees up within MaxWait.
+var ErrBulkheadFull = errors.New("resilience: bulkhead full")
+
+// BulkheadOptions configures a Bulkhead.
+type BulkheadOptions struct {
+	// MaxConcurrent is the number of calls allowed in flight (default 10).
+	MaxConcurrent int
+	// MaxWait is how long a call may wait for a slot; zero rejects as soon
+	// as every slot is busy.
+	MaxWait time.Duration
+	Clock   clock.Clock
+}
+
+// Bulkhead bounds concurrent calls to one dependency, so a slow downstream
+// ties up at most MaxConcurrent workers instead of all of them. Use one
+// Bulkhead per dependency. It is safe for concurrent use.
+type Bulkhead struct {
+	slots chan struct{}
+	wait  time.Duration
+	clock clock.Clock
+}
+
+// NewBulkhead returns an empty bulkhead.
+func NewBulkhead(opts BulkheadOptions) *Bulkhead {
+	if opts.MaxConcurrent <= 0 {
+		opts.MaxConcurrent = 10
+	}
+	clk := opts.Clock
+	if clk == nil {
+		clk = clock.RealClock{}
+	}
+	return &Bulkhead{slots: make(chan struct{}, opts.MaxConcurrent), wait: opts.MaxWait, clock: clk}
+}
+
+// Acquire takes a slot, waiting up to MaxWait. It returns ErrBulkheadFull
+// when the wait runs out, or ctx's error if ctx ends first. Every
+// successful Acquire must be paired with a Release.
+func (b *Bulkhead) Acquire(ctx context.Context) error {
+	select {
+	case b.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	if b.wait <= 0 {
+		return ErrBulkheadFull
+	}
+	t := b.clock.NewTimer(b.wait)
+	defer t.Stop()
+	select {
+	case b.slots <- struct{}{}:
+		return nil
+	case <-t.C():
+		return ErrBulkheadFull
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release frees a slot taken by Acquire.
+func (b *Bulkhead) Release() { <-b.slots }
+
+// InFlight returns the number of slots in use.
+func (b *Bulkhead) InFlight() int { return len(b.slots) }
+
+// Do runs fn in a slot.
+func (b *Bulkhead) Do(ctx context.Context, fn func(context.Context) error) error {
+	if err := b.Acquire(ctx); err != nil {
+		return err
+	}
+	defer b.Release()
+	return fn(ctx)
+}
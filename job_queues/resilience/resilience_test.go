@@ -0,0 +1,396 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gobyexamples/goroutine/clock"
+	"gobyexamples/goroutine/leakcheck"
+)
+
+var (
+	bg      = context.Background()
+	start   = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	errDown = errors.New("downstream failed")
+)
+
+// downstream is a local server whose failures the test switches on and off.
+type downstream struct {
+	srv  *httptest.Server
+	fail atomic.Bool
+	hits atomic.Int32
+	hold chan struct{} // when non-nil, requests wait for it to close
+}
+
+func newDownstream(t *testing.T, hold chan struct{}) *downstream {
+	d := &downstream{hold: hold}
+	d.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		d.hits.Add(1)
+		if d.hold != nil {
+			<-d.hold
+		}
+		if d.fail.Load() {
+			http.Error(w, "injected failure", http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	t.Cleanup(d.srv.Close)
+	return d
+}
+
+func (d *downstream) client(br *Breaker, bh *Bulkhead) *http.Client {
+	return &http.Client{Transport: &Transport{Base: d.srv.Client().Transport, Breaker: br, Bulkhead: bh}}
+}
+
+// get returns the status code, or the error for requests that were not sent.
+func get(c *http.Client, url string) (int, error) {
+	resp, err := c.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func recordTransitions(log *[]string) func(string, State, State) {
+	return func(name string, from, to State) {
+		*log = append(*log, fmt.Sprintf("%s: %v->%v", name, from, to))
+	}
+}
+
+func TestBreakerOverHTTP(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	d := newDownstream(t, nil)
+	clk := clock.NewFake(start)
+	var log []string
+	br := NewBreaker("users", Options{
+		ConsecutiveFailures: 3,
+		OpenTimeout:         time.Second,
+		OnStateChange:       recordTransitions(&log),
+		Clock:               clk,
+	})
+	c := d.client(br, nil)
+
+	d.fail.Store(true)
+	for i := 0; i < 3; i++ {
+		if code, err := get(c, d.srv.URL); code != http.StatusInternalServerError {
+			t.Fatalf("request %d: %d, %v", i, code, err)
+		}
+	}
+	if _, err := get(c, d.srv.URL); !errors.Is(err, ErrOpen) {
+		t.Fatalf("open breaker: err = %v", err)
+	}
+	if d.hits.Load() != 3 {
+		t.Fatalf("open breaker still called the downstream: %d hits", d.hits.Load())
+	}
+
+	clk.Advance(time.Second)
+	if br.State() != HalfOpen {
+		t.Fatalf("state after OpenTimeout = %v", br.State())
+	}
+	d.fail.Store(false)
+	if code, err := get(c, d.srv.URL); code != http.StatusOK {
+		t.Fatalf("probe: %d, %v", code, err)
+	}
+	if br.State() != Closed || br.Counts() != (Counts{}) {
+		t.Fatalf("after probe: %v %+v", br.State(), br.Counts())
+	}
+	want := "[users: closed->open users: open->half-open users: half-open->closed]"
+	if fmt.Sprint(log) != want {
+		t.Fatalf("transitions = %v, want %v", log, want)
+	}
+}
+
+func TestHalfOpenProbes(t *testing.T) {
+	clk := clock.NewFake(start)
+	br := NewBreaker("db", Options{ConsecutiveFailures: 1, HalfOpenCalls: 2, Clock: clk})
+	br.Do(bg, func(context.Context) error { return errDown })
+	clk.Advance(5 * time.Second)
+
+	done1, err1 := br.Allow()
+	done2, err2 := br.Allow()
+	if err1 != nil || err2 != nil {
+		t.Fatalf("probes rejected: %v, %v", err1, err2)
+	}
+	if _, err := br.Allow(); !errors.Is(err, ErrOpen) {
+		t.Fatalf("third probe: err = %v", err)
+	}
+	done1(true)
+	done2(false)
+	if br.State() != Open {
+		t.Fatalf("failed probe left the breaker %v", br.State())
+	}
+	done2(true) // extra calls are ignored
+	if br.State() != Open {
+		t.Fatal("second done call changed the state")
+	}
+
+	clk.Advance(5 * time.Second)
+	for i := 0; i < 2; i++ {
+		if err := br.Do(bg, func(context.Context) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if br.State() != Closed {
+		t.Fatalf("after 2 good probes: %v", br.State())
+	}
+}
+
+func TestFailureRateOverRollingWindow(t *testing.T) {
+	clk := clock.NewFake(start)
+	br := NewBreaker("api", Options{
+		Window:              10 * time.Second,
+		MinCalls:            10,
+		ConsecutiveFailures: 100,
+		Clock:               clk,
+	})
+	call := func(fail bool) {
+		br.Do(bg, func(context.Context) error {
+			if fail {
+				return errDown
+			}
+			return nil
+		})
+	}
+	// Nine calls, five failures: over the rate but under MinCalls.
+	for i := 0; i < 9; i++ {
+		call(i%2 == 0)
+	}
+	if br.State() != Closed {
+		t.Fatal("tripped below MinCalls")
+	}
+
+	// The old calls age out one bucket at a time.
+	clk.Advance(9 * time.Second)
+	if c := br.Counts(); c.Calls != 9 {
+		t.Fatalf("calls after 9s = %d", c.Calls)
+	}
+	clk.Advance(time.Second)
+	if c := br.Counts(); c.Calls != 0 || c.ConsecutiveFailures != 1 {
+		t.Fatalf("counts after the window = %+v", c)
+	}
+
+	for i := 0; i < 9; i++ {
+		call(i%2 == 0)
+	}
+	call(false) // 10 calls, 5 failures: rate reached, but the call succeeded
+	if br.State() != Closed {
+		t.Fatal("tripped on a success")
+	}
+	call(true)
+	if br.State() != Open {
+		t.Fatalf("6 of 11 failed: state %v %+v", br.State(), br.Counts())
+	}
+}
+
+func TestPanicFreesProbe(t *testing.T) {
+	clk := clock.NewFake(start)
+	br := NewBreaker("db", Options{ConsecutiveFailures: 1, Clock: clk})
+	br.Do(bg, func(context.Context) error { return errDown })
+	clk.Advance(5 * time.Second)
+	bh := NewBulkhead(BulkheadOptions{MaxConcurrent: 1})
+	rt := &Transport{
+		Base:     roundTripFunc(func(*http.Request) (*http.Response, error) { panic("boom") }),
+		Breaker:  br,
+		Bulkhead: bh,
+	}
+	for _, call := range []func(){
+		func() { br.Do(bg, func(context.Context) error { panic("boom") }) },
+		func() { rt.RoundTrip(httptest.NewRequest("GET", "http://x/", nil)) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("panic was swallowed")
+				}
+			}()
+			call()
+		}()
+		if br.State() != Open {
+			t.Fatalf("panicking probe left the breaker %v", br.State())
+		}
+		clk.Advance(5 * time.Second)
+		done, err := br.Allow()
+		if err != nil {
+			t.Fatalf("probe slot not freed: %v", err)
+		}
+		done(false) // reopen, ready for the next panicking probe
+		clk.Advance(5 * time.Second)
+	}
+	if err := bh.Acquire(bg); err != nil {
+		t.Fatalf("bulkhead slot not released: %v", err)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestCancelIsNotAFailure(t *testing.T) {
+	br := NewBreaker("x", Options{ConsecutiveFailures: 1})
+	ctx, cancel := context.WithCancel(bg)
+	cancel()
+	err := br.Do(ctx, func(ctx context.Context) error { return ctx.Err() })
+	if !errors.Is(err, context.Canceled) || br.State() != Closed {
+		t.Fatalf("err = %v, state %v", err, br.State())
+	}
+}
+
+func TestBulkheadOverHTTP(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	hold := make(chan struct{})
+	d := newDownstream(t, hold)
+	bh := NewBulkhead(BulkheadOptions{MaxConcurrent: 2})
+	c := d.client(nil, bh)
+
+	codes := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			code, _ := get(c, d.srv.URL)
+			codes <- code
+		}()
+	}
+	for d.hits.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := get(c, d.srv.URL); !errors.Is(err, ErrBulkheadFull) {
+		t.Fatalf("third request: err = %v", err)
+	}
+	close(hold)
+	for i := 0; i < 2; i++ {
+		if code := <-codes; code != http.StatusOK {
+			t.Fatalf("held request: %d", code)
+		}
+	}
+	if d.hits.Load() != 2 || bh.InFlight() != 0 {
+		t.Fatalf("hits %d, in flight %d", d.hits.Load(), bh.InFlight())
+	}
+
+	// The slot is held until the body is closed.
+	resp, err := c.Get(d.srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bh.InFlight() != 1 {
+		t.Fatalf("in flight with an open body = %d", bh.InFlight())
+	}
+	resp.Body.Close()
+	if bh.InFlight() != 0 {
+		t.Fatal("Close did not release the slot")
+	}
+}
+
+func TestBulkheadWait(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	clk := clock.NewFake(start)
+	bh := NewBulkhead(BulkheadOptions{MaxConcurrent: 1, MaxWait: time.Second, Clock: clk})
+	if err := bh.Acquire(bg); err != nil {
+		t.Fatal(err)
+	}
+
+	errc := make(chan error)
+	go func() { errc <- bh.Acquire(bg) }()
+	clk.BlockUntil(1)
+	clk.Advance(time.Second)
+	if err := <-errc; !errors.Is(err, ErrBulkheadFull) {
+		t.Fatalf("timed out wait: err = %v", err)
+	}
+
+	go func() { errc <- bh.Do(bg, func(context.Context) error { return errDown }) }()
+	clk.BlockUntil(1)
+	bh.Release()
+	if err := <-errc; !errors.Is(err, errDown) {
+		t.Fatalf("waiter that got the slot: err = %v", err)
+	}
+	if bh.InFlight() != 0 {
+		t.Fatalf("in flight = %d", bh.InFlight())
+	}
+
+	bh.Acquire(bg)
+	ctx, cancel := context.WithCancel(bg)
+	go func() { errc <- bh.Acquire(ctx) }()
+	clk.BlockUntil(1)
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled wait: err = %v", err)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	clk := clock.NewFake(start)
+	var calls atomic.Int32
+	errc := make(chan error)
+	go func() {
+		errc <- Retry(bg, RetryOptions{Attempts: 4, Clock: clk}, func(context.Context) error {
+			if calls.Add(1) < 3 {
+				return errDown
+			}
+			return nil
+		})
+	}()
+	clk.BlockUntil(1)
+	clk.Advance(10 * time.Millisecond)
+	clk.BlockUntil(1)
+	clk.Advance(19 * time.Millisecond)
+	if calls.Load() != 2 {
+		t.Fatalf("backoff did not double: %d calls", calls.Load())
+	}
+	clk.Advance(time.Millisecond)
+	if err := <-errc; err != nil || calls.Load() != 3 {
+		t.Fatalf("err = %v after %d calls", err, calls.Load())
+	}
+
+	err := Retry(bg, RetryOptions{Attempts: 2, Backoff: time.Nanosecond}, func(context.Context) error { return errDown })
+	if !errors.Is(err, errDown) {
+		t.Fatalf("out of attempts: err = %v", err)
+	}
+}
+
+func TestRetryStopsAtOpenBreaker(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	d := newDownstream(t, nil)
+	d.fail.Store(true)
+	clk := clock.NewFake(start)
+	br := NewBreaker("orders", Options{ConsecutiveFailures: 2, Clock: clk})
+	bh := NewBulkhead(BulkheadOptions{MaxConcurrent: 4})
+	c := d.srv.Client()
+
+	call := func(ctx context.Context) error {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, d.srv.URL, nil)
+		resp, err := c.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			return fmt.Errorf("status %d", resp.StatusCode)
+		}
+		return nil
+	}
+	errc := make(chan error)
+	go func() {
+		errc <- Retry(bg, RetryOptions{Attempts: 5, Clock: clk}, func(ctx context.Context) error {
+			return br.Do(ctx, func(ctx context.Context) error {
+				return bh.Do(ctx, call)
+			})
+		})
+	}()
+	for i := 0; i < 2; i++ {
+		clk.BlockUntil(1)
+		clk.Advance(time.Second)
+	}
+	err := <-errc
+	if !errors.Is(err, ErrOpen) || d.hits.Load() != 2 {
+		t.Fatalf("err = %v after %d hits", err, d.hits.Load())
+	}
+}
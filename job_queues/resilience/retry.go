@@ -0,0 +1,63 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gobyexamples/goroutine/clock"
+)
+
+// RetryOptions configures Retry. The zero value makes 3 attempts starting
+// at a 10ms backoff, like withRetry in JobQueuesGuide.md.
+type RetryOptions struct {
+	// Attempts is the total number of calls, including the first.
+	Attempts int
+	// Backoff is the wait after the first failure; it doubles after each
+	// further failure up to MaxBackoff (default 1s).
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Retryable decides whether an error is worth another attempt. The
+	// default retries everything except ErrOpen: an open breaker will not
+	// close within a backoff, so retrying only adds load to the caller.
+	Retryable func(error) bool
+	Clock     clock.Clock
+}
+
+// Retry calls fn until it succeeds, returns an error Retryable rejects, or
+// Attempts run out, and returns fn's last error. It stops early with ctx's
+// error when ctx ends during a backoff.
+func Retry(ctx context.Context, opts RetryOptions, fn func(context.Context) error) error {
+	if opts.Attempts <= 0 {
+		opts.Attempts = 3
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = 10 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = time.Second
+	}
+	if opts.Retryable == nil {
+		opts.Retryable = func(err error) bool { return !errors.Is(err, ErrOpen) }
+	}
+	clk := opts.Clock
+	if clk == nil {
+		clk = clock.RealClock{}
+	}
+
+	backoff := opts.Backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(ctx); err == nil || attempt == opts.Attempts || !opts.Retryable(err) {
+			return err
+		}
+		t := clk.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C():
+		}
+		backoff = min(2*backoff, opts.MaxBackoff)
+	}
+}
@@ -0,0 +1,99 @@
+package resilience
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Transport is an http.RoundTripper that sends requests through a Bulkhead
+// and a Breaker, in that order, so requests rejected by a full bulkhead do
+// not count against the dependency. Either may be nil. Use one Transport
+// (and one Breaker and Bulkhead) per downstream service.
+//
+// Rejected requests fail with ErrBulkheadFull or ErrOpen, which http.Client
+// wraps in a *url.Error; errors.Is still matches them.
+type Transport struct {
+	// Base makes the actual request; nil means http.DefaultTransport.
+	Base     http.RoundTripper
+	Breaker  *Breaker
+	Bulkhead *Bulkhead
+	// Failed decides whether a round trip counts as a breaker failure. The
+	// default counts transport errors the Breaker's IsFailure accepts and 5xx
+	// responses. Failed responses are still returned to the caller.
+	Failed func(*http.Response, error) bool
+}
+
+// RoundTrip implements http.RoundTripper. The bulkhead slot is held until
+// the response body is closed, since reading it still occupies the
+// downstream.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	release := func() {}
+	if t.Bulkhead != nil {
+		if err := t.Bulkhead.Acquire(req.Context()); err != nil {
+			closeBody(req)
+			return nil, err
+		}
+		release = t.Bulkhead.Release
+	}
+	done := func(bool) {}
+	if t.Breaker != nil {
+		var err error
+		if done, err = t.Breaker.Allow(); err != nil {
+			release()
+			closeBody(req)
+			return nil, err
+		}
+	}
+
+	returned := false
+	defer func() {
+		if !returned { // base panicked
+			done(false)
+			release()
+		}
+	}()
+	resp, err := base.RoundTrip(req)
+	returned = true
+	done(!t.failed(resp, err))
+	if err != nil || resp.Body == nil {
+		release()
+		return resp, err
+	}
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+func (t *Transport) failed(resp *http.Response, err error) bool {
+	if t.Failed != nil {
+		return t.Failed(resp, err)
+	}
+	if err != nil {
+		return t.Breaker == nil || t.Breaker.opts.IsFailure(err)
+	}
+	return resp.StatusCode >= 500
+}
+
+// closeBody honours the RoundTripper contract of closing the request body
+// even when the request is never sent.
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
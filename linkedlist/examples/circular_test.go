@@ -1,8 +1,13 @@
 package main
 
-import "testing"
+import (
+	"testing"
+
+	"gobyexamples/goroutine/leakcheck"
+)
 
 func TestCircularBasic(t *testing.T) {
+	leakcheck.VerifyNone(t)
 	var r CircularSingly
 	// empty traverse
 	if got := r.Traverse(); len(got) != 0 { t.Fatalf("expected empty traverse, got %v", got) }
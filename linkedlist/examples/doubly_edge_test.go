@@ -1,8 +1,13 @@
 package main
 
-import "testing"
+import (
+	"testing"
+
+	"gobyexamples/goroutine/leakcheck"
+)
 
 func TestDoublyEdgeCases(t *testing.T) {
+	leakcheck.VerifyNone(t)
 	var d DoublyLinkedList
 	// empty operations
 	if d.Delete(1) { t.Fatal("delete on empty should be false") }
@@ -1,8 +1,13 @@
 package main
 
-import "testing"
+import (
+	"testing"
+
+	"gobyexamples/goroutine/leakcheck"
+)
 
 func TestDoublyReverse(t *testing.T) {
+	leakcheck.VerifyNone(t)
 	var d DoublyLinkedList
 	for i := 1; i <= 5; i++ { d.Append(i) }
 	d.Reverse()
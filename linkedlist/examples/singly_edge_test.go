@@ -1,8 +1,13 @@
 package main
 
-import "testing"
+import (
+	"testing"
+
+	"gobyexamples/goroutine/leakcheck"
+)
 
 func TestSinglyEdgeCases(t *testing.T) {
+	leakcheck.VerifyNone(t)
 	var l LinkedListS
 	// delete/search on empty
 	if l.Delete(1) { t.Fatal("delete on empty should be false") }
@@ -1,8 +1,13 @@
 package main
 
-import "testing"
+import (
+	"testing"
+
+	"gobyexamples/goroutine/leakcheck"
+)
 
 func TestSinglyReverse(t *testing.T) {
+	leakcheck.VerifyNone(t)
 	var l LinkedListS
 	for i := 1; i <= 5; i++ { l.Append(i) }
 	l.Reverse()
@@ -0,0 +1,114 @@
+package bench
+
+import (
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"gobyexamples/mutex/cmap"
+)
+
+// Run with: go test -bench=Map -benchmem ./mutex/bench -cpu=1,4,8
+//
+// Compares the single-lock SafeMap from mutex/007_map_with_mutex.go, sync.Map
+// and the sharded cmap.ConcurrentMap at 90% reads / 10% writes over uniform
+// and zipfian (a few very hot keys) key distributions.
+
+type safeMap struct {
+	mu sync.Mutex
+	m  map[string]int
+}
+
+func (s *safeMap) Get(k string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.m[k]
+	return v, ok
+}
+
+func (s *safeMap) Set(k string, v int) {
+	s.mu.Lock()
+	s.m[k] = v
+	s.mu.Unlock()
+}
+
+const benchKeys = 4096
+
+var benchKeyNames = func() []string {
+	k := make([]string, benchKeys)
+	for i := range k {
+		k[i] = "k" + strconv.Itoa(i)
+	}
+	return k
+}()
+
+// keyDist returns a per-goroutine generator of key indexes.
+type keyDist struct {
+	name string
+	next func(r *rand.Rand) func() int
+}
+
+var keyDists = []keyDist{
+	{"uniform", func(r *rand.Rand) func() int {
+		return func() int { return r.Intn(benchKeys) }
+	}},
+	{"zipf", func(r *rand.Rand) func() int {
+		z := rand.NewZipf(r, 1.1, 1, benchKeys-1)
+		return func() int { return int(z.Uint64()) }
+	}},
+}
+
+type benchMap interface {
+	Get(string) (int, bool)
+	Set(string, int)
+}
+
+type syncMapAdapter struct{ m sync.Map }
+
+func (s *syncMapAdapter) Get(k string) (int, bool) {
+	v, ok := s.m.Load(k)
+	if !ok {
+		return 0, false
+	}
+	return v.(int), true
+}
+
+func (s *syncMapAdapter) Set(k string, v int) { s.m.Store(k, v) }
+
+func runMapBench(b *testing.B, m benchMap, d keyDist) {
+	for i, k := range benchKeyNames {
+		m.Set(k, i)
+	}
+	var seed atomic.Int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		next := d.next(rand.New(rand.NewSource(seed.Add(1))))
+		i := 0
+		for pb.Next() {
+			k := benchKeyNames[next()]
+			if i%10 == 0 {
+				m.Set(k, i)
+			} else {
+				_, _ = m.Get(k)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkMap90R10W(b *testing.B) {
+	for _, d := range keyDists {
+		b.Run("SafeMap/"+d.name, func(b *testing.B) {
+			runMapBench(b, &safeMap{m: make(map[string]int)}, d)
+		})
+		b.Run("SyncMap/"+d.name, func(b *testing.B) {
+			runMapBench(b, &syncMapAdapter{}, d)
+		})
+		b.Run("ConcurrentMap/"+d.name, func(b *testing.B) {
+			runMapBench(b, cmap.New[string, int](cmap.Options{}), d)
+		})
+	}
+}
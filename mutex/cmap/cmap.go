@@ -0,0 +1,278 @@
+// Package cmap provides ConcurrentMap, a generic map split into N shards that
+// each carry their own RWMutex. It grows mutex/007_map_with_mutex.go's SafeMap
+// (one global lock, Get/Set only) into something usable under contention.
+package cmap
+
+import (
+	"context"
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// DefaultShards is used when Options.Shards is zero.
+const DefaultShards = 32
+
+// Options configures a ConcurrentMap. The zero value is valid.
+type Options struct {
+	// Shards is rounded up to a power of two. Defaults to DefaultShards.
+	Shards int
+	// TTL, if set, is applied to every Set/LoadOrStore/Compute that does not
+	// pass its own TTL via SetWithTTL.
+	TTL time.Duration
+	// Now overrides time.Now for expiry checks (tests).
+	Now func() time.Time
+}
+
+// ConcurrentMap is a sharded, goroutine-safe map. All per-key operations
+// (including Compute and Merge) are atomic with respect to that key.
+type ConcurrentMap[K comparable, V any] struct {
+	seed   maphash.Seed
+	shards []shard[K, V]
+	mask   uint64
+	size   atomic.Int64
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+type entry[V any] struct {
+	val     V
+	expires int64 // unix nanos; 0 means no expiry
+}
+
+type shard[K comparable, V any] struct {
+	mu sync.RWMutex
+	m  map[K]entry[V]
+	_  [shardPad]byte
+}
+
+// shardPad rounds a shard up to a multiple of 64 bytes, so neighbouring
+// shard locks are at least a cache line apart and never share one. The
+// fields' sizes do not depend on K and V.
+const shardPad = (64 - (unsafe.Sizeof(sync.RWMutex{})+unsafe.Sizeof(map[int]int(nil)))%64) % 64
+
+// New returns an empty map configured by opts.
+func New[K comparable, V any](opts Options) *ConcurrentMap[K, V] {
+	n := opts.Shards
+	if n <= 0 {
+		n = DefaultShards
+	}
+	pow := 1
+	for pow < n {
+		pow <<= 1
+	}
+	now := opts.Now
+	if now == nil {
+		now = time.Now
+	}
+	c := &ConcurrentMap[K, V]{
+		seed:   maphash.MakeSeed(),
+		shards: make([]shard[K, V], pow),
+		mask:   uint64(pow - 1),
+		ttl:    opts.TTL,
+		now:    now,
+	}
+	for i := range c.shards {
+		c.shards[i].m = make(map[K]entry[V])
+	}
+	return c
+}
+
+func (c *ConcurrentMap[K, V]) shardFor(k K) *shard[K, V] {
+	return &c.shards[maphash.Comparable(c.seed, k)&c.mask]
+}
+
+func (c *ConcurrentMap[K, V]) expiry(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return c.now().Add(ttl).UnixNano()
+}
+
+// live reports whether e exists and has not expired. The clock is only read
+// for entries that carry a TTL.
+func (c *ConcurrentMap[K, V]) live(e entry[V], ok bool) bool {
+	return ok && (e.expires == 0 || e.expires > c.now().UnixNano())
+}
+
+// Get returns the value for k, hiding expired entries.
+func (c *ConcurrentMap[K, V]) Get(k K) (V, bool) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	e, ok := s.m[k]
+	s.mu.RUnlock()
+	if !c.live(e, ok) {
+		var zero V
+		return zero, false
+	}
+	return e.val, true
+}
+
+// Set stores v for k using the map's default TTL.
+func (c *ConcurrentMap[K, V]) Set(k K, v V) { c.SetWithTTL(k, v, c.ttl) }
+
+// SetWithTTL stores v for k, expiring after ttl (0 = never).
+func (c *ConcurrentMap[K, V]) SetWithTTL(k K, v V, ttl time.Duration) {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	if _, ok := s.m[k]; !ok {
+		c.size.Add(1)
+	}
+	s.m[k] = entry[V]{val: v, expires: c.expiry(ttl)}
+	s.mu.Unlock()
+}
+
+// Delete removes k and returns the removed value, if it was live.
+func (c *ConcurrentMap[K, V]) Delete(k K) (V, bool) {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	e, ok := s.m[k]
+	if ok {
+		delete(s.m, k)
+		c.size.Add(-1)
+	}
+	s.mu.Unlock()
+	if !c.live(e, ok) {
+		var zero V
+		return zero, false
+	}
+	return e.val, true
+}
+
+// LoadOrStore returns the existing live value for k if present. Otherwise it
+// stores v and returns it. loaded reports whether the value was already there.
+func (c *ConcurrentMap[K, V]) LoadOrStore(k K, v V) (actual V, loaded bool) {
+	return c.ComputeIfAbsent(k, func() V { return v })
+}
+
+// ComputeIfAbsent returns the live value for k, or calls fn under the shard
+// lock and stores its result. fn runs at most once per missing key even if
+// many goroutines race; keep it short since it blocks the whole shard.
+func (c *ConcurrentMap[K, V]) ComputeIfAbsent(k K, fn func() V) (actual V, loaded bool) {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.m[k]
+	if c.live(e, ok) {
+		return e.val, true
+	}
+	v := fn()
+	s.m[k] = entry[V]{val: v, expires: c.expiry(c.ttl)}
+	if !ok { // counted only once stored, in case fn panics
+		c.size.Add(1)
+	}
+	return v, false
+}
+
+// Compute atomically replaces the value for k with fn(old, loaded). If fn
+// returns keep=false the key is deleted. The new value (or zero) and whether
+// the key is present afterwards are returned.
+func (c *ConcurrentMap[K, V]) Compute(k K, fn func(old V, loaded bool) (v V, keep bool)) (V, bool) {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.m[k]
+	wasLive := c.live(e, ok)
+	if !wasLive {
+		var zero V
+		e.val = zero
+	}
+	v, keep := fn(e.val, wasLive)
+	switch {
+	case keep:
+		if !ok {
+			c.size.Add(1)
+		}
+		s.m[k] = entry[V]{val: v, expires: c.expiry(c.ttl)}
+		return v, true
+	case ok:
+		delete(s.m, k)
+		c.size.Add(-1)
+	}
+	var zero V
+	return zero, false
+}
+
+// Merge stores v if k is absent, otherwise stores fn(old, v). It returns the
+// value now stored, e.g. Merge(k, 1, sum) for counting.
+func (c *ConcurrentMap[K, V]) Merge(k K, v V, fn func(old, v V) V) V {
+	out, _ := c.Compute(k, func(old V, loaded bool) (V, bool) {
+		if !loaded {
+			return v, true
+		}
+		return fn(old, v), true
+	})
+	return out
+}
+
+// Len returns the number of stored entries, including expired ones that have
+// not been swept yet. It is a single atomic load.
+func (c *ConcurrentMap[K, V]) Len() int { return int(c.size.Load()) }
+
+// Snapshot returns a point-in-time copy of all live entries. All shards are
+// read-locked together (always in index order, so it cannot deadlock with
+// another Snapshot), so no write can land halfway through the copy.
+func (c *ConcurrentMap[K, V]) Snapshot() map[K]V {
+	for i := range c.shards {
+		c.shards[i].mu.RLock()
+	}
+	out := make(map[K]V, c.Len())
+	for i := range c.shards {
+		for k, e := range c.shards[i].m {
+			if c.live(e, true) {
+				out[k] = e.val
+			}
+		}
+	}
+	for i := range c.shards {
+		c.shards[i].mu.RUnlock()
+	}
+	return out
+}
+
+// Range calls fn for each entry of a Snapshot. fn may freely call back into
+// the map because no locks are held while it runs.
+func (c *ConcurrentMap[K, V]) Range(fn func(K, V) bool) {
+	for k, v := range c.Snapshot() {
+		if !fn(k, v) {
+			return
+		}
+	}
+}
+
+// Sweep removes expired entries and returns how many were removed. Shards are
+// locked one at a time so readers on other shards are not held up.
+func (c *ConcurrentMap[K, V]) Sweep() int {
+	removed := 0
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		for k, e := range s.m {
+			if !c.live(e, true) {
+				delete(s.m, k)
+				removed++
+			}
+		}
+		s.mu.Unlock()
+	}
+	c.size.Add(int64(-removed))
+	return removed
+}
+
+// StartSweeper runs Sweep every interval until ctx is cancelled.
+func (c *ConcurrentMap[K, V]) StartSweeper(ctx context.Context, interval time.Duration) {
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				c.Sweep()
+			}
+		}
+	}()
+}
@@ -0,0 +1,160 @@
+package cmap
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestBasicOps(t *testing.T) {
+	m := New[string, int](Options{Shards: 5})
+	if len(m.shards) != 8 {
+		t.Fatalf("shards = %d, want 8 (rounded up)", len(m.shards))
+	}
+	m.Set("a", 1)
+	if v, ok := m.Get("a"); !ok || v != 1 {
+		t.Fatalf("Get = %d,%v", v, ok)
+	}
+	if v, loaded := m.LoadOrStore("a", 9); !loaded || v != 1 {
+		t.Fatalf("LoadOrStore existing = %d,%v", v, loaded)
+	}
+	if v, loaded := m.LoadOrStore("b", 2); loaded || v != 2 {
+		t.Fatalf("LoadOrStore new = %d,%v", v, loaded)
+	}
+	if m.Len() != 2 {
+		t.Fatalf("Len = %d", m.Len())
+	}
+	if v, ok := m.Compute("a", func(old int, _ bool) (int, bool) { return 0, false }); ok || v != 0 {
+		t.Fatalf("Compute delete = %d,%v", v, ok)
+	}
+	if _, ok := m.Get("a"); ok {
+		t.Fatal("key survived Compute delete")
+	}
+	if _, ok := m.Delete("b"); !ok {
+		t.Fatal("Delete missed b")
+	}
+	if m.Len() != 0 {
+		t.Fatalf("Len after deletes = %d", m.Len())
+	}
+}
+
+func TestMergeIsAtomic(t *testing.T) {
+	m := New[string, int](Options{})
+	sum := func(a, b int) int { return a + b }
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				m.Merge("hits", 1, sum)
+			}
+		}()
+	}
+	wg.Wait()
+	if v, _ := m.Get("hits"); v != 8000 {
+		t.Fatalf("hits = %d, want 8000", v)
+	}
+}
+
+func TestComputeIfAbsentRunsOnce(t *testing.T) {
+	m := New[int, int](Options{})
+	var calls atomic.Int32
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.ComputeIfAbsent(1, func() int { calls.Add(1); return 42 })
+		}()
+	}
+	wg.Wait()
+	if calls.Load() != 1 {
+		t.Fatalf("fn ran %d times", calls.Load())
+	}
+}
+
+func TestComputeIfAbsentPanic(t *testing.T) {
+	m := New[int, int](Options{})
+	func() {
+		defer func() { recover() }()
+		m.ComputeIfAbsent(1, func() int { panic("boom") })
+	}()
+	if _, ok := m.Get(1); ok || m.Len() != 0 {
+		t.Fatalf("after panicking fn: Len = %d", m.Len())
+	}
+}
+
+// Shards sit in a slice; padding each to a multiple of a cache line keeps
+// neighbours' locks from false sharing, whatever the key and value types.
+func TestShardPadding(t *testing.T) {
+	if size := unsafe.Sizeof(shard[int, int]{}); size%64 != 0 {
+		t.Fatalf("shard is %d bytes, not a multiple of 64", size)
+	}
+	if size := unsafe.Sizeof(shard[string, [100]byte]{}); size%64 != 0 {
+		t.Fatalf("shard is %d bytes, not a multiple of 64", size)
+	}
+}
+
+// A writer bumps k0..k63 to the next generation in order. Any point-in-time
+// view therefore has non-increasing values by key index; a shard-by-shard
+// copy without holding every lock would eventually see a later key ahead of
+// an earlier one.
+func TestSnapshotIsConsistent(t *testing.T) {
+	const keys = 64
+	m := New[int, int](Options{Shards: 16})
+	for k := 0; k < keys; k++ {
+		m.Set(k, 0)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for gen := 1; ctx.Err() == nil; gen++ {
+			for k := 0; k < keys; k++ {
+				m.Set(k, gen)
+			}
+		}
+	}()
+	for i := 0; i < 500; i++ {
+		snap := m.Snapshot()
+		for k := 1; k < keys; k++ {
+			if snap[k] > snap[k-1] || snap[0]-snap[k] > 1 {
+				t.Fatalf("inconsistent snapshot at key %d: %d vs %d", k, snap[k-1], snap[k])
+			}
+		}
+	}
+	cancel()
+	wg.Wait()
+}
+
+func TestTTLAndSweep(t *testing.T) {
+	var now atomic.Int64
+	now.Store(time.Unix(1000, 0).UnixNano())
+	clock := func() time.Time { return time.Unix(0, now.Load()) }
+	m := New[string, string](Options{TTL: time.Minute, Now: clock})
+
+	m.Set("short", "v")
+	m.SetWithTTL("forever", "v", 0)
+	now.Add(int64(2 * time.Minute))
+
+	if _, ok := m.Get("short"); ok {
+		t.Fatal("expired entry still visible")
+	}
+	if _, ok := m.Get("forever"); !ok {
+		t.Fatal("entry without TTL expired")
+	}
+	if m.Len() != 2 {
+		t.Fatalf("Len before sweep = %d, want 2", m.Len())
+	}
+	if n := m.Sweep(); n != 1 {
+		t.Fatalf("Sweep removed %d, want 1", n)
+	}
+	if m.Len() != 1 {
+		t.Fatalf("Len after sweep = %d", m.Len())
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gobyexamples/wait_group/taskgroup"
+)
+
+// Run with: go run wait_group/examples/taskgroup_results.go
+// errgroup_pipeline.go with results: fetch pages two at a time, get the
+// sizes back in input order, and see every failure instead of the first.
+func fetch(ctx context.Context, url string) (int, error) {
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-time.After(time.Duration(len(url)) * 5 * time.Millisecond):
+	}
+	if strings.Contains(url, "missing") {
+		return 0, errors.New("404 " + url)
+	}
+	return len(url) * 100, nil
+}
+
+func main() {
+	urls := []string{"/home", "/missing-a", "/about", "/missing-b", "/blog"}
+
+	g, _ := taskgroup.New[int](context.Background(), taskgroup.Options{CollectAll: true})
+	g.SetLimit(2)
+	for _, u := range urls {
+		g.Go(func(ctx context.Context) (int, error) { return fetch(ctx, u) })
+	}
+	sizes, err := g.Wait()
+	for i, u := range urls {
+		fmt.Printf("%-11s %d\n", u, sizes[i])
+	}
+	fmt.Println("errors:")
+	fmt.Println(err)
+}
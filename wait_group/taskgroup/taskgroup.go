@@ -0,0 +1,178 @@
+// Package taskgroup is errgroup with results.
+//
+// Like golang.org/x/sync/errgroup it runs functions in goroutines, cancels
+// a shared context on the first error and bounds concurrency with
+// SetLimit. On top of that:
+//
+//   - each task returns a value; Wait returns them in the order Go was
+//     called, so results[i] belongs to the i-th task
+//   - with Options.CollectAll, a failure does not cancel the others and Wait
+//     returns every error joined, each tagged with its task index
+//   - a panicking task becomes a *PanicError instead of crashing the process
+//   - when the group is at its limit, Go waits for a slot or for the context
+//     to end, whichever comes first; a task that never got a slot fails with
+//     the context's error without running
+package taskgroup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+)
+
+// Options configures a Group. The zero value cancels on the first error
+// and has no concurrency limit.
+type Options struct {
+	// CollectAll runs every task to completion and reports all errors,
+	// instead of cancelling the rest on the first one.
+	CollectAll bool
+}
+
+// TaskError is a task's failure tagged with the task's index.
+type TaskError struct {
+	Index int
+	Err   error
+}
+
+func (e *TaskError) Error() string { return fmt.Sprintf("task %d: %v", e.Index, e.Err) }
+func (e *TaskError) Unwrap() error { return e.Err }
+
+// PanicError is the error of a task that panicked.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (p *PanicError) Error() string { return fmt.Sprintf("panic: %v\n\n%s", p.Value, p.Stack) }
+
+// Group runs tasks returning T. Create one with New.
+type Group[T any] struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	opts   Options
+	wg     sync.WaitGroup
+	sem    chan struct{}
+
+	mu      sync.Mutex
+	results []T
+	errs    []*TaskError
+}
+
+// New returns a group and a context derived from ctx that is cancelled
+// when a task fails (unless CollectAll) or when Wait returns.
+func New[T any](ctx context.Context, opts Options) (*Group[T], context.Context) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &Group[T]{ctx: ctx, cancel: cancel, opts: opts}, ctx
+}
+
+// SetLimit caps the number of tasks running at once; n < 0 removes the
+// cap. It must not be called while tasks are running.
+func (g *Group[T]) SetLimit(n int) {
+	if n < 0 {
+		g.sem = nil
+		return
+	}
+	if len(g.sem) != 0 {
+		panic(fmt.Errorf("taskgroup: modify limit while %d tasks are still active", len(g.sem)))
+	}
+	g.sem = make(chan struct{}, n)
+}
+
+// Go runs fn in a new goroutine as the next task. If the group is at its
+// limit, Go blocks until a slot frees up or the group's context is done.
+func (g *Group[T]) Go(fn func(ctx context.Context) (T, error)) {
+	i := g.reserve()
+	if g.sem != nil {
+		select {
+		case g.sem <- struct{}{}:
+		case <-g.ctx.Done():
+			g.fail(i, context.Cause(g.ctx))
+			return
+		}
+	}
+	g.start(i, fn)
+}
+
+// TryGo starts fn only if a slot is free, reporting whether it did.
+func (g *Group[T]) TryGo(fn func(ctx context.Context) (T, error)) bool {
+	if g.sem != nil {
+		select {
+		case g.sem <- struct{}{}:
+		default:
+			return false
+		}
+	}
+	g.start(g.reserve(), fn)
+	return true
+}
+
+func (g *Group[T]) reserve() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var zero T
+	g.results = append(g.results, zero)
+	return len(g.results) - 1
+}
+
+func (g *Group[T]) start(i int, fn func(ctx context.Context) (T, error)) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if g.sem != nil {
+			defer func() { <-g.sem }()
+		}
+		v, err := run(g.ctx, fn)
+		if err != nil {
+			g.fail(i, err)
+			return
+		}
+		g.mu.Lock()
+		g.results[i] = v
+		g.mu.Unlock()
+	}()
+}
+
+func run[T any](ctx context.Context, fn func(ctx context.Context) (T, error)) (v T, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return fn(ctx)
+}
+
+func (g *Group[T]) fail(i int, err error) {
+	te := &TaskError{Index: i, Err: err}
+	g.mu.Lock()
+	g.errs = append(g.errs, te)
+	first := len(g.errs) == 1
+	g.mu.Unlock()
+	if first && !g.opts.CollectAll {
+		g.cancel(te)
+	}
+}
+
+// Wait waits for every task and returns their results in Go order; failed
+// tasks leave a zero value. The error is the first *TaskError, or with
+// CollectAll every *TaskError joined in index order.
+func (g *Group[T]) Wait() ([]T, error) {
+	g.wg.Wait()
+	g.cancel(context.Canceled)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.errs) == 0 {
+		return g.results, nil
+	}
+	if !g.opts.CollectAll {
+		return g.results, g.errs[0]
+	}
+	sort.Slice(g.errs, func(a, b int) bool { return g.errs[a].Index < g.errs[b].Index })
+	errs := make([]error, len(g.errs))
+	for k, e := range g.errs {
+		errs[k] = e
+	}
+	return g.results, errors.Join(errs...)
+}
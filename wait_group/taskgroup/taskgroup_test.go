@@ -0,0 +1,178 @@
+package taskgroup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gobyexamples/goroutine/leakcheck"
+)
+
+var errBad = errors.New("bad input")
+
+func TestResultsInGoOrder(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	g, _ := New[string](context.Background(), Options{})
+	for i := 0; i < 10; i++ {
+		g.Go(func(context.Context) (string, error) {
+			time.Sleep(time.Duration(10-i) * time.Millisecond) // finish in reverse
+			return fmt.Sprint("r", i), nil
+		})
+	}
+	got, err := g.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != "[r0 r1 r2 r3 r4 r5 r6 r7 r8 r9]" {
+		t.Fatalf("results = %v", got)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	g, _ := New[int](context.Background(), Options{})
+	g.SetLimit(3)
+	var running, peak atomic.Int32
+	for i := 0; i < 20; i++ {
+		g.Go(func(context.Context) (int, error) {
+			n := running.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(2 * time.Millisecond)
+			running.Add(-1)
+			return i * i, nil
+		})
+	}
+	got, err := g.Wait()
+	if err != nil || got[19] != 361 {
+		t.Fatalf("got %v, %v", got, err)
+	}
+	if peak.Load() > 3 {
+		t.Fatalf("peak concurrency %d > limit 3", peak.Load())
+	}
+
+	g2, _ := New[int](context.Background(), Options{})
+	g2.SetLimit(1)
+	release := make(chan struct{})
+	g2.Go(func(context.Context) (int, error) { <-release; return 1, nil })
+	if g2.TryGo(func(context.Context) (int, error) { return 2, nil }) {
+		t.Fatal("TryGo succeeded with the limit reached")
+	}
+	close(release)
+	if got, _ := g2.Wait(); len(got) != 1 {
+		t.Fatalf("rejected TryGo left a result slot: %v", got)
+	}
+}
+
+func TestFirstErrorCancelsInFlight(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	g, ctx := New[int](context.Background(), Options{})
+	var cancelled atomic.Int32
+	for i := 0; i < 4; i++ {
+		g.Go(func(ctx context.Context) (int, error) {
+			select {
+			case <-ctx.Done():
+				cancelled.Add(1)
+				return 0, ctx.Err()
+			case <-time.After(5 * time.Second):
+				return i, nil
+			}
+		})
+	}
+	g.Go(func(context.Context) (int, error) { return 0, errBad })
+
+	begin := time.Now()
+	_, err := g.Wait()
+	if time.Since(begin) > time.Second {
+		t.Fatal("in-flight tasks were not cancelled")
+	}
+	var te *TaskError
+	if !errors.As(err, &te) || te.Index != 4 || !errors.Is(err, errBad) {
+		t.Fatalf("err = %v", err)
+	}
+	if cancelled.Load() != 4 {
+		t.Fatalf("%d tasks saw cancellation, want 4", cancelled.Load())
+	}
+	if !errors.Is(context.Cause(ctx), errBad) {
+		t.Fatalf("context cause = %v", context.Cause(ctx))
+	}
+}
+
+func TestQueuedTasksGiveUpOnCancel(t *testing.T) {
+	leakcheck.VerifyNone(t)
+	parent, cancel := context.WithCancel(context.Background())
+	g, _ := New[int](parent, Options{CollectAll: true})
+	g.SetLimit(1)
+	started := make(chan struct{})
+	g.Go(func(ctx context.Context) (int, error) {
+		close(started)
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	<-started
+
+	var ran atomic.Bool
+	queued := make(chan struct{})
+	go func() {
+		defer close(queued)
+		g.Go(func(context.Context) (int, error) { ran.Store(true); return 1, nil })
+	}()
+	time.Sleep(5 * time.Millisecond) // let Go block on the full group
+	cancel()
+	select {
+	case <-queued:
+	case <-time.After(time.Second):
+		t.Fatal("Go still queued after cancel")
+	}
+
+	_, err := g.Wait()
+	if ran.Load() {
+		t.Fatal("queued task ran after cancel")
+	}
+	if !errors.Is(err, context.Canceled) || !strings.Contains(err.Error(), "task 1:") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestCollectAllJoinsErrorsByIndex(t *testing.T) {
+	g, _ := New[int](context.Background(), Options{CollectAll: true})
+	for i := 0; i < 6; i++ {
+		g.Go(func(ctx context.Context) (int, error) {
+			if i%2 == 1 {
+				time.Sleep(time.Duration(6-i) * time.Millisecond)
+				return 0, fmt.Errorf("odd %d: %w", i, errBad)
+			}
+			time.Sleep(10 * time.Millisecond)
+			return i, ctx.Err() // siblings are not cancelled
+		})
+	}
+	got, err := g.Wait()
+	if fmt.Sprint(got) != "[0 0 2 0 4 0]" {
+		t.Fatalf("results = %v", got)
+	}
+	want := "task 1: odd 1: bad input\ntask 3: odd 3: bad input\ntask 5: odd 5: bad input"
+	if err == nil || err.Error() != want {
+		t.Fatalf("err = %q, want %q", err, want)
+	}
+	if !errors.Is(err, errBad) {
+		t.Fatal("joined error does not match errBad")
+	}
+}
+
+func TestPanicBecomesError(t *testing.T) {
+	g, _ := New[int](context.Background(), Options{})
+	g.Go(func(context.Context) (int, error) { panic("kaboom") })
+	_, err := g.Wait()
+	var pe *PanicError
+	if !errors.As(err, &pe) || pe.Value != "kaboom" || !strings.Contains(string(pe.Stack), "taskgroup_test.go") {
+		t.Fatalf("err = %v", err)
+	}
+}